@@ -0,0 +1,145 @@
+// Package audit writes the audit log of the state requests. Every event is a JSON object on its own line, which is
+// appended to a file, written to stdout or sent to syslog.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// Event is a request to a state or an admin operation.
+type Event struct {
+	Time time.Time `json:"time"`
+	// Subject is the subject of the identity, it's empty if the request wasn't authenticated or the auth backend
+	// doesn't know it
+	Subject string `json:"subject,omitempty"`
+	// AuthMethod is the name of the auth backend selected by the credentials of the request
+	AuthMethod string `json:"auth_method,omitempty"`
+	// Authenticated is false if the request was rejected by the auth backend or the policy
+	Authenticated bool   `json:"authenticated"`
+	Project       string `json:"project,omitempty"`
+	State         string `json:"state,omitempty"`
+	// StateID is the ID of the state of an admin operation, which is addressed by the ID instead of project and name
+	StateID   string `json:"state_id,omitempty"`
+	Method    string `json:"method"`
+	Operation string `json:"operation,omitempty"`
+	LockID    string `json:"lock_id,omitempty"`
+	// Serial is the serial of a written state
+	Serial   *uint64 `json:"serial,omitempty"`
+	Code     int     `json:"code"`
+	ClientIP string  `json:"client_ip"`
+	// ForwardedFor is the X-Forwarded-For header of the request, which is set by the client or a proxy
+	ForwardedFor string `json:"forwarded_for,omitempty"`
+}
+
+// Logger writes the events to a sink.
+type Logger struct {
+	mu sync.Mutex
+	w  io.WriteCloser
+}
+
+// New opens the sink of the configuration (file, stdout or syslog).
+func New(cfg config.AuditConfig) (*Logger, error) {
+	switch cfg.Sink {
+	case "file":
+		// the file is only appended to, existing events are never rewritten
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("opening audit log: %w", err)
+		}
+
+		return NewLogger(f), nil
+	case "stdout":
+		return NewLogger(nopCloser{os.Stdout}), nil
+	case "syslog":
+		w, err := dialSyslog(cfg.Syslog)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to syslog: %w", err)
+		}
+
+		return NewLogger(w), nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink %q", cfg.Sink)
+	}
+}
+
+// NewLogger creates a logger writing every event with a single call of Write.
+func NewLogger(w io.WriteCloser) *Logger {
+	return &Logger{w: w}
+}
+
+// Log writes the event.
+func (l *Logger) Log(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, err = l.w.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes the sink.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.w.Close()
+}
+
+var (
+	mu sync.RWMutex
+	// active is the logger of all state requests, it's set on startup by Configure
+	active *Logger
+)
+
+// Configure sets the logger used by Log, nil disables the audit log.
+func Configure(l *Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	active = l
+}
+
+// Enabled returns whether a logger is configured, so that the event is only built if it's written.
+func Enabled() bool {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return active != nil
+}
+
+// Log writes the event with the configured logger. Errors are logged, but don't fail the request.
+func Log(e Event) {
+	mu.RLock()
+	l := active
+	mu.RUnlock()
+
+	if l == nil {
+		return
+	}
+
+	if err := l.Log(e); err != nil {
+		log.Errorf("failed to write audit event for state %s/%s: %v", e.Project, e.State, err)
+	}
+}
+
+// nopCloser doesn't close stdout on shutdown.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,159 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+func TestFileSink(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	serial := uint64(3)
+	events := []Event{
+		{Time: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC), Project: "project1", State: "example", Method: "LOCK", Code: 200},
+		{Time: time.Date(2024, 1, 1, 12, 0, 1, 0, time.UTC), Project: "project1", State: "example", Method: "POST", Serial: &serial, Code: 200},
+	}
+
+	// events of a restarted server are appended
+	for _, e := range events {
+		l, err := New(config.AuditConfig{Sink: "file", File: file})
+		require.NoError(t, err)
+		require.NoError(t, l.Log(e))
+		require.NoError(t, l.Close())
+	}
+
+	info, err := os.Stat(file)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	d, err := os.ReadFile(file)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(d), "\n"), "\n")
+	require.Len(t, lines, len(events))
+
+	for i, line := range lines {
+		var e Event
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		require.Equal(t, events[i], e)
+	}
+}
+
+func TestStdoutSink(t *testing.T) {
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+
+	stdout := os.Stdout
+	os.Stdout = w
+	t.Cleanup(func() { os.Stdout = stdout })
+
+	l, err := New(config.AuditConfig{Sink: "stdout"})
+	require.NoError(t, err)
+	require.NoError(t, l.Log(Event{Project: "project1", State: "example", Method: "GET", Code: 200}))
+
+	// stdout stays open for the server log
+	require.NoError(t, l.Close())
+	_, err = w.Write([]byte("end"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	d, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(d), `{"time":"0001-01-01T00:00:00Z",`))
+	require.True(t, strings.HasSuffix(string(d), "}\nend"))
+}
+
+func TestUnknownSink(t *testing.T) {
+	_, err := New(config.AuditConfig{Sink: "kafka"})
+	require.EqualError(t, err, `unknown audit sink "kafka"`)
+}
+
+func TestEventFields(t *testing.T) {
+	serial := uint64(3)
+
+	for _, tc := range []struct {
+		name  string
+		event Event
+		json  string
+	}{
+		{
+			name: "state request",
+			event: Event{
+				Time:          time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+				Subject:       "alice",
+				AuthMethod:    "ldap",
+				Authenticated: true,
+				Project:       "project1",
+				State:         "example",
+				Method:        "POST",
+				Operation:     "write",
+				LockID:        "cf290ef3-6090-410e-9784-d017a4b1536a",
+				Serial:        &serial,
+				Code:          200,
+				ClientIP:      "10.0.0.5",
+				ForwardedFor:  "192.0.2.1",
+			},
+			json: `{"time":"2024-01-01T12:00:00Z","subject":"alice","auth_method":"ldap","authenticated":true,"project":"project1","state":"example","method":"POST","operation":"write","lock_id":"cf290ef3-6090-410e-9784-d017a4b1536a","serial":3,"code":200,"client_ip":"10.0.0.5","forwarded_for":"192.0.2.1"}`,
+		},
+		{
+			name: "rejected request",
+			event: Event{
+				Time:     time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+				Project:  "project1",
+				State:    "example",
+				Method:   "GET",
+				Code:     403,
+				ClientIP: "10.0.0.5",
+			},
+			json: `{"time":"2024-01-01T12:00:00Z","authenticated":false,"project":"project1","state":"example","method":"GET","code":403,"client_ip":"10.0.0.5"}`,
+		},
+		{
+			name: "admin operation",
+			event: Event{
+				Time:          time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC),
+				Subject:       "admin",
+				AuthMethod:    "admin",
+				Authenticated: true,
+				StateID:       "d82238e1",
+				Method:        "DELETE",
+				Operation:     "force-unlock",
+				LockID:        "cf290ef3-6090-410e-9784-d017a4b1536a",
+				Code:          200,
+				ClientIP:      "10.0.0.5",
+			},
+			json: `{"time":"2024-01-01T12:00:00Z","subject":"admin","auth_method":"admin","authenticated":true,"state_id":"d82238e1","method":"DELETE","operation":"force-unlock","lock_id":"cf290ef3-6090-410e-9784-d017a4b1536a","code":200,"client_ip":"10.0.0.5"}`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var b strings.Builder
+			l := NewLogger(nopCloser{&b})
+
+			require.NoError(t, l.Log(tc.event))
+			require.Equal(t, tc.json+"\n", b.String())
+		})
+	}
+}
+
+func TestLog(t *testing.T) {
+	var b strings.Builder
+
+	// without a logger the event is dropped
+	require.False(t, Enabled())
+	Log(Event{Method: "GET"})
+
+	Configure(NewLogger(nopCloser{&b}))
+	t.Cleanup(func() { Configure(nil) })
+
+	require.True(t, Enabled())
+	Log(Event{Method: "GET", Code: 200})
+	require.Equal(t, `{"time":"0001-01-01T00:00:00Z","authenticated":false,"method":"GET","code":200,"client_ip":""}`+"\n", b.String())
+}
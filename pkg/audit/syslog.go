@@ -0,0 +1,15 @@
+//go:build !windows && !plan9
+
+package audit
+
+import (
+	"io"
+	"log/syslog"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// dialSyslog connects to the syslog server, an empty network connects to the local syslog daemon.
+func dialSyslog(cfg config.AuditSyslogConfig) (io.WriteCloser, error) {
+	return syslog.Dial(cfg.Network, cfg.Address, syslog.LOG_INFO|syslog.LOG_AUTH, cfg.Tag)
+}
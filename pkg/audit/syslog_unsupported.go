@@ -0,0 +1,14 @@
+//go:build windows || plan9
+
+package audit
+
+import (
+	"errors"
+	"io"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+func dialSyslog(_ config.AuditSyslogConfig) (io.WriteCloser, error) {
+	return nil, errors.New("syslog isn't supported on this platform")
+}
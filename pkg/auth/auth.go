@@ -1,13 +1,14 @@
 package auth
 
 import (
+	"crypto/x509"
 	"fmt"
 	"net/http"
+	"slices"
+	"sort"
+	"sync"
 
-	"github.com/spf13/viper"
-
-	"github.com/nimbolus/terraform-backend/pkg/auth/basic"
-	"github.com/nimbolus/terraform-backend/pkg/auth/jwt"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
@@ -16,34 +17,162 @@ type Authenticator interface {
 	Authenticate(secret string, s *terraform.State) (bool, error)
 }
 
-func Authenticate(req *http.Request, s *terraform.State) (ok bool, err error) {
-	backend, secret, ok := req.BasicAuth()
-	if !ok {
-		return false, fmt.Errorf("no basic auth header found")
+var (
+	authenticatorsMu sync.RWMutex
+	// authenticators are the enabled auth backends, they're created on startup by Configure
+	authenticators map[string]Authenticator
+	// userAuthenticators are the enabled UserAuthenticator backends in the order they're tried
+	userAuthenticators []Authenticator
+)
+
+// Configure creates the auth backends enabled by the configuration. If it isn't called, the default configuration
+// is used by the first call of Authenticate.
+func Configure(cfg config.AuthConfig, clients config.ClientsConfig) error {
+	a, err := newAuthenticators(cfg, clients)
+	if err != nil {
+		return err
+	}
+
+	users := orderUserAuthenticators(a, cfg.UserBackends)
+
+	authenticatorsMu.Lock()
+	authenticators, userAuthenticators = a, users
+	authenticatorsMu.Unlock()
+
+	return nil
+}
+
+// configureDefaults configures the auth backends with the default configuration, if Configure wasn't called.
+func configureDefaults() error {
+	authenticatorsMu.RLock()
+	configured := authenticators != nil
+	authenticatorsMu.RUnlock()
+
+	if configured {
+		return nil
+	}
+
+	defaults := config.Default()
+	return Configure(defaults.Auth, defaults.Clients())
+}
+
+func getAuthenticator(backend string) (Authenticator, error) {
+	if err := configureDefaults(); err != nil {
+		return nil, err
+	}
+
+	authenticatorsMu.RLock()
+	defer authenticatorsMu.RUnlock()
+
+	if a, ok := authenticators[backend]; ok {
+		return a, nil
+	} else if isRegistered(backend) {
+		return nil, fmt.Errorf("%s auth is not enabled", backend)
+	}
+
+	return nil, fmt.Errorf("failed to initialize auth backend %s: backend is not implemented (registered: %s)",
+		backend, backendList())
+}
+
+// credentials are the credentials of a request and the auth backend selected by them.
+type credentials struct {
+	authenticator Authenticator
+	secret        string
+	// username is set, if the basic auth username isn't the name of an auth backend but a user account, which is
+	// authenticated by the first of users accepting it (authenticator is the first of them)
+	username string
+	users    []Authenticator
+	// cert is set, if the request is authenticated by its client certificate
+	cert *x509.Certificate
+}
+
+// getCredentials returns the credentials of the request. The basic auth username selects the auth backend, other
+// usernames are user accounts, which are authenticated by the enabled UserAuthenticator backends. Requests without
+// basic auth header are authenticated by their verified client certificate, if a CertificateAuthenticator is enabled.
+func getCredentials(req *http.Request) (*credentials, error) {
+	if err := configureDefaults(); err != nil {
+		return nil, err
+	}
+
+	if username, secret, ok := req.BasicAuth(); ok {
+		if !isRegistered(username) {
+			authenticatorsMu.RLock()
+			users := userAuthenticators
+			authenticatorsMu.RUnlock()
+
+			if len(users) > 0 {
+				return &credentials{authenticator: users[0], secret: secret, username: username, users: users}, nil
+			}
+		}
+
+		authenticator, err := getAuthenticator(username)
+		if err != nil {
+			return nil, err
+		}
+
+		return &credentials{authenticator: authenticator, secret: secret}, nil
 	}
 
-	var authenticator Authenticator
-	switch backend {
-	case basic.Name:
-		viper.SetDefault("auth_basic_enabled", true)
-		if !viper.GetBool("auth_basic_enabled") {
-			return false, fmt.Errorf("basic auth is not enabled")
+	if cert := ClientCertificate(req); cert != nil {
+		if authenticator := findAuthenticator(func(a Authenticator) bool {
+			_, ok := a.(CertificateAuthenticator)
+			return ok
+		}); authenticator != nil {
+			return &credentials{authenticator: authenticator, cert: cert}, nil
 		}
-		authenticator = basic.NewBasicAuth()
-	case jwt.Name:
-		issuerURL := viper.GetString("auth_jwt_oidc_issuer_url")
-		if addr := viper.GetString("vault_addr"); issuerURL != "" && addr != "" {
-			issuerURL = fmt.Sprintf("%s/v1/identity/oidc", addr)
-		} else {
-			return false, fmt.Errorf("jwt auth is not enabled")
+	}
+
+	return nil, fmt.Errorf("no basic auth header found")
+}
+
+// orderUserAuthenticators returns the enabled UserAuthenticator backends in the configured order, followed by the
+// ones which aren't listed by name.
+func orderUserAuthenticators(authenticators map[string]Authenticator, order []string) []Authenticator {
+	names := make([]string, 0, len(authenticators))
+	for name, a := range authenticators {
+		if _, ok := a.(UserAuthenticator); ok {
+			names = append(names, name)
 		}
-		authenticator = jwt.NewJWTAuth(issuerURL)
-	default:
-		err = fmt.Errorf("backend is not implemented")
 	}
-	if err != nil {
-		return false, fmt.Errorf("failed to initialize auth backend %s: %v", backend, err)
+	sort.Strings(names)
+
+	sort.SliceStable(names, func(i, j int) bool {
+		return position(order, names[i]) < position(order, names[j])
+	})
+
+	users := make([]Authenticator, 0, len(names))
+	for _, name := range names {
+		users = append(users, authenticators[name])
+	}
+
+	return users
+}
+
+// position returns the index of name in order, names which aren't listed come last.
+func position(order []string, name string) int {
+	if i := slices.Index(order, name); i >= 0 {
+		return i
+	}
+
+	return len(order)
+}
+
+// findAuthenticator returns the first enabled auth backend by name, which satisfies match.
+func findAuthenticator(match func(Authenticator) bool) Authenticator {
+	authenticatorsMu.RLock()
+	defer authenticatorsMu.RUnlock()
+
+	names := make([]string, 0, len(authenticators))
+	for name, a := range authenticators {
+		if match(a) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	if len(names) == 0 {
+		return nil
 	}
 
-	return authenticator.Authenticate(secret, s)
+	return authenticators[names[0]]
 }
@@ -0,0 +1,308 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// testAuth grants all operations on every state.
+type testAuth struct{}
+
+func (testAuth) GetName() string {
+	return "test"
+}
+
+func (testAuth) Authenticate(secret string, s *terraform.State) (bool, error) {
+	return secret == "secret", nil
+}
+
+// readOnlyAuth only grants reading states.
+type readOnlyAuth struct {
+	testAuth
+}
+
+func (readOnlyAuth) GetName() string {
+	return "readonly"
+}
+
+func (a readOnlyAuth) Authorize(secret string, s *terraform.State, op Operation) (bool, error) {
+	ok, err := a.Authenticate(secret, s)
+	return ok && op == Read, err
+}
+
+// userAuth authenticates the user alice, who may read all states.
+type userAuth struct {
+	testAuth
+}
+
+func (userAuth) GetName() string {
+	return "users"
+}
+
+func (userAuth) IdentifyUser(username, password string) (*Identity, error) {
+	if username != "alice" || password != "secret" {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+
+	return &Identity{
+		Subject: username,
+		Grant: func(_ *terraform.State, op Operation) (bool, error) {
+			return op == Read, nil
+		},
+	}, nil
+}
+
+// directoryAuth authenticates the user bob and another account of alice, who may read and write all states.
+type directoryAuth struct {
+	testAuth
+}
+
+func (directoryAuth) GetName() string {
+	return "directory"
+}
+
+func (directoryAuth) IdentifyUser(username, password string) (*Identity, error) {
+	if (username != "alice" || password != "directory") && (username != "bob" || password != "secret") {
+		return nil, fmt.Errorf("invalid credentials")
+	}
+
+	return &Identity{
+		Subject: username,
+		Grant: func(_ *terraform.State, op Operation) (bool, error) {
+			return op == Read || op == Write, nil
+		},
+	}, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	Register("test", func(config.AuthConfig, config.ClientsConfig) (Authenticator, error) {
+		return testAuth{}, nil
+	})
+	Register("readonly", func(config.AuthConfig, config.ClientsConfig) (Authenticator, error) {
+		return readOnlyAuth{}, nil
+	})
+	Register("disabled", func(config.AuthConfig, config.ClientsConfig) (Authenticator, error) {
+		return nil, ErrDisabled
+	})
+	require.NoError(t, Configure(config.Default().Auth, config.ClientsConfig{}))
+
+	request := func(backend, secret string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, "/state/project/name", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth(backend, secret)
+
+		return req
+	}
+
+	tests := []struct {
+		name    string
+		backend string
+		secret  string
+		op      Operation
+		ok      bool
+		err     string
+	}{
+		{"all operations", "test", "secret", Delete, true, ""},
+		{"invalid secret", "test", "other", Read, false, ""},
+		{"read-only read", "readonly", "secret", Read, true, ""},
+		{"read-only write", "readonly", "secret", Write, false, ""},
+		{"disabled", "disabled", "secret", Read, false, "disabled auth is not enabled"},
+		{"unknown", "unknown", "secret", Read, false, "backend is not implemented"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := &terraform.State{Project: "project", Name: "name"}
+
+			identity, err := Authenticate(request(test.backend, test.secret))
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+
+			ok, err := identity.Authorize(state, test.op)
+			require.NoError(t, err)
+			require.Equal(t, test.ok, ok)
+
+			if ok {
+				require.Equal(t, test.backend, state.Metadata.AuthMethod)
+			}
+		})
+	}
+}
+
+func TestAuthenticateUser(t *testing.T) {
+	Register("users", func(config.AuthConfig, config.ClientsConfig) (Authenticator, error) {
+		return userAuth{}, nil
+	})
+	require.NoError(t, Configure(config.Default().Auth, config.ClientsConfig{}))
+
+	request := func(username, password string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, "/state/project/name", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth(username, password)
+
+		return req
+	}
+
+	state := &terraform.State{Project: "project", Name: "name"}
+
+	identity, err := Authenticate(request("alice", "secret"))
+	require.NoError(t, err)
+	require.Equal(t, "alice", identity.Subject)
+	require.Equal(t, "users", identity.Backend)
+
+	ok, err := identity.Authorize(state, Read)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "users", state.Metadata.AuthMethod)
+
+	ok, err = identity.Authorize(state, Write)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	_, err = Authenticate(request("alice", "other"))
+	require.ErrorContains(t, err, "users: invalid username or password")
+
+	// the names of auth backends aren't user accounts
+	identity, err = Authenticate(request("users", "secret"))
+	require.NoError(t, err)
+
+	ok, err = identity.Authorize(state, Read)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestAuthenticateUserOrder(t *testing.T) {
+	if !isRegistered("users") {
+		Register("users", func(config.AuthConfig, config.ClientsConfig) (Authenticator, error) {
+			return userAuth{}, nil
+		})
+	}
+	Register("directory", func(config.AuthConfig, config.ClientsConfig) (Authenticator, error) {
+		return directoryAuth{}, nil
+	})
+
+	request := func(username, password string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, "/state/project/name", nil)
+		require.NoError(t, err)
+		req.SetBasicAuth(username, password)
+
+		return req
+	}
+
+	tests := []struct {
+		order    []string
+		username string
+		password string
+		backend  string
+	}{
+		{nil, "alice", "directory", "directory"},
+		{nil, "bob", "secret", "directory"},
+		{[]string{"directory", "users"}, "alice", "secret", "users"},
+		{[]string{"directory", "users"}, "alice", "directory", "directory"},
+		// backends, which aren't listed, are tried afterwards
+		{[]string{"directory"}, "alice", "secret", "users"},
+	}
+
+	for _, test := range tests {
+		cfg := config.Default().Auth
+		cfg.UserBackends = test.order
+		require.NoError(t, Configure(cfg, config.ClientsConfig{}))
+
+		identity, err := Authenticate(request(test.username, test.password))
+		require.NoError(t, err)
+		require.Equal(t, test.backend, identity.Backend, "%v %s", test.order, test.username)
+		require.Equal(t, test.username, identity.Subject)
+	}
+
+	_, err := Authenticate(request("bob", "other"))
+	require.ErrorContains(t, err, "users: invalid username or password")
+	require.ErrorContains(t, err, "directory: invalid credentials")
+}
+
+func TestParseOperations(t *testing.T) {
+	ops, err := ParseOperations(nil)
+	require.NoError(t, err)
+	require.Equal(t, Operations, ops)
+
+	ops, err = ParseOperations([]string{"read", "lock"})
+	require.NoError(t, err)
+	require.Equal(t, []Operation{Read, Lock}, ops)
+
+	_, err = ParseOperations([]string{"admin"})
+	require.Error(t, err)
+}
+
+func TestClaimValues(t *testing.T) {
+	claims := map[string]any{
+		"groups":        []any{"admins", "users"},
+		"ref_protected": true,
+		"namespacePath": "infra",
+		"nested":        map[string]any{"Project": "infra", "project": "other", "Owner": "alice", "OWNER": "bob"},
+	}
+
+	values, err := ClaimValues(claims, "groups")
+	require.NoError(t, err)
+	require.Equal(t, []string{"admins", "users"}, values)
+
+	values, err = ClaimValues(claims, "ref_protected")
+	require.NoError(t, err)
+	require.Equal(t, []string{"true"}, values)
+
+	// keys are looked up case-insensitively, if they don't exist
+	values, err = ClaimValues(claims, "namespacepath")
+	require.NoError(t, err)
+	require.Equal(t, []string{"infra"}, values)
+
+	// an existing key is preferred
+	values, err = ClaimValues(claims, "nested.project")
+	require.NoError(t, err)
+	require.Equal(t, []string{"other"}, values)
+
+	// but several keys, which only differ by case, are ambiguous
+	for range 10 {
+		_, err = ClaimValues(claims, "nested.owner")
+		require.EqualError(t, err, "claim nested.owner: key owner is ambiguous, it matches OWNER and Owner")
+	}
+
+	values, err = ClaimValues(claims, "missing")
+	require.NoError(t, err)
+	require.Empty(t, values)
+}
+
+func TestValidate(t *testing.T) {
+	Register("reserved", func(config.AuthConfig, config.ClientsConfig) (Authenticator, error) {
+		return nil, ErrDisabled
+	})
+
+	cfg := config.Default().Auth
+	// the built-in user backends aren't registered in this package
+	cfg.UserBackends = []string{"reserved"}
+	require.NoError(t, Validate(cfg))
+
+	cfg.UserBackends = []string{"reserved", "sql"}
+	cfg.Htpasswd.Enabled = true
+	cfg.Htpasswd.Users = []config.HtpasswdUserConfig{{Name: "alice"}, {Name: "reserved"}}
+
+	cfg.JWT.Issuers = []config.JWTIssuerConfig{{URL: "https://issuer.example.com", Match: "sql"}}
+	cfg.GitLab.Enabled = true
+	cfg.GitLab.Match = "regexp"
+	cfg.MTLS.Match = "sql"
+
+	err := Validate(cfg)
+	require.ErrorContains(t, err,
+		`auth.jwt.match (AUTH_JWT_MATCH): unknown pattern syntax "sql" of issuer https://issuer.example.com`)
+	require.ErrorContains(t, err, `auth.gitlab.match (AUTH_GITLAB_MATCH): unknown pattern syntax "regexp"`)
+	require.ErrorContains(t, err, `auth.user_backends.1 (AUTH_USER_BACKENDS_1): unknown backend "sql"`)
+	require.ErrorContains(t, err,
+		`auth.htpasswd.users.1.name (AUTH_HTPASSWD_USERS_1_NAME): "reserved" is the name of an auth backend`)
+	require.NotContains(t, err.Error(), "auth.mtls.match", "disabled backends aren't checked")
+}
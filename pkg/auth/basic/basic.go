@@ -4,11 +4,23 @@ import (
 	"crypto/sha256"
 	"fmt"
 
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
 const Name = "basic"
 
+func init() {
+	auth.Register(Name, func(cfg config.AuthConfig, _ config.ClientsConfig) (auth.Authenticator, error) {
+		if !cfg.Basic.Enabled {
+			return nil, auth.ErrDisabled
+		}
+
+		return NewBasicAuth(), nil
+	})
+}
+
 type BasicAuth struct{}
 
 func NewBasicAuth() *BasicAuth {
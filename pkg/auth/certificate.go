@@ -0,0 +1,28 @@
+package auth
+
+import (
+	"crypto/x509"
+	"net/http"
+)
+
+// CertificateAuthenticator is implemented by auth backends, which authenticate the verified client certificate of
+// the TLS connection instead of the basic auth password.
+type CertificateAuthenticator interface {
+	// IdentifyCertificate returns the identity of the certificate, whose Grant decides the permitted operations.
+	IdentifyCertificate(cert *x509.Certificate) (*Identity, error)
+}
+
+// ClientCertificate returns the client certificate of the request, if it was verified by the server.
+func ClientCertificate(req *http.Request) *x509.Certificate {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+
+	return req.TLS.VerifiedChains[0][0]
+}
+
+// HasCredentials returns whether the request has a basic auth header or a verified client certificate.
+func HasCredentials(req *http.Request) bool {
+	_, _, ok := req.BasicAuth()
+	return ok || ClientCertificate(req) != nil
+}
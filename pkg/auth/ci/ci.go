@@ -0,0 +1,170 @@
+// Package ci implements the authentication with the OIDC tokens of CI jobs, which is used by the gitlab and github
+// auth backends.
+package ci
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/jwt"
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// placeholder matches the claims in the project and state patterns of a rule (e.g. ${namespace_path})
+var placeholder = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// Authenticator verifies the OIDC token of a CI job and grants access to the states matched by its rules.
+type Authenticator struct {
+	name     string
+	verifier *jwt.Verifier
+	syntax   pattern.Syntax
+	rules    []rule
+}
+
+type rule struct {
+	config.CIRuleConfig
+	permissions []auth.Operation
+}
+
+// NewAuthenticator creates an authenticator for the tokens of the issuer configured by cfg, the signing keys are
+// refreshed every refreshInterval (see jwt.NewVerifier).
+func NewAuthenticator(name string, cfg config.CIAuthConfig, refreshInterval time.Duration) (*Authenticator, error) {
+	a := &Authenticator{
+		name:     name,
+		verifier: jwt.NewVerifier(cfg.IssuerURL, cfg.Audiences, refreshInterval),
+		syntax:   pattern.Syntax(cfg.Match),
+	}
+
+	for _, r := range cfg.Rules {
+		permissions, err := auth.ParseOperations(r.Permissions)
+		if err != nil {
+			return nil, fmt.Errorf("permissions of rule for project %s and state %s: %w", r.Project, r.State, err)
+		}
+
+		a.rules = append(a.rules, rule{CIRuleConfig: r, permissions: permissions})
+	}
+
+	return a, nil
+}
+
+func (a *Authenticator) GetName() string {
+	return a.name
+}
+
+// Authenticate checks whether a rule grants any operation on the state.
+func (a *Authenticator) Authenticate(secret string, s *terraform.State) (bool, error) {
+	identity, err := a.Identify(secret)
+	if err != nil {
+		return false, err
+	}
+
+	return identity.Grant(s, "")
+}
+
+// Identify returns the sub claim as subject and all claims of the token, the rules decide the granted operations.
+func (a *Authenticator) Identify(secret string) (*auth.Identity, error) {
+	claims, err := a.verifier.Verify(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+
+	return &auth.Identity{
+		Subject: subject,
+		Claims:  claims,
+		Grant: func(s *terraform.State, op auth.Operation) (bool, error) {
+			return a.authorize(claims, s, op)
+		},
+	}, nil
+}
+
+// authorize checks whether a rule grants the operation on the state to the claims.
+func (a *Authenticator) authorize(claims map[string]any, s *terraform.State, op auth.Operation) (bool, error) {
+	for _, rule := range a.rules {
+		if op != "" && !slices.Contains(rule.permissions, op) {
+			continue
+		}
+
+		ok, err := a.match(rule.CIRuleConfig, claims, s)
+		if err != nil {
+			return false, fmt.Errorf("evaluating rule for project %s and state %s: %w", rule.Project, rule.State, err)
+		} else if ok {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// match checks whether all claim patterns of the rule match and the state matches its project and state patterns.
+func (a *Authenticator) match(rule config.CIRuleConfig, claims map[string]any, s *terraform.State) (bool, error) {
+	for claim, p := range rule.Claims {
+		// the claim matches, if any of its values matches
+		values, _ := auth.ClaimValues(claims, claim)
+
+		if ok, err := matchAny(a.syntax, p, values); err != nil || !ok {
+			return false, err
+		}
+	}
+
+	project, ok := a.expand(rule.Project, claims)
+	if !ok {
+		return false, nil
+	}
+
+	state, ok := a.expand(rule.State, claims)
+	if !ok {
+		return false, nil
+	}
+
+	if ok, err := pattern.Match(a.syntax, project, s.Project); err != nil || !ok {
+		return false, err
+	}
+
+	return pattern.Match(a.syntax, state, s.Name)
+}
+
+// expand replaces the claims in the pattern by their values, so that they are matched literally. It returns false,
+// if a claim is missing or can't be matched literally.
+func (a *Authenticator) expand(p string, claims map[string]any) (string, bool) {
+	ok := true
+
+	expanded := placeholder.ReplaceAllStringFunc(p, func(m string) string {
+		// only claims with a single value can be expanded
+		values, _ := auth.ClaimValues(claims, placeholder.FindStringSubmatch(m)[1])
+		if len(values) != 1 {
+			ok = false
+			return m
+		}
+		value := values[0]
+
+		switch {
+		case a.syntax == pattern.Regex:
+			return regexp.QuoteMeta(value)
+		case strings.ContainsAny(value, "*?"):
+			// glob patterns can't escape wildcards
+			ok = false
+		}
+
+		return value
+	})
+
+	return expanded, ok
+}
+
+func matchAny(syntax pattern.Syntax, p string, values []string) (bool, error) {
+	for _, value := range values {
+		if ok, err := pattern.Match(syntax, p, value); err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
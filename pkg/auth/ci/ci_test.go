@@ -0,0 +1,222 @@
+package ci
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/jwt/jwttest"
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestAuthenticate(t *testing.T) {
+	issuer := jwttest.NewIssuer(t)
+
+	a, err := NewAuthenticator("gitlab", config.CIAuthConfig{
+		IssuerURL: issuer.URL,
+		Audiences: []string{"terraform-backend"},
+		Match:     "glob",
+		Rules: []config.CIRuleConfig{{
+			// only protected branches may change production states
+			Claims:  map[string]string{"project_path": "infra/*", "ref_protected": "true"},
+			Project: "${namespace_path}",
+			State:   "*",
+		}, {
+			Claims:      map[string]string{"project_path": "infra/*"},
+			Project:     "${namespace_path}",
+			State:       "*",
+			Permissions: []string{"read"},
+		}, {
+			Claims:  map[string]string{"project_path": "infra/*"},
+			Project: "${namespace_path}",
+			State:   "dev-*",
+		}},
+	}, time.Hour)
+	require.NoError(t, err)
+
+	jobToken := func(namespace, project string, protected bool) string {
+		return issuer.Token(t, map[string]any{
+			"aud":            "terraform-backend",
+			"namespace_path": namespace,
+			"project_path":   namespace + "/" + project,
+			"ref":            "main",
+			"ref_protected":  protected,
+		})
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		op      auth.Operation
+		project string
+		state   string
+		ok      bool
+		err     string
+	}{
+		{"protected branch", jobToken("infra", "network", true), auth.Write, "infra", "prod", true, ""},
+		{"unprotected branch", jobToken("infra", "network", false), auth.Write, "infra", "prod", false, ""},
+		{"unprotected branch read", jobToken("infra", "network", false), auth.Read, "infra", "prod", true, ""},
+		{"unprotected branch dev state", jobToken("infra", "network", false), auth.Write, "infra", "dev-1", true, ""},
+		{"other namespace project", jobToken("infra", "network", true), auth.Read, "apps", "prod", false, ""},
+		{"other namespace", jobToken("apps", "web", true), auth.Read, "apps", "prod", false, ""},
+		{"wildcard claim", jobToken("infra*", "network", true), auth.Read, "infra-x", "prod", false, ""},
+		{"invalid audience", issuer.Token(t, map[string]any{"aud": "other"}), auth.Read, "infra", "prod", false, "audience"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := &terraform.State{
+				ID:      terraform.GetStateID(test.project, test.state),
+				Project: test.project,
+				Name:    test.state,
+			}
+
+			ok, err := authorize(a, test.token, state, test.op)
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, test.ok, ok)
+		})
+	}
+}
+
+func TestAuthenticateRegex(t *testing.T) {
+	issuer := jwttest.NewIssuer(t)
+
+	a, err := NewAuthenticator("github", config.CIAuthConfig{
+		IssuerURL: issuer.URL,
+		Audiences: []string{"terraform-backend"},
+		Match:     "regex",
+		Rules: []config.CIRuleConfig{{
+			Claims:  map[string]string{"repository": "example/.+", "ref": "refs/heads/(main|release-.*)"},
+			Project: "${repository_owner}",
+			State:   "${environment}-(eu|us)",
+		}},
+	}, time.Hour)
+	require.NoError(t, err)
+
+	token := issuer.Token(t, map[string]any{
+		"aud":              "terraform-backend",
+		"repository":       "example/infra",
+		"repository_owner": "example",
+		"ref":              "refs/heads/release-1.2",
+		"environment":      "prod.1",
+	})
+
+	ok, err := a.Authenticate(token, &terraform.State{Project: "example", Name: "prod.1-eu"})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// claims are matched literally
+	ok, err = a.Authenticate(token, &terraform.State{Project: "example", Name: "prodx1-eu"})
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestMixedCaseClaims(t *testing.T) {
+	issuer := jwttest.NewIssuer(t)
+
+	// the keys of the claims are lower-cased, when the configuration is loaded
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+auth:
+  gitlab:
+    issuer_url: `+issuer.URL+`
+    audiences: [terraform-backend]
+    rules:
+      - claims: {namespacePath: infra}
+        project: "${namespacePath}"
+        state: "*"
+`), 0600))
+
+	cfg, err := config.Load(file)
+	require.NoError(t, err)
+
+	a, err := NewAuthenticator("gitlab", cfg.Auth.GitLab, time.Hour)
+	require.NoError(t, err)
+
+	token := issuer.Token(t, map[string]any{"aud": "terraform-backend", "namespacePath": "infra"})
+
+	ok, err := a.Authenticate(token, &terraform.State{Project: "infra", Name: "prod"})
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestExpand(t *testing.T) {
+	claims := map[string]any{"namespace_path": "infra", "environment": "prod.1", "branch": "feature-*", "groups": []any{"a", "b"}}
+
+	glob := &Authenticator{syntax: pattern.Glob}
+
+	expanded, ok := glob.expand("${namespace_path}/*", claims)
+	require.True(t, ok)
+	require.Equal(t, "infra/*", expanded)
+
+	// glob patterns can't match wildcards in claims literally
+	_, ok = glob.expand("${branch}", claims)
+	require.False(t, ok)
+
+	// missing claims and claims with several values can't be expanded
+	_, ok = glob.expand("${missing}", claims)
+	require.False(t, ok)
+	_, ok = glob.expand("${groups}", claims)
+	require.False(t, ok)
+
+	regex := &Authenticator{syntax: pattern.Regex}
+
+	// the claims are quoted in regular expressions
+	expanded, ok = regex.expand("${environment}-(eu|us)", claims)
+	require.True(t, ok)
+	require.Equal(t, `prod\.1-(eu|us)`, expanded)
+
+	expanded, ok = regex.expand("${branch}", claims)
+	require.True(t, ok)
+	require.Equal(t, `feature-\*`, expanded)
+}
+
+func TestAmbiguousClaims(t *testing.T) {
+	issuer := jwttest.NewIssuer(t)
+
+	a, err := NewAuthenticator("gitlab", config.CIAuthConfig{
+		IssuerURL: issuer.URL,
+		Audiences: []string{"terraform-backend"},
+		Match:     "glob",
+		Rules: []config.CIRuleConfig{{
+			Claims:  map[string]string{"namespacepath": "infra"},
+			Project: "infra",
+			State:   "*",
+		}},
+	}, time.Hour)
+	require.NoError(t, err)
+
+	// the rule doesn't match, since it's unclear which claim is meant
+	token := issuer.Token(t, map[string]any{"aud": "terraform-backend", "namespacePath": "infra", "NamespacePath": "other"})
+
+	ok, err := a.Authenticate(token, &terraform.State{Project: "infra", Name: "prod"})
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+func TestInvalidPermissions(t *testing.T) {
+	_, err := NewAuthenticator("gitlab", config.CIAuthConfig{
+		Rules: []config.CIRuleConfig{{Project: "*", State: "*", Permissions: []string{"admin"}}},
+	}, time.Hour)
+	require.ErrorContains(t, err, `unknown operation "admin"`)
+}
+
+// authorize verifies the token and checks the operation like auth.Authenticate.
+func authorize(a *Authenticator, token string, s *terraform.State, op auth.Operation) (bool, error) {
+	identity, err := a.Identify(token)
+	if err != nil {
+		return false, err
+	}
+
+	return identity.Authorize(s, op)
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ClaimValues returns the string or the list of strings at the path (separated by dots) of the claims. Booleans and
+// numbers are formatted as strings. A missing claim has no values. If a key of the path doesn't exist, it's looked up
+// case-insensitively, since the keys of claim maps in the configuration are lower-cased when they're loaded. A key
+// matching several keys of the claims case-insensitively is rejected, instead of picking one of them.
+func ClaimValues(claims map[string]any, path string) ([]string, error) {
+	var value any = claims
+
+	for _, key := range strings.Split(path, ".") {
+		m, ok := value.(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+
+		var err error
+		if value, err = claim(m, key); err != nil {
+			return nil, fmt.Errorf("claim %s: %w", path, err)
+		}
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return nil, nil
+	case []any:
+		values := make([]string, 0, len(v))
+
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("claim %s contains a non-string value", path)
+			}
+			values = append(values, str)
+		}
+
+		return values, nil
+	default:
+		str, ok := scalar(v)
+		if !ok {
+			return nil, fmt.Errorf("claim %s is neither a string nor a list of strings", path)
+		}
+
+		return []string{str}, nil
+	}
+}
+
+// claim returns the value of the key or, if it doesn't exist, of the only key which equals it case-insensitively.
+func claim(claims map[string]any, key string) (any, error) {
+	if value, ok := claims[key]; ok {
+		return value, nil
+	}
+
+	var (
+		found string
+		value any
+	)
+
+	for k, v := range claims {
+		if !strings.EqualFold(k, key) {
+			continue
+		}
+
+		if found != "" {
+			return nil, fmt.Errorf("key %s is ambiguous, it matches %s and %s", key, min(found, k), max(found, k))
+		}
+		found, value = k, v
+	}
+
+	return value, nil
+}
+
+// scalar formats strings, booleans and numbers as string.
+func scalar(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case bool:
+		return strconv.FormatBool(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case json.Number:
+		return v.String(), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,20 @@
+package github
+
+import (
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/ci"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// Name of the auth backend, which accepts GitHub Actions OIDC tokens.
+const Name = "github"
+
+func init() {
+	auth.Register(Name, func(cfg config.AuthConfig, _ config.ClientsConfig) (auth.Authenticator, error) {
+		if !cfg.GitHub.Enabled {
+			return nil, auth.ErrDisabled
+		}
+
+		return ci.NewAuthenticator(Name, cfg.GitHub, cfg.JWT.JWKSRefreshInterval)
+	})
+}
@@ -0,0 +1,20 @@
+package gitlab
+
+import (
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/ci"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// Name of the auth backend, which accepts GitLab CI ID tokens (id_tokens in .gitlab-ci.yml).
+const Name = "gitlab"
+
+func init() {
+	auth.Register(Name, func(cfg config.AuthConfig, _ config.ClientsConfig) (auth.Authenticator, error) {
+		if !cfg.GitLab.Enabled {
+			return nil, auth.ErrDisabled
+		}
+
+		return ci.NewAuthenticator(Name, cfg.GitLab, cfg.JWT.JWKSRefreshInterval)
+	})
+}
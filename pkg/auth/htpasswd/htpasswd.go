@@ -0,0 +1,213 @@
+// Package htpasswd implements the authentication of user accounts, whose bcrypt password hashes are stored in an
+// htpasswd file. The basic auth username is the name of the user, the projects of a user are configured separately.
+package htpasswd
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+const Name = "htpasswd"
+
+// dummyHash is compared with the passwords of unknown users, so that they can't be told apart by the response time
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("terraform-backend"), bcrypt.DefaultCost)
+	return hash
+})
+
+func init() {
+	auth.Register(Name, func(cfg config.AuthConfig, _ config.ClientsConfig) (auth.Authenticator, error) {
+		if !cfg.Htpasswd.Enabled {
+			return nil, auth.ErrDisabled
+		}
+
+		return NewHtpasswdAuth(cfg.Htpasswd)
+	})
+}
+
+type HtpasswdAuth struct {
+	file  string
+	users map[string]user
+
+	mu      sync.Mutex
+	hashes  map[string][]byte
+	modTime time.Time
+	size    int64
+}
+
+type user struct {
+	projects    []*regexp.Regexp
+	permissions []auth.Operation
+	groups      []string
+}
+
+// NewHtpasswdAuth creates the auth backend, the htpasswd file is read again when it's modified.
+func NewHtpasswdAuth(cfg config.HtpasswdAuthConfig) (*HtpasswdAuth, error) {
+	a := &HtpasswdAuth{
+		file:  cfg.File,
+		users: make(map[string]user, len(cfg.Users)),
+	}
+
+	for _, u := range cfg.Users {
+		compiled := user{groups: u.Groups}
+
+		for _, p := range u.Projects {
+			re, err := pattern.Compile(pattern.Glob, p)
+			if err != nil {
+				return nil, fmt.Errorf("projects of user %s: %w", u.Name, err)
+			}
+
+			compiled.projects = append(compiled.projects, re)
+		}
+
+		var err error
+		if compiled.permissions, err = auth.ParseOperations(u.Permissions); err != nil {
+			return nil, fmt.Errorf("permissions of user %s: %w", u.Name, err)
+		}
+
+		a.users[u.Name] = compiled
+	}
+
+	// fail on startup instead of the first request, if the file is missing or invalid
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *HtpasswdAuth) GetName() string {
+	return Name
+}
+
+// Authenticate rejects the credentials, the basic auth username has to be the name of the user.
+func (a *HtpasswdAuth) Authenticate(_ string, _ *terraform.State) (bool, error) {
+	return false, fmt.Errorf("htpasswd auth requires the name of the user as basic auth username")
+}
+
+// IdentifyUser checks the password and returns the user as subject and its configured groups. The projects and
+// permissions of the user decide the granted operations.
+func (a *HtpasswdAuth) IdentifyUser(username, password string) (*auth.Identity, error) {
+	if err := a.verify(username, password); err != nil {
+		return nil, err
+	}
+
+	u := a.users[username]
+
+	return &auth.Identity{
+		Subject: username,
+		Groups:  u.groups,
+		Grant: func(s *terraform.State, op auth.Operation) (bool, error) {
+			return u.authorize(s, op), nil
+		},
+	}, nil
+}
+
+// authorize checks whether the user may perform the operation on the project of the state.
+func (u user) authorize(s *terraform.State, op auth.Operation) bool {
+	if op != "" && !slices.Contains(u.permissions, op) {
+		return false
+	}
+
+	for _, project := range u.projects {
+		if project.MatchString(s.Project) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (a *HtpasswdAuth) verify(username, password string) error {
+	a.mu.Lock()
+	err := a.load()
+	hash, ok := a.hashes[username]
+	a.mu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		_ = bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return fmt.Errorf("invalid username or password")
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return fmt.Errorf("invalid username or password")
+	} else if err != nil {
+		return fmt.Errorf("verifying password of user %s: %w", username, err)
+	}
+
+	return nil
+}
+
+// load reads the htpasswd file, if it was modified since it was read the last time.
+func (a *HtpasswdAuth) load() error {
+	info, err := os.Stat(a.file)
+	if err != nil {
+		return fmt.Errorf("reading htpasswd file: %w", err)
+	}
+
+	if a.hashes != nil && info.ModTime().Equal(a.modTime) && info.Size() == a.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(a.file)
+	if err != nil {
+		return fmt.Errorf("reading htpasswd file: %w", err)
+	}
+
+	hashes, err := Parse(data)
+	if err != nil {
+		return fmt.Errorf("parsing htpasswd file %s: %w", a.file, err)
+	}
+
+	a.hashes, a.modTime, a.size = hashes, info.ModTime(), info.Size()
+
+	return nil
+}
+
+// Parse returns the password hashes by user of an htpasswd file. Only bcrypt hashes are supported.
+func Parse(data []byte) (map[string][]byte, error) {
+	hashes := make(map[string][]byte)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		username, hash, ok := strings.Cut(text, ":")
+		if !ok || username == "" {
+			return nil, fmt.Errorf("line %d: expected <user>:<hash>", line)
+		}
+
+		if !strings.HasPrefix(hash, "$2y$") && !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") {
+			return nil, fmt.Errorf("line %d: hash of user %s isn't a bcrypt hash (create it with htpasswd -B)", line, username)
+		}
+
+		hashes[username] = []byte(hash)
+	}
+
+	return hashes, scanner.Err()
+}
@@ -0,0 +1,113 @@
+package htpasswd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// writeHtpasswd writes an htpasswd file with the users and passwords, the hashes have the $2y$ prefix of htpasswd -B.
+func writeHtpasswd(t *testing.T, file string, passwords map[string]string) {
+	t.Helper()
+
+	var lines []string
+
+	for username, password := range passwords {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		require.NoError(t, err)
+
+		lines = append(lines, username+":$2y$"+strings.TrimPrefix(string(hash), "$2a$"))
+	}
+
+	require.NoError(t, os.WriteFile(file, []byte(strings.Join(lines, "\n")+"\n"), 0600))
+}
+
+func TestIdentifyUser(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "htpasswd")
+	writeHtpasswd(t, file, map[string]string{"alice": "secret1", "bob": "secret2", "carol": "secret3"})
+
+	a, err := NewHtpasswdAuth(config.HtpasswdAuthConfig{
+		File: file,
+		Users: []config.HtpasswdUserConfig{
+			{Name: "alice", Projects: []string{"infra", "dev-*"}},
+			{Name: "bob", Projects: []string{"*"}, Permissions: []string{"read"}, Groups: []string{"devs"}},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		op       auth.Operation
+		project  string
+		ok       bool
+		err      string
+	}{
+		{"allowed project", "alice", "secret1", auth.Write, "infra", true, ""},
+		{"allowed pattern", "alice", "secret1", auth.Delete, "dev-alice", true, ""},
+		{"other project", "alice", "secret1", auth.Read, "apps", false, ""},
+		{"wrong password", "alice", "secret2", auth.Read, "infra", false, "invalid username or password"},
+		{"unknown user", "dave", "secret1", auth.Read, "infra", false, "invalid username or password"},
+		{"read-only user reads", "bob", "secret2", auth.Read, "apps", true, ""},
+		{"read-only user writes", "bob", "secret2", auth.Write, "apps", false, ""},
+		{"user without projects", "carol", "secret3", auth.Read, "infra", false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := authorizeUser(a, tt.username, tt.password, &terraform.State{Project: tt.project, Name: "prod"}, tt.op)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.ok, ok)
+		})
+	}
+
+	identity, err := a.IdentifyUser("bob", "secret2")
+	require.NoError(t, err)
+	require.Equal(t, "bob", identity.Subject)
+	require.Equal(t, []string{"devs"}, identity.Groups)
+
+	// changed passwords are picked up without a restart
+	writeHtpasswd(t, file, map[string]string{"alice": "changed"})
+
+	_, err = authorizeUser(a, "alice", "secret1", &terraform.State{Project: "infra", Name: "prod"}, auth.Read)
+	require.Error(t, err)
+
+	ok, err := authorizeUser(a, "alice", "changed", &terraform.State{Project: "infra", Name: "prod"}, auth.Read)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestParse(t *testing.T) {
+	hashes, err := Parse([]byte("# comment\n\nalice:$2y$05$abc\n"))
+	require.NoError(t, err)
+	require.Equal(t, map[string][]byte{"alice": []byte("$2y$05$abc")}, hashes)
+
+	_, err = Parse([]byte("alice:$apr1$salt$hash\n"))
+	require.ErrorContains(t, err, "line 1: hash of user alice isn't a bcrypt hash")
+
+	_, err = Parse([]byte("alice\n"))
+	require.ErrorContains(t, err, "line 1: expected <user>:<hash>")
+}
+
+// authorizeUser checks the password and the operation like auth.Authenticate.
+func authorizeUser(a *HtpasswdAuth, username, password string, s *terraform.State, op auth.Operation) (bool, error) {
+	identity, err := a.IdentifyUser(username, password)
+	if err != nil {
+		return false, err
+	}
+
+	return identity.Authorize(s, op)
+}
@@ -0,0 +1,126 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// Identity describes who the credentials of a request belong to, it's used to evaluate policies.
+type Identity struct {
+	// Backend is the name of the auth backend, which authenticated the request
+	Backend string
+	// Subject identifies the user or service (e.g. the sub claim of a token), it's empty if it's unknown
+	Subject string
+	Groups  []string
+	// Claims contains further attributes (e.g. all claims of a token)
+	Claims map[string]any
+	// Grant decides which operations the verified credentials permit, it's set by the auth backend
+	Grant Grant
+}
+
+// Grant checks whether verified credentials permit the operation on the state. It must not verify the credentials
+// again, since it's called for every state a request accesses (e.g. by the listing). An empty operation checks
+// whether any operation is permitted.
+type Grant func(s *terraform.State, op Operation) (bool, error)
+
+// Identifier is implemented by auth backends, which know the identity of the credentials.
+type Identifier interface {
+	// Identify verifies the credentials and returns their identity. If the identity has no Grant, the credentials are
+	// checked by Authorizer or Authenticator for every state.
+	Identify(secret string) (*Identity, error)
+}
+
+// Authorize checks whether the identity permits the operation on the state.
+func (i *Identity) Authorize(s *terraform.State, op Operation) (bool, error) {
+	if i.Grant == nil {
+		return false, nil
+	}
+
+	ok, err := i.Grant(s, op)
+	if ok {
+		s.Metadata.AuthMethod = i.Backend
+	}
+
+	return ok, err
+}
+
+// Authenticate verifies the credentials of the request with the auth backend selected by them and returns their
+// identity, which authorizes the operations on states. The credentials are verified once, so that a request can
+// access several states without contacting the auth backend again.
+func Authenticate(req *http.Request) (*Identity, error) {
+	c, err := getCredentials(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var identity *Identity
+
+	switch {
+	case c.cert != nil:
+		identity, err = c.authenticator.(CertificateAuthenticator).IdentifyCertificate(c.cert)
+	case c.username != "":
+		identity, err = identifyUser(c)
+	default:
+		if identifier, ok := c.authenticator.(Identifier); ok {
+			identity, err = identifier.Identify(c.secret)
+		} else {
+			identity = &Identity{}
+		}
+
+		if err == nil && identity.Grant == nil {
+			identity.Grant = secretGrant(c.authenticator, c.secret)
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	identity.Backend = c.authenticator.GetName()
+
+	return identity, nil
+}
+
+// identifyUser tries the user backends in order, the first one accepting the username and password is the
+// authenticator of the credentials. If none accepts them, the errors of all backends are returned, they must only be
+// logged, since they reveal the configured backends and their reasons.
+func identifyUser(c *credentials) (*Identity, error) {
+	var errs []error
+
+	for _, a := range c.users {
+		identity, err := a.(UserAuthenticator).IdentifyUser(c.username, c.secret)
+		if err == nil {
+			c.authenticator = a
+			return identity, nil
+		}
+
+		errs = append(errs, fmt.Errorf("%s: %w", a.GetName(), err))
+	}
+
+	return nil, errors.Join(errs...)
+}
+
+// secretGrant checks the secret with the auth backend for every state.
+func secretGrant(a Authenticator, secret string) Grant {
+	return func(s *terraform.State, op Operation) (bool, error) {
+		if authorizer, ok := a.(Authorizer); ok && op != "" {
+			return authorizer.Authorize(secret, s, op)
+		}
+
+		return a.Authenticate(secret, s)
+	}
+}
+
+// Method returns the name of the auth backend selected by the credentials of the request without authenticating them.
+// It's empty if the request has no usable credentials.
+func Method(req *http.Request) string {
+	c, err := getCredentials(req)
+	if err != nil {
+		return ""
+	}
+
+	return c.authenticator.GetName()
+}
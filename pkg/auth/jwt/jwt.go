@@ -1,59 +1,206 @@
 package jwt
 
 import (
-	"context"
-
-	"github.com/coreos/go-oidc/v3/oidc"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
 const Name = "jwt"
 
+func init() {
+	auth.Register(Name, func(cfg config.AuthConfig, _ config.ClientsConfig) (auth.Authenticator, error) {
+		issuers := cfg.JWT.TrustedIssuers()
+
+		// JWT auth is only enabled, if an issuer is configured to verify the tokens
+		if len(issuers) == 0 {
+			return nil, auth.ErrDisabled
+		}
+
+		return NewJWTAuth(issuers, cfg.JWT.JWKSRefreshInterval), nil
+	})
+}
+
+// JWTAuth verifies tokens signed by one of the trusted OIDC issuers. The project and state claims of a token
+// contain patterns of the states, which can be accessed with it.
 type JWTAuth struct {
-	issuerURL string
+	issuers map[string]*issuer
+}
+
+type issuer struct {
+	cfg      config.JWTIssuerConfig
+	verifier *Verifier
 }
 
-func NewJWTAuth(issuerURL string) *JWTAuth {
-	return &JWTAuth{
-		issuerURL: issuerURL,
+// NewJWTAuth creates a JWT auth backend for the issuers, the signing keys are refreshed every refreshInterval
+// (see NewVerifier).
+func NewJWTAuth(issuers []config.JWTIssuerConfig, refreshInterval time.Duration) *JWTAuth {
+	j := &JWTAuth{
+		issuers: make(map[string]*issuer),
 	}
+
+	for _, cfg := range issuers {
+		j.issuers[cfg.URL] = &issuer{
+			cfg:      cfg,
+			verifier: NewVerifier(cfg.URL, cfg.Audiences, refreshInterval),
+		}
+	}
+
+	return j
 }
 
 func (j *JWTAuth) GetName() string {
 	return Name
 }
 
+// Authenticate checks whether the token grants any operation on the state.
 func (j *JWTAuth) Authenticate(secret string, s *terraform.State) (bool, error) {
-	provider, err := oidc.NewProvider(context.Background(), j.issuerURL)
+	identity, err := j.Identify(secret)
 	if err != nil {
 		return false, err
 	}
 
-	verifier := provider.Verifier(&oidc.Config{
-		SkipClientIDCheck: true,
-	})
+	return identity.Grant(s, "")
+}
+
+// Identify returns the sub claim as subject and the groups claim as groups of the identity. The project, state and
+// permissions claims of the token decide the granted operations, all operations are granted if the token doesn't
+// contain the permissions claim.
+func (j *JWTAuth) Identify(secret string) (*auth.Identity, error) {
+	i, claims, err := j.verify(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	groups, err := auth.ClaimValues(claims, i.cfg.GroupsClaim)
+	if err != nil {
+		return nil, err
+	}
+
+	subject, _ := claims["sub"].(string)
+
+	return &auth.Identity{
+		Subject: subject,
+		Groups:  groups,
+		Claims:  claims,
+		Grant: func(s *terraform.State, op auth.Operation) (bool, error) {
+			ok, err := i.authorize(claims, s, op)
+			if err != nil {
+				verificationFailures.WithLabelValues(i.cfg.URL, "invalid_claims").Inc()
+			}
+
+			return ok, err
+		},
+	}, nil
+}
+
+// verify selects the issuer of the token and verifies it.
+func (j *JWTAuth) verify(secret string) (*issuer, map[string]any, error) {
+	iss, err := unverifiedIssuer(secret)
+	if err != nil {
+		verificationFailures.WithLabelValues("", "invalid_token").Inc()
+		return nil, nil, err
+	}
+
+	i, ok := j.issuers[iss]
+	if !ok {
+		// the issuer isn't used as label, since it's set by the client
+		verificationFailures.WithLabelValues("", "untrusted_issuer").Inc()
+		return nil, nil, fmt.Errorf("issuer %s is not trusted", iss)
+	}
+
+	claims, err := i.verifier.Verify(secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return i, claims, nil
+}
+
+// authorize checks whether one of the project patterns matches the project, one of the state patterns matches
+// the name of the state and the operation is permitted (unless op is empty).
+func (i *issuer) authorize(claims map[string]any, s *terraform.State, op auth.Operation) (bool, error) {
+	if op != "" {
+		names, err := auth.ClaimValues(claims, i.cfg.PermissionsClaim)
+		if err != nil {
+			return false, err
+		}
+
+		permitted, err := auth.ParseOperations(names)
+		if err != nil {
+			return false, fmt.Errorf("claim %s: %w", i.cfg.PermissionsClaim, err)
+		}
+
+		if !slices.Contains(permitted, op) {
+			return false, nil
+		}
+	}
 
-	token, err := verifier.Verify(context.Background(), secret)
+	syntax := pattern.Syntax(i.cfg.Match)
+
+	projects, err := auth.ClaimValues(claims, i.cfg.ProjectClaim)
 	if err != nil {
 		return false, err
 	}
 
-	var claims struct {
-		TerraformBackend struct {
-			Project string `json:"project"`
-			State   string `json:"state"`
-		} `json:"terraform-backend"`
+	states, err := auth.ClaimValues(claims, i.cfg.StateClaim)
+	if err != nil {
+		return false, err
 	}
-	if err := token.Claims(&claims); err != nil {
+
+	projectMatch, err := matchAny(syntax, projects, s.Project)
+	if err != nil || !projectMatch {
 		return false, err
 	}
 
-	if s.Project == claims.TerraformBackend.Project && claims.TerraformBackend.State == "*" {
-		return true, nil
-	} else if s.Project == claims.TerraformBackend.Project && s.Name == claims.TerraformBackend.State {
+	// a state claim of * grants all states of the project, like before the pattern syntax was configurable
+	if syntax == pattern.Exact && slices.Contains(states, "*") {
 		return true, nil
 	}
 
+	return matchAny(syntax, states, s.Name)
+}
+
+func matchAny(syntax pattern.Syntax, patterns []string, name string) (bool, error) {
+	for _, p := range patterns {
+		ok, err := pattern.Match(syntax, p, name)
+		if err != nil {
+			return false, err
+		} else if ok {
+			return true, nil
+		}
+	}
+
 	return false, nil
 }
+
+// unverifiedIssuer returns the iss claim of the token without verifying it, so that the issuer to verify it with
+// can be chosen.
+func unverifiedIssuer(token string) (string, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return "", fmt.Errorf("malformed jwt: expected 3 parts, got %d", len(parts))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("malformed jwt payload: %w", err)
+	}
+
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return "", fmt.Errorf("malformed jwt payload: %w", err)
+	}
+
+	return claims.Issuer, nil
+}
@@ -1,12 +1,17 @@
 package jwt
 
 import (
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/hashicorp/vault/api"
 	"github.com/stretchr/testify/require"
 
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/jwt/jwttest"
 	"github.com/nimbolus/terraform-backend/pkg/client/vault/vaulttest"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
@@ -24,7 +29,7 @@ func TestAuth(t *testing.T) {
 	token, err := v.Logical().Read("identity/oidc/token/terraform-backend-sample")
 	require.NoError(t, err)
 
-	a := NewJWTAuth("http://localhost:8200/v1/identity/oidc")
+	a := newTestAuth("http://localhost:8200/v1/identity/oidc")
 
 	t.Run("success", func(t *testing.T) {
 		state := &terraform.State{
@@ -62,3 +67,223 @@ func TestAuth(t *testing.T) {
 		require.True(t, ok)
 	})
 }
+
+// newTestAuth returns a JWT auth backend for the issuers with the default configuration.
+func newTestAuth(issuerURLs ...string) *JWTAuth {
+	cfg := config.Default().Auth.JWT
+
+	for _, url := range issuerURLs {
+		cfg.Issuers = append(cfg.Issuers, config.JWTIssuerConfig{URL: url})
+	}
+
+	return NewJWTAuth(cfg.TrustedIssuers(), time.Hour)
+}
+
+// token returns a token of the issuer with the terraform-backend claim.
+func token(t *testing.T, i *jwttest.Issuer, project, state string) string {
+	return i.Token(t, map[string]any{
+		"terraform-backend": map[string]string{
+			"project": project,
+			"state":   state,
+		},
+	})
+}
+
+func TestCache(t *testing.T) {
+	issuer := jwttest.NewIssuer(t)
+	a := newTestAuth(issuer.URL)
+
+	state := &terraform.State{
+		ID:      terraform.GetStateID("sample", "prod"),
+		Project: "sample",
+		Name:    "prod",
+	}
+
+	for range 10 {
+		ok, err := a.Authenticate(token(t, issuer, "sample", "prod"), state)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	require.Equal(t, int32(1), issuer.DiscoveryCount.Load())
+	require.Equal(t, int32(1), issuer.KeysCount.Load())
+
+	// a rotated key is fetched once, even if the keys were fetched recently
+	issuer.RotateKey(t, "key2")
+
+	keys := a.issuers[issuer.URL].verifier.keys
+	keys.mu.Lock()
+	keys.fetchedAt = time.Now().Add(-minRefreshInterval)
+	keys.mu.Unlock()
+
+	for range 10 {
+		ok, err := a.Authenticate(token(t, issuer, "sample", "prod"), state)
+		require.NoError(t, err)
+		require.True(t, ok)
+	}
+
+	require.Equal(t, int32(1), issuer.DiscoveryCount.Load())
+	require.Equal(t, int32(2), issuer.KeysCount.Load())
+
+	// tokens signed by unknown keys don't trigger a fetch within minRefreshInterval
+	_, err := a.Authenticate(issuer.Token(t, map[string]any{}, "unknown"), state)
+	require.Error(t, err)
+	require.Equal(t, int32(2), issuer.KeysCount.Load())
+}
+
+func TestConcurrentDiscovery(t *testing.T) {
+	issuer := jwttest.NewIssuer(t)
+
+	cfg := config.Default().Auth.JWT
+	cfg.OIDCIssuerURL = issuer.URL
+	// a non-positive interval must not make the background refresh spin
+	a := NewJWTAuth(cfg.TrustedIssuers(), 0)
+
+	state := &terraform.State{
+		ID:      terraform.GetStateID("sample", "prod"),
+		Project: "sample",
+		Name:    "prod",
+	}
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ok, err := a.Authenticate(token(t, issuer, "sample", "prod"), state)
+			require.NoError(t, err)
+			require.True(t, ok)
+		}()
+	}
+	wg.Wait()
+
+	time.Sleep(100 * time.Millisecond)
+
+	require.Equal(t, int32(1), issuer.DiscoveryCount.Load())
+	require.Equal(t, int32(1), issuer.KeysCount.Load())
+}
+
+func TestClaimMapping(t *testing.T) {
+	gitlab := jwttest.NewIssuer(t)
+	keycloak := jwttest.NewIssuer(t)
+	vault := jwttest.NewIssuer(t)
+	untrusted := jwttest.NewIssuer(t)
+
+	cfg := config.Default().Auth.JWT
+	cfg.OIDCIssuerURL = gitlab.URL
+	cfg.Match = "glob"
+	cfg.Issuers = []config.JWTIssuerConfig{{
+		URL:   vault.URL,
+		Match: "exact",
+	}, {
+		URL:          keycloak.URL,
+		Audiences:    []string{"terraform-backend"},
+		ProjectClaim: "groups",
+		StateClaim:   "resource_access.terraform.states",
+		Match:        "regex",
+	}}
+	a := NewJWTAuth(cfg.TrustedIssuers(), time.Hour)
+
+	state := &terraform.State{
+		ID:      terraform.GetStateID("team-a", "prod-eu"),
+		Project: "team-a",
+		Name:    "prod-eu",
+	}
+
+	keycloakClaims := func(aud string, states ...string) map[string]any {
+		return map[string]any{
+			"aud":    aud,
+			"groups": []string{"team-b", "team-a"},
+			"resource_access": map[string]any{
+				"terraform": map[string]any{"states": states},
+			},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		ok    bool
+		err   string
+	}{
+		{"glob", token(t, gitlab, "team-a", "prod-*"), true, ""},
+		{"glob mismatch", token(t, gitlab, "team-a", "dev-*"), false, ""},
+		{"project mismatch", token(t, gitlab, "team-*-x", "*"), false, ""},
+		{"exact", token(t, vault, "team-a", "prod-eu"), true, ""},
+		{"exact all states", token(t, vault, "team-a", "*"), true, ""},
+		{"exact pattern", token(t, vault, "team-a", "prod-*"), false, ""},
+		{"exact all projects", token(t, vault, "*", "*"), false, ""},
+		{"regex", keycloak.Token(t, keycloakClaims("terraform-backend", "dev", "prod-(eu|us)")), true, ""},
+		{"regex mismatch", keycloak.Token(t, keycloakClaims("terraform-backend", "prod")), false, ""},
+		{"missing claim", keycloak.Token(t, map[string]any{"aud": "terraform-backend"}), false, ""},
+		{"invalid audience", keycloak.Token(t, keycloakClaims("other", "prod-eu")), false, "audience"},
+		{"untrusted issuer", token(t, untrusted, "team-a", "*"), false, "is not trusted"},
+		{"malformed", "not-a-token", false, "malformed jwt"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ok, err := a.Authenticate(test.token, state)
+			if test.err != "" {
+				require.ErrorContains(t, err, test.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, test.ok, ok)
+		})
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	issuer := jwttest.NewIssuer(t)
+	a := newTestAuth(issuer.URL)
+
+	state := &terraform.State{
+		ID:      terraform.GetStateID("team-a", "prod"),
+		Project: "team-a",
+		Name:    "prod",
+	}
+
+	tokenWithPermissions := func(permissions ...string) string {
+		return issuer.Token(t, map[string]any{
+			"terraform-backend": map[string]any{
+				"project":     "team-a",
+				"state":       "prod",
+				"permissions": permissions,
+			},
+		})
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		op    auth.Operation
+		ok    bool
+	}{
+		{"no permissions claim", token(t, issuer, "team-a", "prod"), auth.Delete, true},
+		{"read-only read", tokenWithPermissions("read"), auth.Read, true},
+		{"read-only lock", tokenWithPermissions("read"), auth.Lock, false},
+		{"read-only write", tokenWithPermissions("read"), auth.Write, false},
+		{"read-write write", tokenWithPermissions("read", "lock", "write"), auth.Write, true},
+		{"read-write delete", tokenWithPermissions("read", "lock", "write"), auth.Delete, false},
+		{"all", tokenWithPermissions("*"), auth.Delete, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := a.Identify(test.token)
+			require.NoError(t, err)
+
+			ok, err := identity.Authorize(state, test.op)
+			require.NoError(t, err)
+			require.Equal(t, test.ok, ok)
+		})
+	}
+
+	identity, err := a.Identify(tokenWithPermissions("admin"))
+	require.NoError(t, err)
+
+	_, err = identity.Authorize(state, auth.Read)
+	require.ErrorContains(t, err, `unknown operation "admin"`)
+}
@@ -0,0 +1,111 @@
+package jwttest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// Issuer is an OIDC issuer for tests, which counts the requests of the discovery document and the keys.
+type Issuer struct {
+	*httptest.Server
+	DiscoveryCount atomic.Int32
+	KeysCount      atomic.Int32
+
+	mu    sync.Mutex
+	key   *rsa.PrivateKey
+	keyID string
+}
+
+func NewIssuer(t testing.TB) *Issuer {
+	t.Helper()
+
+	i := &Issuer{}
+	i.RotateKey(t, "key1")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		i.DiscoveryCount.Add(1)
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"issuer":                                i.URL,
+			"jwks_uri":                              i.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		i.KeysCount.Add(1)
+
+		i.mu.Lock()
+		defer i.mu.Unlock()
+
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: i.key.Public(), KeyID: i.keyID, Algorithm: string(jose.RS256), Use: "sig"},
+		}})
+	})
+
+	i.Server = httptest.NewServer(mux)
+	t.Cleanup(i.Close)
+
+	return i
+}
+
+// RotateKey replaces the signing key by a new key with the given ID.
+func (i *Issuer) RotateKey(t testing.TB, keyID string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.key, i.keyID = key, keyID
+}
+
+// Token returns a token with the claims, which is valid for an hour. The key ID of the header can be changed to
+// sign a token with an unknown key.
+func (i *Issuer) Token(t testing.TB, claims map[string]any, keyID ...string) string {
+	t.Helper()
+
+	i.mu.Lock()
+	key, kid := i.key, i.keyID
+	i.mu.Unlock()
+
+	if len(keyID) > 0 {
+		kid = keyID[0]
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithHeader("kid", kid))
+	require.NoError(t, err)
+
+	all := map[string]any{
+		"iss": i.URL,
+		"sub": "test",
+		"exp": time.Now().Add(time.Hour).Unix(),
+		"iat": time.Now().Unix(),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+
+	payload, err := json.Marshal(all)
+	require.NoError(t, err)
+
+	jws, err := signer.Sign(payload)
+	require.NoError(t, err)
+
+	token, err := jws.CompactSerialize()
+	require.NoError(t, err)
+
+	return token
+}
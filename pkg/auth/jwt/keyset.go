@@ -0,0 +1,167 @@
+package jwt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// minRefreshInterval limits how often the keys are fetched for tokens signed by an unknown key.
+	minRefreshInterval = 10 * time.Second
+	// defaultRefreshInterval is used for the background refresh, if the configured interval isn't positive.
+	defaultRefreshInterval = 15 * time.Minute
+)
+
+var supportedAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.EdDSA,
+}
+
+// keySet caches the JSON Web Key Set of an issuer. The keys are refreshed in the background and if a token is
+// signed by an unknown key (e.g. after a key rotation).
+type keySet struct {
+	issuerURL string
+	jwksURL   string
+	client    *http.Client
+
+	mu        sync.RWMutex
+	keys      []jose.JSONWebKey
+	fetchedAt time.Time
+
+	// fetchMu makes concurrent requests wait for a single fetch
+	fetchMu sync.Mutex
+}
+
+func newKeySet(issuerURL, jwksURL string) *keySet {
+	return &keySet{
+		issuerURL: issuerURL,
+		jwksURL:   jwksURL,
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// refreshEvery fetches the keys every interval (defaultRefreshInterval, if it isn't positive) in the background.
+// The cached keys are kept, if a fetch fails. The first fetch is done by the first verification.
+func (k *keySet) refreshEvery(interval time.Duration) {
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			if _, err := k.refresh(context.Background(), true, time.Time{}); err != nil {
+				log.WithError(err).WithField("component", "jwt").Warnf("refreshing signing keys of %s", k.issuerURL)
+			}
+		}
+	}()
+}
+
+// VerifySignature implements oidc.KeySet.
+func (k *keySet) VerifySignature(ctx context.Context, jwt string) ([]byte, error) {
+	jws, err := jose.ParseSigned(jwt, supportedAlgorithms)
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt: %w", err)
+	}
+
+	k.mu.RLock()
+	keys, fetchedAt := k.keys, k.fetchedAt
+	k.mu.RUnlock()
+
+	if payload, err := verify(jws, keys); err == nil {
+		return payload, nil
+	}
+
+	// the token may be signed by a new key, which isn't cached yet
+	keys, err = k.refresh(ctx, false, fetchedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return verify(jws, keys)
+}
+
+// refresh fetches the keys. Unless force is set, the cached keys are returned, if they were fetched after the given
+// time by another request or less than minRefreshInterval ago.
+func (k *keySet) refresh(ctx context.Context, force bool, after time.Time) ([]jose.JSONWebKey, error) {
+	k.fetchMu.Lock()
+	defer k.fetchMu.Unlock()
+
+	k.mu.RLock()
+	keys, fetchedAt := k.keys, k.fetchedAt
+	k.mu.RUnlock()
+
+	if !force && (fetchedAt.After(after) || time.Since(fetchedAt) < minRefreshInterval) {
+		return keys, nil
+	}
+
+	keys, err := k.fetch(ctx)
+	jwksRefreshes.WithLabelValues(k.issuerURL, result(err)).Inc()
+	if err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.keys, k.fetchedAt = keys, time.Now()
+	k.mu.Unlock()
+
+	return keys, nil
+}
+
+func (k *keySet) fetch(ctx context.Context) ([]jose.JSONWebKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, k.jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := k.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keys from %s: %w", k.jwksURL, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching keys from %s: unexpected status %s", k.jwksURL, res.Status)
+	}
+
+	var set jose.JSONWebKeySet
+	if err := json.NewDecoder(res.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decoding keys from %s: %w", k.jwksURL, err)
+	}
+
+	return set.Keys, nil
+}
+
+// verify checks the signature with the key matching the key ID of the token.
+func verify(jws *jose.JSONWebSignature, keys []jose.JSONWebKey) ([]byte, error) {
+	keyID := jws.Signatures[0].Header.KeyID
+
+	for _, key := range keys {
+		if keyID == "" || key.KeyID == keyID {
+			if payload, err := jws.Verify(&key); err == nil {
+				return payload, nil
+			}
+		}
+	}
+
+	return nil, errors.New("failed to verify signature: no matching key found")
+}
+
+func result(err error) string {
+	if err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
@@ -0,0 +1,27 @@
+package jwt
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	verificationDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "tfbackend",
+		Subsystem: "jwt",
+		Name:      "verification_duration_seconds",
+		Help:      "The duration of token verifications",
+	}, []string{"issuer"})
+	verificationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tfbackend",
+		Subsystem: "jwt",
+		Name:      "verification_failures_total",
+		Help:      "The total number of failed token verifications by reason (e.g. invalid_token, invalid_audience)",
+	}, []string{"issuer", "reason"})
+	jwksRefreshes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "tfbackend",
+		Subsystem: "jwt",
+		Name:      "jwks_refreshes_total",
+		Help:      "The total number of fetches of the signing keys by result",
+	}, []string{"issuer", "result"})
+)
@@ -0,0 +1,145 @@
+package jwt
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/sync/singleflight"
+)
+
+// Verifier verifies the tokens of an OIDC issuer. The discovery of the issuer is done once and its signing keys
+// are cached, so that the issuer isn't requested for every request. It's used by other auth backends, which
+// accept OIDC tokens (e.g. of CI jobs).
+type Verifier struct {
+	issuerURL       string
+	audiences       []string
+	refreshInterval time.Duration
+
+	mu       sync.Mutex
+	verifier *oidc.IDTokenVerifier
+	keys     *keySet
+
+	// discovery makes concurrent requests wait for a single discovery, which is done without holding mu
+	discovery singleflight.Group
+}
+
+// NewVerifier creates a verifier for tokens of the issuer, which are issued for one of the audiences (the audience
+// isn't checked, if audiences is empty). The discovery is done by the first verification (and retried until it
+// succeeds), afterwards the signing keys are refreshed every refreshInterval in the background.
+func NewVerifier(issuerURL string, audiences []string, refreshInterval time.Duration) *Verifier {
+	return &Verifier{
+		issuerURL:       issuerURL,
+		audiences:       audiences,
+		refreshInterval: refreshInterval,
+	}
+}
+
+// Verify checks the signature, expiry, issuer and audience of the token and returns its claims.
+func (v *Verifier) Verify(token string) (map[string]any, error) {
+	start := time.Now()
+	defer func() {
+		verificationDuration.WithLabelValues(v.issuerURL).Observe(time.Since(start).Seconds())
+	}()
+
+	verifier, err := v.getVerifier()
+	if err != nil {
+		verificationFailures.WithLabelValues(v.issuerURL, "discovery").Inc()
+		return nil, err
+	}
+
+	idToken, err := verifier.Verify(context.Background(), token)
+	if err != nil {
+		verificationFailures.WithLabelValues(v.issuerURL, "invalid_token").Inc()
+		return nil, err
+	}
+
+	if !v.verifyAudience(idToken.Audience) {
+		verificationFailures.WithLabelValues(v.issuerURL, "invalid_audience").Inc()
+		return nil, fmt.Errorf("token audience %v is not accepted", idToken.Audience)
+	}
+
+	var claims map[string]any
+	if err := idToken.Claims(&claims); err != nil {
+		verificationFailures.WithLabelValues(v.issuerURL, "invalid_claims").Inc()
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// verifyAudience checks whether the token is issued for one of the accepted audiences (if any are configured).
+func (v *Verifier) verifyAudience(audience []string) bool {
+	if len(v.audiences) == 0 {
+		return true
+	}
+
+	for _, aud := range audience {
+		if slices.Contains(v.audiences, aud) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getVerifier returns the verifier of the issuer, the discovery is done by the first call.
+func (v *Verifier) getVerifier() (*oidc.IDTokenVerifier, error) {
+	v.mu.Lock()
+	verifier := v.verifier
+	v.mu.Unlock()
+
+	if verifier != nil {
+		return verifier, nil
+	}
+
+	res, err, _ := v.discovery.Do(v.issuerURL, func() (any, error) {
+		return v.discover()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.(*oidc.IDTokenVerifier), nil
+}
+
+// discover requests the metadata of the issuer and creates the verifier.
+func (v *Verifier) discover() (*oidc.IDTokenVerifier, error) {
+	v.mu.Lock()
+	verifier := v.verifier
+	v.mu.Unlock()
+
+	// another request may have finished the discovery in the meantime
+	if verifier != nil {
+		return verifier, nil
+	}
+
+	provider, err := oidc.NewProvider(context.Background(), v.issuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("discovering OIDC issuer %s: %w", v.issuerURL, err)
+	}
+
+	var metadata struct {
+		JWKSURL string `json:"jwks_uri"`
+	}
+	if err := provider.Claims(&metadata); err != nil {
+		return nil, fmt.Errorf("reading metadata of OIDC issuer %s: %w", v.issuerURL, err)
+	}
+
+	keys := newKeySet(v.issuerURL, metadata.JWKSURL)
+	keys.refreshEvery(v.refreshInterval)
+
+	verifier = oidc.NewVerifier(v.issuerURL, keys, &oidc.Config{
+		// the audience is checked by verifyAudience, since oidc.Config only accepts a single client ID
+		SkipClientIDCheck: true,
+	})
+
+	v.mu.Lock()
+	v.verifier, v.keys = verifier, keys
+	v.mu.Unlock()
+
+	return verifier, nil
+}
@@ -0,0 +1,176 @@
+// Package ldap implements the authentication of directory accounts. The users bind with their basic auth username and
+// password, their groups are mapped to the projects they can access.
+package ldap
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+const Name = "ldap"
+
+func init() {
+	auth.Register(Name, func(cfg config.AuthConfig, _ config.ClientsConfig) (auth.Authenticator, error) {
+		if !cfg.LDAP.Enabled {
+			return nil, auth.ErrDisabled
+		}
+
+		return NewLDAPAuth(cfg.LDAP)
+	})
+}
+
+type LDAPAuth struct {
+	cfg    config.LDAPAuthConfig
+	groups []group
+}
+
+type group struct {
+	name        string
+	projects    []*regexp.Regexp
+	permissions []auth.Operation
+}
+
+// user is an authenticated directory account.
+type user struct {
+	dn     string
+	groups []string
+}
+
+func NewLDAPAuth(cfg config.LDAPAuthConfig) (*LDAPAuth, error) {
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+
+	a := &LDAPAuth{cfg: cfg}
+
+	for _, g := range cfg.Groups {
+		compiled := group{name: g.Name}
+
+		for _, p := range g.Projects {
+			re, err := pattern.Compile(pattern.Glob, p)
+			if err != nil {
+				return nil, fmt.Errorf("projects of group %s: %w", g.Name, err)
+			}
+
+			compiled.projects = append(compiled.projects, re)
+		}
+
+		var err error
+		if compiled.permissions, err = auth.ParseOperations(g.Permissions); err != nil {
+			return nil, fmt.Errorf("permissions of group %s: %w", g.Name, err)
+		}
+
+		a.groups = append(a.groups, compiled)
+	}
+
+	return a, nil
+}
+
+func (a *LDAPAuth) GetName() string {
+	return Name
+}
+
+// Authenticate rejects the credentials, the basic auth username has to be the name of the user.
+func (a *LDAPAuth) Authenticate(_ string, _ *terraform.State) (bool, error) {
+	return false, fmt.Errorf("ldap auth requires the name of the user as basic auth username")
+}
+
+// IdentifyUser binds as the user and returns the user as subject and its directory groups. The configured groups
+// decide the granted operations.
+func (a *LDAPAuth) IdentifyUser(username, password string) (*auth.Identity, error) {
+	u, err := a.login(username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Identity{
+		Subject: username,
+		Groups:  u.groups,
+		Claims:  map[string]any{"dn": u.dn},
+		Grant: func(s *terraform.State, op auth.Operation) (bool, error) {
+			return a.authorize(u, s, op), nil
+		},
+	}, nil
+}
+
+// authorize checks whether a group of the user grants the operation on the project of the state.
+func (a *LDAPAuth) authorize(u *user, s *terraform.State, op auth.Operation) bool {
+	for _, g := range a.groups {
+		if !slices.ContainsFunc(u.groups, func(name string) bool { return strings.EqualFold(name, g.name) }) {
+			continue
+		}
+
+		if op != "" && !slices.Contains(g.permissions, op) {
+			continue
+		}
+
+		for _, project := range g.projects {
+			if project.MatchString(s.Project) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// login binds as the user and resolves its groups.
+func (a *LDAPAuth) login(username, password string) (*user, error) {
+	// an empty password would be an unauthenticated bind, which succeeds on most servers
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithDialer(&net.Dialer{Timeout: a.cfg.Timeout}))
+	if err != nil {
+		return nil, fmt.Errorf("connecting to LDAP server: %w", err)
+	}
+	defer conn.Close()
+
+	conn.SetTimeout(a.cfg.Timeout)
+
+	if a.cfg.StartTLS {
+		u, _ := url.Parse(a.cfg.URL)
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}); err != nil {
+			return nil, fmt.Errorf("starting TLS: %w", err)
+		}
+	}
+
+	dn := strings.ReplaceAll(a.cfg.UserDN, "{username}", ldap.EscapeDN(username))
+
+	if err := conn.Bind(dn, password); ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+		return nil, fmt.Errorf("invalid username or password")
+	} else if err != nil {
+		return nil, fmt.Errorf("binding as %s: %w", dn, err)
+	}
+
+	filter := strings.NewReplacer("{dn}", ldap.EscapeFilter(dn), "{username}", ldap.EscapeFilter(username)).
+		Replace(a.cfg.GroupFilter)
+
+	result, err := conn.Search(ldap.NewSearchRequest(a.cfg.GroupBaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		0, int(a.cfg.Timeout/time.Second), false, filter, []string{a.cfg.GroupAttribute}, nil))
+	// a missing group base DN is a misconfiguration, which must not silently remove the groups of all users
+	if err != nil {
+		return nil, fmt.Errorf("searching groups of %s: %w", dn, err)
+	}
+
+	u := &user{dn: dn}
+	for _, entry := range result.Entries {
+		u.groups = append(u.groups, entry.GetAttributeValues(a.cfg.GroupAttribute)...)
+	}
+
+	return u, nil
+}
@@ -0,0 +1,118 @@
+package ldap
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/ldap/ldaptest"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestIdentifyUser(t *testing.T) {
+	server := ldaptest.NewServer(t)
+	server.AddUser("uid=alice,ou=people,dc=example,dc=org", "secret1", map[string][]string{"uid": {"alice"}})
+	server.AddUser("uid=bob,ou=people,dc=example,dc=org", "secret2", map[string][]string{"uid": {"bob"}})
+	server.AddUser("uid=carol,ou=people,dc=example,dc=org", "secret3", map[string][]string{"uid": {"carol"}})
+	server.AddEntry("cn=infra,ou=groups,dc=example,dc=org", map[string][]string{
+		"cn":     {"infra"},
+		"member": {"uid=alice,ou=people,dc=example,dc=org"},
+	})
+	server.AddEntry("cn=devs,ou=groups,dc=example,dc=org", map[string][]string{
+		"cn":     {"devs"},
+		"member": {"uid=alice,ou=people,dc=example,dc=org", "uid=bob,ou=people,dc=example,dc=org"},
+	})
+
+	a, err := NewLDAPAuth(config.LDAPAuthConfig{
+		URL:            server.URL,
+		UserDN:         "uid={username},ou=people,dc=example,dc=org",
+		GroupBaseDN:    "ou=groups,dc=example,dc=org",
+		GroupFilter:    "(member={dn})",
+		GroupAttribute: "cn",
+		Timeout:        5 * time.Second,
+		Groups: []config.LDAPGroupConfig{
+			{Name: "infra", Projects: []string{"prod-*"}},
+			{Name: "devs", Projects: []string{"prod-*"}, Permissions: []string{"read"}},
+			{Name: "devs", Projects: []string{"dev-*"}},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+		op       auth.Operation
+		project  string
+		ok       bool
+		err      string
+	}{
+		{"infra writes prod", "alice", "secret1", auth.Write, "prod-network", true, ""},
+		{"devs read prod", "bob", "secret2", auth.Read, "prod-network", true, ""},
+		{"devs write prod", "bob", "secret2", auth.Write, "prod-network", false, ""},
+		{"devs write dev", "bob", "secret2", auth.Write, "dev-network", true, ""},
+		{"user without groups", "carol", "secret3", auth.Read, "dev-network", false, ""},
+		{"wrong password", "alice", "secret2", auth.Read, "prod-network", false, "invalid username or password"},
+		{"unknown user", "dave", "secret1", auth.Read, "prod-network", false, "invalid username or password"},
+		{"empty password", "alice", "", auth.Read, "prod-network", false, "invalid username or password"},
+		{"injected dn", "alice,ou=people,dc=example,dc=org", "secret1", auth.Read, "prod-network", false, "invalid username or password"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := authorizeUser(a, tt.username, tt.password, &terraform.State{Project: tt.project, Name: "state"}, tt.op)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.ok, ok)
+		})
+	}
+
+	identity, err := a.IdentifyUser("alice", "secret1")
+	require.NoError(t, err)
+	require.Equal(t, "alice", identity.Subject)
+	require.ElementsMatch(t, []string{"infra", "devs"}, identity.Groups)
+
+	// the identity authorizes further states without binding again
+	binds := server.BindCount.Load()
+
+	for _, project := range []string{"infra", "apps", "other"} {
+		_, err := identity.Authorize(&terraform.State{Project: project, Name: "state"}, auth.Read)
+		require.NoError(t, err)
+	}
+	require.Equal(t, binds, server.BindCount.Load())
+}
+
+func TestMissingGroupBaseDN(t *testing.T) {
+	server := ldaptest.NewServer(t)
+	server.AddUser("uid=alice,ou=people,dc=example,dc=org", "secret1", map[string][]string{"uid": {"alice"}})
+
+	a, err := NewLDAPAuth(config.LDAPAuthConfig{
+		URL:            server.URL,
+		UserDN:         "uid={username},ou=people,dc=example,dc=org",
+		GroupBaseDN:    "ou=groups,dc=example,dc=org",
+		GroupFilter:    "(member={dn})",
+		GroupAttribute: "cn",
+		Timeout:        5 * time.Second,
+	})
+	require.NoError(t, err)
+
+	_, err = a.IdentifyUser("alice", "secret1")
+	require.ErrorContains(t, err, "searching groups of uid=alice,ou=people,dc=example,dc=org")
+	require.ErrorContains(t, err, "No Such Object")
+}
+
+// authorizeUser checks the password and the operation like auth.Authenticate.
+func authorizeUser(a *LDAPAuth, username, password string, s *terraform.State, op auth.Operation) (bool, error) {
+	identity, err := a.IdentifyUser(username, password)
+	if err != nil {
+		return false, err
+	}
+
+	return identity.Authorize(s, op)
+}
@@ -0,0 +1,338 @@
+// Package ldaptest implements a minimal in-process LDAP server for tests, which supports simple binds and searches
+// with equality, presence, and, or and not filters.
+package ldaptest
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/stretchr/testify/require"
+)
+
+// LDAP protocol operations and result codes
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+
+	resultSuccess                  = 0
+	resultProtocolError            = 2
+	resultNoSuchObject             = 32
+	resultInvalidCredentials       = 49
+	resultInsufficientAccessRights = 50
+)
+
+// Entry is an object of the directory.
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+}
+
+// Server is an LDAP server listening on localhost. Only bound connections can search.
+type Server struct {
+	URL       string
+	BindCount atomic.Int32
+
+	listener  net.Listener
+	mu        sync.Mutex
+	passwords map[string]string
+	entries   []Entry
+}
+
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	s := &Server{
+		URL:       "ldap://" + listener.Addr().String(),
+		listener:  listener,
+		passwords: make(map[string]string),
+	}
+
+	go s.serve()
+	t.Cleanup(func() { _ = listener.Close() })
+
+	return s
+}
+
+// AddUser adds an entry, which can bind with the password.
+func (s *Server) AddUser(dn, password string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.passwords[strings.ToLower(dn)] = password
+	s.entries = append(s.entries, Entry{DN: dn, Attributes: attributes})
+}
+
+// AddEntry adds an entry (e.g. a group).
+func (s *Server) AddEntry(dn string, attributes map[string][]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append(s.entries, Entry{DN: dn, Attributes: attributes})
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	bound := false
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case opBindRequest:
+			code := s.bind(op)
+			bound = code == resultSuccess
+
+			if writeResult(conn, id, opBindResponse, code) != nil {
+				return
+			}
+		case opSearchRequest:
+			if !bound {
+				if writeResult(conn, id, opSearchResultDone, resultInsufficientAccessRights) != nil {
+					return
+				}
+				continue
+			}
+
+			if s.search(conn, id, op) != nil {
+				return
+			}
+		case opUnbindRequest:
+			return
+		default:
+			_ = writeResult(conn, id, opBindResponse, resultProtocolError)
+			return
+		}
+	}
+}
+
+func (s *Server) bind(op *ber.Packet) int64 {
+	s.BindCount.Add(1)
+
+	if len(op.Children) < 3 || op.Children[2].Tag != 0 {
+		return resultProtocolError
+	}
+
+	dn, _ := op.Children[1].Value.(string)
+	password := op.Children[2].Data.String()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if expected, ok := s.passwords[strings.ToLower(dn)]; !ok || password == "" || password != expected {
+		return resultInvalidCredentials
+	}
+
+	return resultSuccess
+}
+
+func (s *Server) search(conn net.Conn, id int64, op *ber.Packet) error {
+	if len(op.Children) < 8 {
+		return writeResult(conn, id, opSearchResultDone, resultProtocolError)
+	}
+
+	baseDN, _ := op.Children[0].Value.(string)
+	scope, _ := op.Children[1].Value.(int64)
+	filter := op.Children[6]
+
+	var attributes []string
+	for _, attr := range op.Children[7].Children {
+		if name, ok := attr.Value.(string); ok {
+			attributes = append(attributes, name)
+		}
+	}
+
+	s.mu.Lock()
+	entries := append([]Entry(nil), s.entries...)
+	s.mu.Unlock()
+
+	if !baseExists(entries, baseDN) {
+		return writeResult(conn, id, opSearchResultDone, resultNoSuchObject)
+	}
+
+	for _, entry := range entries {
+		if !inScope(entry.DN, baseDN, scope) {
+			continue
+		}
+
+		if ok, err := matches(filter, entry); err != nil {
+			return writeResult(conn, id, opSearchResultDone, resultProtocolError)
+		} else if !ok {
+			continue
+		}
+
+		if err := writeEntry(conn, id, entry, attributes); err != nil {
+			return err
+		}
+	}
+
+	return writeResult(conn, id, opSearchResultDone, resultSuccess)
+}
+
+// inScope checks whether the entry is the base object (scope 0), a child (scope 1) or below it (scope 2).
+func inScope(dn, baseDN string, scope int64) bool {
+	dn, baseDN = strings.ToLower(dn), strings.ToLower(baseDN)
+
+	switch scope {
+	case 0:
+		return dn == baseDN
+	case 1:
+		parent, ok := strings.CutSuffix(dn, ","+baseDN)
+		return ok && !strings.Contains(parent, ",")
+	default:
+		return dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+// baseExists returns whether there are entries at or below the base DN, the server has no explicit containers.
+func baseExists(entries []Entry, baseDN string) bool {
+	for _, entry := range entries {
+		if inScope(entry.DN, baseDN, 2) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matches(filter *ber.Packet, entry Entry) (bool, error) {
+	switch filter.Tag {
+	case 0: // and
+		for _, child := range filter.Children {
+			if ok, err := matches(child, entry); err != nil || !ok {
+				return false, err
+			}
+		}
+		return true, nil
+	case 1: // or
+		for _, child := range filter.Children {
+			if ok, err := matches(child, entry); err != nil || ok {
+				return ok, err
+			}
+		}
+		return false, nil
+	case 2: // not
+		if len(filter.Children) != 1 {
+			return false, errors.New("invalid not filter")
+		}
+		ok, err := matches(filter.Children[0], entry)
+		return !ok, err
+	case 3: // equality match
+		if len(filter.Children) != 2 {
+			return false, errors.New("invalid equality filter")
+		}
+		attr, _ := filter.Children[0].Value.(string)
+		value, _ := filter.Children[1].Value.(string)
+
+		for _, v := range attributeValues(entry, attr) {
+			if strings.EqualFold(v, value) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case 7: // present
+		return len(attributeValues(entry, filter.Data.String())) > 0, nil
+	default:
+		return false, errors.New("unsupported filter")
+	}
+}
+
+func attributeValues(entry Entry, attr string) []string {
+	if strings.EqualFold(attr, "objectClass") && len(entry.Attributes["objectClass"]) == 0 {
+		// every entry has an object class
+		return []string{"top"}
+	}
+
+	for name, values := range entry.Attributes {
+		if strings.EqualFold(name, attr) {
+			return values
+		}
+	}
+
+	return nil
+}
+
+func writeEntry(conn net.Conn, id int64, entry Entry, attributes []string) error {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.DN, "DN"))
+
+	attrs := ber.NewSequence("Attributes")
+
+	for name, values := range entry.Attributes {
+		if len(attributes) > 0 && !containsFold(attributes, name) {
+			continue
+		}
+
+		attr := ber.NewSequence("Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, v := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "Value"))
+		}
+
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+
+	op.AppendChild(attrs)
+
+	return write(conn, id, op)
+}
+
+func writeResult(conn net.Conn, id int64, opTag ber.Tag, code int64) error {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opTag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+
+	return write(conn, id, op)
+}
+
+func write(conn net.Conn, id int64, op *ber.Packet) error {
+	packet := ber.NewSequence("LDAP Message")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	packet.AppendChild(op)
+
+	_, err := conn.Write(packet.Bytes())
+	return err
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,165 @@
+// Package mtls implements the authentication with TLS client certificates, which are verified by the server with the
+// configured client CA bundle. The certificate subject and SANs (e.g. SPIFFE IDs) are mapped to states by rules.
+package mtls
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+const Name = "mtls"
+
+func init() {
+	auth.Register(Name, func(cfg config.AuthConfig, _ config.ClientsConfig) (auth.Authenticator, error) {
+		if !cfg.MTLS.Enabled {
+			return nil, auth.ErrDisabled
+		}
+
+		return NewMTLSAuth(cfg.MTLS)
+	})
+}
+
+type MTLSAuth struct {
+	rules []rule
+}
+
+type rule struct {
+	subject, commonName, uri, dns, email *regexp.Regexp
+	project, state                       *regexp.Regexp
+	permissions                          []auth.Operation
+}
+
+func NewMTLSAuth(cfg config.MTLSAuthConfig) (*MTLSAuth, error) {
+	a := &MTLSAuth{}
+	syntax := pattern.Syntax(cfg.Match)
+
+	for i, r := range cfg.Rules {
+		var compiled rule
+		var err error
+
+		for _, p := range []struct {
+			re      **regexp.Regexp
+			pattern string
+		}{
+			{&compiled.subject, r.Subject},
+			{&compiled.commonName, r.CommonName},
+			{&compiled.uri, r.URI},
+			{&compiled.dns, r.DNS},
+			{&compiled.email, r.Email},
+			{&compiled.project, r.Project},
+			{&compiled.state, r.State},
+		} {
+			if p.pattern == "" {
+				continue
+			}
+
+			if *p.re, err = pattern.Compile(syntax, p.pattern); err != nil {
+				return nil, fmt.Errorf("rule %d: %w", i, err)
+			}
+		}
+
+		if compiled.project == nil || compiled.state == nil {
+			return nil, fmt.Errorf("rule %d: project and state are required", i)
+		}
+
+		if compiled.subject == nil && compiled.commonName == nil && compiled.uri == nil && compiled.dns == nil &&
+			compiled.email == nil {
+			return nil, fmt.Errorf("rule %d: one of subject, common_name, uri, dns or email is required", i)
+		}
+
+		if compiled.permissions, err = auth.ParseOperations(r.Permissions); err != nil {
+			return nil, fmt.Errorf("permissions of rule %d: %w", i, err)
+		}
+
+		a.rules = append(a.rules, compiled)
+	}
+
+	return a, nil
+}
+
+func (a *MTLSAuth) GetName() string {
+	return Name
+}
+
+// Authenticate rejects passwords, the client certificate is checked by IdentifyCertificate.
+func (a *MTLSAuth) Authenticate(_ string, _ *terraform.State) (bool, error) {
+	return false, fmt.Errorf("mtls auth requires a client certificate")
+}
+
+// IdentifyCertificate returns the first URI SAN (e.g. the SPIFFE ID) or the common name as subject and the
+// organizational units as groups. The rules matching the certificate decide the granted operations.
+func (a *MTLSAuth) IdentifyCertificate(cert *x509.Certificate) (*auth.Identity, error) {
+	subject := cert.Subject.CommonName
+	uris := make([]string, 0, len(cert.URIs))
+
+	for _, uri := range cert.URIs {
+		uris = append(uris, uri.String())
+	}
+
+	if len(uris) > 0 {
+		subject = uris[0]
+	}
+
+	return &auth.Identity{
+		Subject: subject,
+		Groups:  cert.Subject.OrganizationalUnit,
+		Claims: map[string]any{
+			"subject":     cert.Subject.String(),
+			"common_name": cert.Subject.CommonName,
+			"uris":        uris,
+			"dns_names":   cert.DNSNames,
+			"emails":      cert.EmailAddresses,
+		},
+		Grant: func(s *terraform.State, op auth.Operation) (bool, error) {
+			return a.authorize(cert, s, op), nil
+		},
+	}, nil
+}
+
+// authorize checks whether a rule grants the operation on the state to the certificate.
+func (a *MTLSAuth) authorize(cert *x509.Certificate, s *terraform.State, op auth.Operation) bool {
+	for _, r := range a.rules {
+		if op != "" && !slices.Contains(r.permissions, op) {
+			continue
+		}
+
+		if r.matches(cert) && r.project.MatchString(s.Project) && r.state.MatchString(s.Name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches checks whether all certificate patterns of the rule match.
+func (r rule) matches(cert *x509.Certificate) bool {
+	if r.subject != nil && !r.subject.MatchString(cert.Subject.String()) {
+		return false
+	}
+
+	if r.commonName != nil && !r.commonName.MatchString(cert.Subject.CommonName) {
+		return false
+	}
+
+	if r.uri != nil && !slices.ContainsFunc(cert.URIs, func(u *url.URL) bool { return r.uri.MatchString(u.String()) }) {
+		return false
+	}
+
+	if r.dns != nil && !slices.ContainsFunc(cert.DNSNames, r.dns.MatchString) {
+		return false
+	}
+
+	if r.email != nil && !slices.ContainsFunc(cert.EmailAddresses, r.email.MatchString) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,78 @@
+package mtls
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/mtls/mtlstest"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestIdentifyCertificate(t *testing.T) {
+	a, err := NewMTLSAuth(config.MTLSAuthConfig{
+		Match: "glob",
+		Rules: []config.MTLSRuleConfig{{
+			URI:     "spiffe://cluster.local/ns/infra/sa/*",
+			Project: "infra",
+			State:   "*",
+		}, {
+			CommonName:  "dashboard",
+			Subject:     "*O=platform*",
+			Project:     "*",
+			State:       "*",
+			Permissions: []string{"read"},
+		}},
+	})
+	require.NoError(t, err)
+
+	ca := mtlstest.NewCA(t)
+	spiffeID, err := url.Parse("spiffe://cluster.local/ns/infra/sa/terraform")
+	require.NoError(t, err)
+
+	workload := ca.Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "terraform"}, URIs: []*url.URL{spiffeID}}).Leaf
+	dashboard := ca.Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "dashboard", Organization: []string{"platform"}}}).Leaf
+	other := ca.Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "dashboard", Organization: []string{"apps"}}}).Leaf
+
+	tests := []struct {
+		name    string
+		cert    *x509.Certificate
+		op      auth.Operation
+		project string
+		ok      bool
+	}{
+		{"spiffe id", workload, auth.Write, "infra", true},
+		{"spiffe id other project", workload, auth.Read, "apps", false},
+		{"read-only subject reads", dashboard, auth.Read, "apps", true},
+		{"read-only subject writes", dashboard, auth.Write, "apps", false},
+		{"other organization", other, auth.Read, "apps", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			identity, err := a.IdentifyCertificate(tt.cert)
+			require.NoError(t, err)
+
+			ok, err := identity.Authorize(&terraform.State{Project: tt.project, Name: "prod"}, tt.op)
+			require.NoError(t, err)
+			require.Equal(t, tt.ok, ok)
+		})
+	}
+
+	identity, err := a.IdentifyCertificate(workload)
+	require.NoError(t, err)
+	require.Equal(t, spiffeID.String(), identity.Subject)
+}
+
+func TestNewMTLSAuthRequiresCertificatePattern(t *testing.T) {
+	_, err := NewMTLSAuth(config.MTLSAuthConfig{
+		Match: "glob",
+		Rules: []config.MTLSRuleConfig{{Project: "*", State: "*"}},
+	})
+	require.ErrorContains(t, err, "one of subject, common_name, uri, dns or email is required")
+}
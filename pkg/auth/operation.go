@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// Operation is the kind of access to a state, which is authorized.
+type Operation string
+
+const (
+	// Read allows getting a state, its versions and listing it
+	Read Operation = "read"
+	// Lock allows locking and unlocking a state
+	Lock Operation = "lock"
+	// Write allows saving a state and restoring versions
+	Write Operation = "write"
+	// Delete allows deleting a state
+	Delete Operation = "delete"
+)
+
+// Operations contains all operations.
+var Operations = []Operation{Read, Lock, Write, Delete}
+
+// Authorizer is implemented by auth backends, which grant permissions for single operations. Auth backends, which
+// only implement Authenticator, grant all operations on the states they authenticate.
+type Authorizer interface {
+	// Authorize authenticates the secret like Authenticator.Authenticate and checks that op is permitted.
+	Authorize(secret string, s *terraform.State, op Operation) (bool, error)
+}
+
+// ParseOperations parses the names of operations, * stands for all operations. If names is empty, all operations
+// are returned, so that credentials without permission scopes keep full access.
+func ParseOperations(names []string) ([]Operation, error) {
+	if len(names) == 0 {
+		return Operations, nil
+	}
+
+	var ops []Operation
+
+	for _, name := range names {
+		if name == "*" {
+			return Operations, nil
+		}
+
+		op := Operation(name)
+		if !slices.Contains(Operations, op) {
+			return nil, fmt.Errorf("unknown operation %q (supported: read, lock, write, delete, *)", name)
+		}
+
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
@@ -0,0 +1,71 @@
+// Package pattern matches project and state names against the patterns granted by credentials
+// (e.g. the claims of a token).
+package pattern
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Syntax of a pattern.
+type Syntax string
+
+const (
+	// Exact patterns have to be equal to the name.
+	Exact Syntax = "exact"
+	// Glob patterns match any sequence of characters with * and a single character with ?,
+	// all other characters are matched literally.
+	Glob Syntax = "glob"
+	// Regex patterns are regular expressions, which have to match the whole name.
+	Regex Syntax = "regex"
+)
+
+// Valid returns whether the syntax is supported.
+func (s Syntax) Valid() bool {
+	return s == Exact || s == Glob || s == Regex
+}
+
+// Match returns whether name matches the pattern.
+func Match(syntax Syntax, pattern, name string) (bool, error) {
+	re, err := Compile(syntax, pattern)
+	if err != nil {
+		return false, err
+	}
+
+	return re.MatchString(name), nil
+}
+
+// Compile returns a regular expression, which matches the names matching the pattern.
+func Compile(syntax Syntax, pattern string) (*regexp.Regexp, error) {
+	switch syntax {
+	case Exact:
+		return regexp.Compile("^" + regexp.QuoteMeta(pattern) + "$")
+	case Glob:
+		var expr strings.Builder
+		expr.WriteString("^")
+
+		for _, r := range pattern {
+			switch r {
+			case '*':
+				expr.WriteString(".*")
+			case '?':
+				expr.WriteString(".")
+			default:
+				expr.WriteString(regexp.QuoteMeta(string(r)))
+			}
+		}
+		expr.WriteString("$")
+
+		return regexp.Compile(expr.String())
+	case Regex:
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+
+		return re, nil
+	default:
+		return nil, fmt.Errorf("unknown pattern syntax %q", syntax)
+	}
+}
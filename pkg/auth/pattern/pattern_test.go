@@ -0,0 +1,44 @@
+package pattern
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		syntax  Syntax
+		pattern string
+		name    string
+		match   bool
+	}{
+		{Exact, "prod", "prod", true},
+		{Exact, "prod-*", "prod-eu", false},
+		{Exact, "a.c", "abc", false},
+		{Glob, "prod", "prod", true},
+		{Glob, "prod", "prod-eu", false},
+		{Glob, "*", "anything", true},
+		{Glob, "prod-*", "prod-eu", true},
+		{Glob, "prod-??", "prod-eu", true},
+		{Glob, "prod-??", "prod-eu1", false},
+		{Glob, "group/*", "group/sub/project", true},
+		{Glob, "a.c", "abc", false},
+		{Regex, "prod-(eu|us)", "prod-eu", true},
+		{Regex, "prod-(eu|us)", "prod-eu1", false},
+		{Regex, "prod|dev", "dev", true},
+		{Regex, "prod", "preprod", false},
+	}
+
+	for _, test := range tests {
+		match, err := Match(test.syntax, test.pattern, test.name)
+		require.NoError(t, err)
+		require.Equal(t, test.match, match, "%s %q %q", test.syntax, test.pattern, test.name)
+	}
+
+	_, err := Match(Regex, "prod-(", "prod-")
+	require.ErrorContains(t, err, "invalid pattern")
+
+	_, err = Match("sql", "prod%", "prod")
+	require.ErrorContains(t, err, "unknown pattern syntax")
+}
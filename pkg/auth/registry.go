@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// ErrDisabled is returned by a factory, if the auth backend isn't enabled by the configuration.
+var ErrDisabled = errors.New("auth backend is not enabled")
+
+// Factory creates an auth backend from the configuration. It returns ErrDisabled, if the backend isn't enabled.
+type Factory func(cfg config.AuthConfig, clients config.ClientsConfig) (Authenticator, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes an auth backend available by name, it's meant to be called in the init function of the package
+// implementing the backend. The name is the username of the basic auth header, which selects the backend.
+// Register panics if it's called twice with the same name.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic("auth: Register called twice for backend " + name)
+	}
+
+	factories[name] = factory
+}
+
+// Backends returns the sorted names of the registered auth backends.
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func isRegistered(name string) bool {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	_, ok := factories[name]
+	return ok
+}
+
+// newAuthenticators creates all registered auth backends, which are enabled by cfg.
+func newAuthenticators(cfg config.AuthConfig, clients config.ClientsConfig) (map[string]Authenticator, error) {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	authenticators := make(map[string]Authenticator)
+
+	for name, factory := range factories {
+		a, err := factory(cfg, clients)
+		if errors.Is(err, ErrDisabled) {
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to initialize auth backend %s: %v", name, err)
+		}
+
+		authenticators[name] = a
+	}
+
+	return authenticators, nil
+}
+
+// backendList returns the registered backends for error messages.
+func backendList() string {
+	return strings.Join(Backends(), ", ")
+}
@@ -0,0 +1,103 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hash algorithms supported for new tokens.
+const (
+	Argon2id = "argon2id"
+	Bcrypt   = "bcrypt"
+)
+
+// argon2id parameters for new hashes, existing hashes are verified with the parameters encoded in them
+const (
+	argon2Memory  = 19 * 1024
+	argon2Time    = 2
+	argon2Threads = 1
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+var b64 = base64.RawStdEncoding
+
+// Hash hashes the secret with the given algorithm, argon2id hashes are encoded in the PHC string format.
+func Hash(algorithm, secret string) (string, error) {
+	switch algorithm {
+	case Argon2id:
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("generating salt: %w", err)
+		}
+
+		key := argon2.IDKey([]byte(secret), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+			argon2.Version, argon2Memory, argon2Time, argon2Threads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+	case Bcrypt:
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+
+		return string(hash), nil
+	default:
+		return "", fmt.Errorf("unknown hash algorithm %q (supported: %s, %s)", algorithm, Argon2id, Bcrypt)
+	}
+}
+
+// VerifyHash returns whether the secret matches the argon2id or bcrypt hash.
+func VerifyHash(hash, secret string) (bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return verifyArgon2(hash, secret)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("verifying bcrypt hash: %w", err)
+	}
+
+	return true, nil
+}
+
+func verifyArgon2(hash, secret string) (bool, error) {
+	// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, fmt.Errorf("invalid argon2id hash")
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2id version %q", parts[2])
+	}
+
+	var memory, time uint32
+	var threads uint8
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &memory, &time, &threads); err != nil {
+		return false, fmt.Errorf("invalid argon2id parameters %q: %w", parts[3], err)
+	}
+
+	salt, err := b64.DecodeString(parts[4])
+	if err != nil {
+		return false, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+
+	key, err := b64.DecodeString(parts[5])
+	if err != nil {
+		return false, fmt.Errorf("invalid argon2id key: %w", err)
+	}
+
+	actual := argon2.IDKey([]byte(secret), salt, time, memory, threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(key, actual) == 1, nil
+}
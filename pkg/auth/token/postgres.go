@@ -0,0 +1,144 @@
+package token
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PostgresStore stores the tokens in a Postgres table.
+type PostgresStore struct {
+	db    *sql.DB
+	table string
+}
+
+func NewPostgresStore(db *sql.DB, table string) (*PostgresStore, error) {
+	p := &PostgresStore{
+		db:    db,
+		table: table,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	if _, err := p.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+p.table+` (
+			id CHARACTER VARYING(255) PRIMARY KEY,
+			owner CHARACTER VARYING(255) NOT NULL,
+			hash TEXT NOT NULL,
+			states JSONB NOT NULL,
+			permissions JSONB NOT NULL,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			expires_at TIMESTAMP WITH TIME ZONE
+		);`); err != nil {
+		return nil, fmt.Errorf("creating tokens table: %w", err)
+	}
+
+	return p, nil
+}
+
+func (p *PostgresStore) GetToken(id string) (*Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	row := p.db.QueryRowContext(ctx, `SELECT id, owner, hash, states, permissions, created_at, expires_at
+		FROM `+p.table+` WHERE id = $1`, id)
+
+	t, err := scanToken(row)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+
+	return t, err
+}
+
+func (p *PostgresStore) SaveToken(t *Token) error {
+	states, err := json.Marshal(t.States)
+	if err != nil {
+		return err
+	}
+
+	permissions, err := json.Marshal(t.Permissions)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	_, err = p.db.ExecContext(ctx, `INSERT INTO `+p.table+`
+		(id, owner, hash, states, permissions, created_at, expires_at) VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (id) DO UPDATE SET owner = $2, hash = $3, states = $4, permissions = $5, created_at = $6,
+			expires_at = $7`,
+		t.ID, t.Owner, t.Hash, states, permissions, t.Created, sql.NullTime{Time: t.Expires, Valid: !t.Expires.IsZero()})
+
+	return err
+}
+
+func (p *PostgresStore) ListTokens() ([]*Token, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := p.db.QueryContext(ctx, `SELECT id, owner, hash, states, permissions, created_at, expires_at
+		FROM `+p.table+` ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*Token
+
+	for rows.Next() {
+		t, err := scanToken(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		tokens = append(tokens, t)
+	}
+
+	return tokens, rows.Err()
+}
+
+func (p *PostgresStore) DeleteToken(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	res, err := p.db.ExecContext(ctx, `DELETE FROM `+p.table+` WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	if deleted, err := res.RowsAffected(); err != nil {
+		return err
+	} else if deleted == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func scanToken(row interface{ Scan(dest ...any) error }) (*Token, error) {
+	var t Token
+	var states, permissions []byte
+	var expires sql.NullTime
+
+	if err := row.Scan(&t.ID, &t.Owner, &t.Hash, &states, &permissions, &t.Created, &expires); err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(states, &t.States); err != nil {
+		return nil, fmt.Errorf("parsing states of token %s: %w", t.ID, err)
+	}
+
+	if err := json.Unmarshal(permissions, &t.Permissions); err != nil {
+		return nil, fmt.Errorf("parsing permissions of token %s: %w", t.ID, err)
+	}
+
+	if expires.Valid {
+		t.Expires = expires.Time
+	}
+
+	return &t, nil
+}
@@ -0,0 +1,42 @@
+package token
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/client/postgres/postgrestest"
+)
+
+func TestPostgresStore(t *testing.T) {
+	store, err := NewPostgresStore(postgrestest.NewIfIntegrationTest(t), "tokens")
+	require.NoError(t, err)
+
+	secret, err := Create(store, Argon2id, &Token{
+		Owner:       "ci",
+		States:      []string{"infra/*"},
+		Permissions: []string{"read", "lock"},
+		Expires:     time.Now().Add(time.Hour),
+	})
+	require.NoError(t, err)
+	id, _, _ := parse(secret)
+
+	tok, err := store.GetToken(id)
+	require.NoError(t, err)
+	require.Equal(t, "ci", tok.Owner)
+	require.Equal(t, []string{"infra/*"}, tok.States)
+	require.Equal(t, []string{"read", "lock"}, tok.Permissions)
+	require.False(t, tok.Expired(time.Now()))
+
+	ok, err := VerifyHash(tok.Hash, secret)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	tokens, err := store.ListTokens()
+	require.NoError(t, err)
+	require.NotEmpty(t, tokens)
+
+	require.NoError(t, store.DeleteToken(id))
+	require.ErrorIs(t, store.DeleteToken(id), ErrNotFound)
+}
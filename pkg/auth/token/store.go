@@ -0,0 +1,205 @@
+package token
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	pgclient "github.com/nimbolus/terraform-backend/pkg/client/postgres"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// ErrNotFound is returned by a Store, if the token doesn't exist.
+var ErrNotFound = errors.New("token not found")
+
+// Token is a stored API token, the secret itself is only known to its owner.
+type Token struct {
+	ID    string `json:"id"`
+	Owner string `json:"owner"`
+	// Hash is the argon2id or bcrypt hash of the secret
+	Hash string `json:"hash"`
+	// States are glob patterns of <project>/<name>
+	States      []string  `json:"states"`
+	Permissions []string  `json:"permissions,omitempty"`
+	Created     time.Time `json:"created"`
+	// Expires is zero, if the token doesn't expire
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+// Expired returns whether the token is expired at the given time.
+func (t *Token) Expired(now time.Time) bool {
+	return !t.Expires.IsZero() && now.After(t.Expires)
+}
+
+// Store persists the hashed tokens.
+type Store interface {
+	// GetToken returns the token with the ID or ErrNotFound.
+	GetToken(id string) (*Token, error)
+	// SaveToken creates or replaces the token.
+	SaveToken(t *Token) error
+	// ListTokens returns all tokens sorted by ID.
+	ListTokens() ([]*Token, error)
+	// DeleteToken deletes the token with the ID or returns ErrNotFound.
+	DeleteToken(id string) error
+}
+
+// NewStore creates the token store selected by cfg.
+func NewStore(cfg config.TokenAuthConfig, clients config.ClientsConfig) (Store, error) {
+	switch cfg.Store {
+	case "file":
+		return NewFileStore(cfg.File), nil
+	case "postgres":
+		db, err := pgclient.NewClient(clients.Postgres)
+		if err != nil {
+			return nil, fmt.Errorf("creating postgres client: %w", err)
+		}
+
+		return NewPostgresStore(db, cfg.Postgres.Table)
+	default:
+		return nil, fmt.Errorf("unknown token store %q", cfg.Store)
+	}
+}
+
+// FileStore stores the tokens in a JSON file. The file is read again when it's modified, so tokens created or
+// revoked by the CLI take effect without restarting the server.
+type FileStore struct {
+	path string
+
+	mu      sync.Mutex
+	tokens  map[string]*Token
+	modTime time.Time
+	size    int64
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (f *FileStore) GetToken(id string) (*Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	t, ok := f.tokens[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+
+	return t, nil
+}
+
+func (f *FileStore) SaveToken(t *Token) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	f.tokens[t.ID] = t
+
+	return f.write()
+}
+
+func (f *FileStore) ListTokens() ([]*Token, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	tokens := make([]*Token, 0, len(f.tokens))
+	for _, t := range f.tokens {
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+
+	return tokens, nil
+}
+
+func (f *FileStore) DeleteToken(id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.load(); err != nil {
+		return err
+	}
+
+	if _, ok := f.tokens[id]; !ok {
+		return ErrNotFound
+	}
+
+	delete(f.tokens, id)
+
+	return f.write()
+}
+
+// load reads the file, if it was modified since it was read the last time. A missing file contains no tokens.
+func (f *FileStore) load() error {
+	info, err := os.Stat(f.path)
+	if errors.Is(err, os.ErrNotExist) {
+		f.tokens = make(map[string]*Token)
+		f.modTime, f.size = time.Time{}, 0
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading token file: %w", err)
+	}
+
+	if f.tokens != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return fmt.Errorf("reading token file: %w", err)
+	}
+
+	var tokens []*Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return fmt.Errorf("parsing token file %s: %w", f.path, err)
+	}
+
+	f.tokens = make(map[string]*Token, len(tokens))
+	for _, t := range tokens {
+		f.tokens[t.ID] = t
+	}
+	f.modTime, f.size = info.ModTime(), info.Size()
+
+	return nil
+}
+
+// write replaces the file atomically, it's only readable by the owner since it contains the hashes.
+func (f *FileStore) write() error {
+	tokens := make([]*Token, 0, len(f.tokens))
+	for _, t := range f.tokens {
+		tokens = append(tokens, t)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].ID < tokens[j].ID })
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := f.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("writing token file: %w", err)
+	}
+
+	if err := os.Rename(tmp, f.path); err != nil {
+		return fmt.Errorf("writing token file: %w", err)
+	}
+
+	// force reading the file again, the modification time may not change within its resolution
+	f.tokens = nil
+
+	return nil
+}
@@ -0,0 +1,209 @@
+// Package token implements the authentication with static API tokens. The tokens are stored hashed, each token
+// belongs to an owner and grants permissions on the states matching its patterns until it expires.
+package token
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+const Name = "token"
+
+// prefix of the secrets, which are formatted as tfb_<id>.<secret>
+const prefix = "tfb_"
+
+// errInvalidToken is returned for all rejected tokens, the reason is only logged
+var errInvalidToken = errors.New("invalid token")
+
+// dummyHash is compared with the secrets of unknown tokens, so that they can't be told apart by the response time
+var dummyHash = sync.OnceValue(func() string {
+	hash, _ := Hash(Argon2id, prefix+"0000.terraform-backend")
+	return hash
+})
+
+func init() {
+	auth.Register(Name, func(cfg config.AuthConfig, clients config.ClientsConfig) (auth.Authenticator, error) {
+		if !cfg.Token.Enabled {
+			return nil, auth.ErrDisabled
+		}
+
+		store, err := NewStore(cfg.Token, clients)
+		if err != nil {
+			return nil, err
+		}
+
+		return NewTokenAuth(store), nil
+	})
+}
+
+type TokenAuth struct {
+	store Store
+}
+
+func NewTokenAuth(store Store) *TokenAuth {
+	return &TokenAuth{store: store}
+}
+
+func (a *TokenAuth) GetName() string {
+	return Name
+}
+
+// Authenticate checks whether the token grants any operation on the state.
+func (a *TokenAuth) Authenticate(secret string, s *terraform.State) (bool, error) {
+	identity, err := a.Identify(secret)
+	if err != nil {
+		return false, err
+	}
+
+	return identity.Grant(s, "")
+}
+
+// Identify returns the owner of the token as subject, the permissions and state patterns of the token decide the
+// granted operations.
+func (a *TokenAuth) Identify(secret string) (*auth.Identity, error) {
+	t, err := a.verify(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Identity{
+		Subject: t.Owner,
+		Claims:  map[string]any{"token_id": t.ID},
+		Grant: func(s *terraform.State, op auth.Operation) (bool, error) {
+			return authorize(t, s, op)
+		},
+	}, nil
+}
+
+func authorize(t *Token, s *terraform.State, op auth.Operation) (bool, error) {
+	if op != "" {
+		permissions, err := auth.ParseOperations(t.Permissions)
+		if err != nil {
+			return false, fmt.Errorf("permissions of token %s: %w", t.ID, err)
+		}
+
+		if !slices.Contains(permissions, op) {
+			return false, nil
+		}
+	}
+
+	for _, p := range t.States {
+		if ok, err := pattern.Match(pattern.Glob, p, s.Project+"/"+s.Name); err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+// verify returns the stored token of the secret, if it's valid and not expired.
+func (a *TokenAuth) verify(secret string) (*Token, error) {
+	id, _, ok := parse(secret)
+	if !ok {
+		return nil, fmt.Errorf("invalid token format")
+	}
+
+	// all rejected tokens return the same error, so that the existence of a token isn't revealed
+	logger := log.WithField("component", Name).WithField("token", id)
+
+	t, err := a.store.GetToken(id)
+	if errors.Is(err, ErrNotFound) {
+		_, _ = VerifyHash(dummyHash(), secret)
+		logger.Warn("rejecting unknown token")
+		return nil, errInvalidToken
+	} else if err != nil {
+		logger.WithError(err).Error("getting token")
+		return nil, errInvalidToken
+	}
+
+	if ok, err := VerifyHash(t.Hash, secret); err != nil {
+		logger.WithError(err).Error("verifying token hash")
+		return nil, errInvalidToken
+	} else if !ok {
+		logger.Warn("rejecting token with invalid secret")
+		return nil, errInvalidToken
+	}
+
+	if t.Expired(time.Now()) {
+		logger.Warnf("rejecting token expired at %s", t.Expires.Format(time.RFC3339))
+		return nil, errInvalidToken
+	}
+
+	return t, nil
+}
+
+// Create generates a new token, stores its hash and returns the secret, which is shown to the owner only once.
+func Create(store Store, algorithm string, t *Token) (string, error) {
+	for _, p := range t.States {
+		if _, err := pattern.Compile(pattern.Glob, p); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := auth.ParseOperations(t.Permissions); err != nil {
+		return "", err
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return "", err
+	}
+
+	// the secret has to be shorter than 72 bytes, which is the maximum input length of bcrypt
+	key, err := randomHex(24)
+	if err != nil {
+		return "", err
+	}
+
+	secret := prefix + id + "." + key
+
+	if t.Hash, err = Hash(algorithm, secret); err != nil {
+		return "", err
+	}
+
+	t.ID = id
+	t.Created = time.Now().UTC()
+
+	if err := store.SaveToken(t); err != nil {
+		return "", fmt.Errorf("saving token: %w", err)
+	}
+
+	return secret, nil
+}
+
+// parse splits the secret into the ID and the random part.
+func parse(secret string) (id, key string, ok bool) {
+	rest, ok := strings.CutPrefix(secret, prefix)
+	if !ok {
+		return "", "", false
+	}
+
+	id, key, ok = strings.Cut(rest, ".")
+	if !ok || id == "" || key == "" {
+		return "", "", false
+	}
+
+	return id, key, true
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generating token: %w", err)
+	}
+
+	return hex.EncodeToString(b), nil
+}
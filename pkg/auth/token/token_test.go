@@ -0,0 +1,107 @@
+package token
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestTokenAuth(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+	a := NewTokenAuth(store)
+
+	writer, err := Create(store, Argon2id, &Token{Owner: "ci", States: []string{"infra/*"}})
+	require.NoError(t, err)
+
+	reader, err := Create(store, Bcrypt, &Token{Owner: "dashboard", States: []string{"*"}, Permissions: []string{"read"}})
+	require.NoError(t, err)
+
+	expired, err := Create(store, Argon2id, &Token{Owner: "old", States: []string{"*"}, Expires: time.Now().Add(-time.Minute)})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		secret string
+		op     auth.Operation
+		state  string
+		ok     bool
+		err    string
+	}{
+		{"write matching state", writer, auth.Write, "infra/prod", true, ""},
+		{"other project", writer, auth.Read, "apps/prod", false, ""},
+		{"read-only token reads", reader, auth.Read, "apps/prod", true, ""},
+		{"read-only token writes", reader, auth.Write, "apps/prod", false, ""},
+		{"expired token", expired, auth.Read, "apps/prod", false, "invalid token"},
+		{"wrong secret", writer[:len(writer)-1] + "x", auth.Read, "infra/prod", false, "invalid token"},
+		{"unknown token", "tfb_0000.secret", auth.Read, "infra/prod", false, "invalid token"},
+		{"invalid format", "secret", auth.Read, "infra/prod", false, "invalid token format"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			project, name, _ := strings.Cut(tt.state, "/")
+			s := &terraform.State{Project: project, Name: name}
+
+			ok, err := authorizeSecret(a, tt.secret, s, tt.op)
+			if tt.err != "" {
+				// rejected tokens don't reveal the reason
+				require.EqualError(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.ok, ok)
+		})
+	}
+
+	identity, err := a.Identify(writer)
+	require.NoError(t, err)
+	require.Equal(t, "ci", identity.Subject)
+}
+
+// authorizeSecret verifies the secret and checks the operation like auth.Authenticate.
+func authorizeSecret(a *TokenAuth, secret string, s *terraform.State, op auth.Operation) (bool, error) {
+	identity, err := a.Identify(secret)
+	if err != nil {
+		return false, err
+	}
+
+	return identity.Authorize(s, op)
+}
+
+func TestFileStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store := NewFileStore(path)
+
+	tokens, err := store.ListTokens()
+	require.NoError(t, err)
+	require.Empty(t, tokens)
+
+	secret, err := Create(store, Argon2id, &Token{Owner: "ci", States: []string{"*"}})
+	require.NoError(t, err)
+	id, _, _ := parse(secret)
+
+	// tokens created by another process (e.g. the CLI) are picked up
+	other := NewFileStore(path)
+	tok, err := other.GetToken(id)
+	require.NoError(t, err)
+	require.Equal(t, "ci", tok.Owner)
+
+	require.NoError(t, store.DeleteToken(id))
+	require.ErrorIs(t, store.DeleteToken(id), ErrNotFound)
+
+	_, err = other.GetToken(id)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestCreateRejectsInvalidPermissions(t *testing.T) {
+	store := NewFileStore(filepath.Join(t.TempDir(), "tokens.json"))
+
+	_, err := Create(store, Argon2id, &Token{Owner: "ci", States: []string{"*"}, Permissions: []string{"admin"}})
+	require.ErrorContains(t, err, "unknown operation")
+}
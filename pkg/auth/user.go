@@ -0,0 +1,10 @@
+package auth
+
+// UserAuthenticator is implemented by auth backends, which authenticate user accounts. Requests, whose basic auth
+// username isn't the name of an auth backend, are authenticated by the username and password. If several are enabled,
+// they're tried in the order of config.AuthConfig.UserBackends until one of them accepts the user.
+type UserAuthenticator interface {
+	// IdentifyUser checks the password of the user and returns its identity, whose Grant decides the permitted
+	// operations.
+	IdentifyUser(username, password string) (*Identity, error)
+}
@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// Validate checks the pattern syntax of the enabled auth backends, which match project and state names against
+// the patterns granted by their credentials, and the user backends. Usernames, which are names of auth backends,
+// select the backend instead of the user account, so they're rejected.
+func Validate(cfg config.AuthConfig) error {
+	var errs []error
+
+	for i, name := range cfg.UserBackends {
+		if !isRegistered(name) {
+			errs = append(errs, config.Invalid(fmt.Sprintf("auth.user_backends.%d", i),
+				"unknown backend %q (registered: %s)", name, backendList()))
+		}
+	}
+
+	if cfg.Htpasswd.Enabled {
+		for i, user := range cfg.Htpasswd.Users {
+			if isRegistered(user.Name) {
+				errs = append(errs, config.Invalid(fmt.Sprintf("auth.htpasswd.users.%d.name", i),
+					"%q is the name of an auth backend and can't be used as username", user.Name))
+			}
+		}
+	}
+
+	for _, issuer := range cfg.JWT.TrustedIssuers() {
+		if !pattern.Syntax(issuer.Match).Valid() {
+			errs = append(errs, config.Invalid("auth.jwt.match",
+				"unknown pattern syntax %q of issuer %s (supported: exact, glob, regex)", issuer.Match, issuer.URL))
+		}
+	}
+
+	ci := func(prefix string, c config.CIAuthConfig) {
+		if c.Enabled && !pattern.Syntax(c.Match).Valid() {
+			errs = append(errs, config.Invalid(prefix+".match", "unknown pattern syntax %q (supported: exact, glob, regex)",
+				c.Match))
+		}
+	}
+
+	ci("auth.gitlab", cfg.GitLab)
+	ci("auth.github", cfg.GitHub)
+
+	if cfg.MTLS.Enabled && !pattern.Syntax(cfg.MTLS.Match).Valid() {
+		errs = append(errs, config.Invalid("auth.mtls.match", "unknown pattern syntax %q (supported: exact, glob, regex)",
+			cfg.MTLS.Match))
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,181 @@
+// Package vault implements the authentication with Vault tokens. The tokens are looked up with the Vault client of the
+// server, their policies and metadata grant access to projects and states.
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/vault/api"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+	vaultclient "github.com/nimbolus/terraform-backend/pkg/client/vault"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+const Name = "vault"
+
+func init() {
+	auth.Register(Name, func(cfg config.AuthConfig, clients config.ClientsConfig) (auth.Authenticator, error) {
+		if !cfg.Vault.Enabled {
+			return nil, auth.ErrDisabled
+		}
+
+		client, err := vaultclient.NewVaultClient(clients.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup Vault client for Vault auth: %v", err)
+		}
+
+		return NewVaultAuth(client, cfg.Vault), nil
+	})
+}
+
+type VaultAuth struct {
+	client *api.Client
+	cfg    config.VaultAuthConfig
+}
+
+// token contains the properties of a looked up token.
+type token struct {
+	policies    []string
+	meta        map[string]string
+	displayName string
+	entityID    string
+}
+
+// NewVaultAuth creates the auth backend, the client needs the permission to update auth/token/lookup.
+func NewVaultAuth(client *api.Client, cfg config.VaultAuthConfig) *VaultAuth {
+	return &VaultAuth{
+		client: client,
+		cfg:    cfg,
+	}
+}
+
+func (a *VaultAuth) GetName() string {
+	return Name
+}
+
+// Authenticate checks whether the token grants any operation on the state.
+func (a *VaultAuth) Authenticate(secret string, s *terraform.State) (bool, error) {
+	identity, err := a.Identify(secret)
+	if err != nil {
+		return false, err
+	}
+
+	return identity.Grant(s, "")
+}
+
+// Identify returns the entity ID (or the display name, if the token has no entity) as subject and the policies as
+// groups of the token. The policies and metadata of the token decide the granted operations.
+func (a *VaultAuth) Identify(secret string) (*auth.Identity, error) {
+	t, err := a.lookup(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	subject := t.entityID
+	if subject == "" {
+		subject = t.displayName
+	}
+
+	meta := make(map[string]any, len(t.meta))
+	for k, v := range t.meta {
+		meta[k] = v
+	}
+
+	return &auth.Identity{
+		Subject: subject,
+		Groups:  t.policies,
+		Claims: map[string]any{
+			"display_name": t.displayName,
+			"entity_id":    t.entityID,
+			"meta":         meta,
+		},
+		Grant: func(s *terraform.State, op auth.Operation) (bool, error) {
+			return a.authorize(t, s, op)
+		},
+	}, nil
+}
+
+func (a *VaultAuth) authorize(t *token, s *terraform.State, op auth.Operation) (bool, error) {
+	// Vault stores policy names in lower case, so projects with upper case letters can only be granted by metadata
+	for _, policy := range t.policies {
+		readProject, read := cutPrefix(policy, a.cfg.ReadPolicyPrefix)
+		project, full := cutPrefix(policy, a.cfg.PolicyPrefix)
+
+		// if one prefix starts with the other (e.g. tfstate- and tfstate-read-), the longer one applies
+		if read && full {
+			read = len(a.cfg.ReadPolicyPrefix) > len(a.cfg.PolicyPrefix)
+			full = !read
+		}
+
+		if read && readProject == s.Project && (op == "" || op == auth.Read) {
+			return true, nil
+		} else if full && project == s.Project {
+			return true, nil
+		}
+	}
+
+	if a.cfg.MetadataKey == "" {
+		return false, nil
+	}
+
+	for _, p := range strings.Split(t.meta[a.cfg.MetadataKey], ",") {
+		if p = strings.TrimSpace(p); p == "" {
+			continue
+		}
+
+		if ok, err := pattern.Match(pattern.Glob, p, s.Project+"/"+s.Name); err != nil || ok {
+			return ok, err
+		}
+	}
+
+	return false, nil
+}
+
+func (a *VaultAuth) lookup(secret string) (*token, error) {
+	if secret == "" {
+		return nil, fmt.Errorf("no vault token given")
+	}
+
+	s, err := a.client.Logical().Write("auth/token/lookup", map[string]any{"token": secret})
+	if err != nil {
+		return nil, fmt.Errorf("looking up vault token: %w", err)
+	} else if s == nil || s.Data == nil {
+		return nil, fmt.Errorf("looking up vault token: empty response")
+	}
+
+	t := &token{meta: make(map[string]string)}
+	t.displayName, _ = s.Data["display_name"].(string)
+	t.entityID, _ = s.Data["entity_id"].(string)
+
+	// the policies of the token and the identity policies of its entity
+	for _, key := range []string{"policies", "identity_policies"} {
+		policies, _ := s.Data[key].([]any)
+		for _, p := range policies {
+			if policy, ok := p.(string); ok {
+				t.policies = append(t.policies, policy)
+			}
+		}
+	}
+
+	meta, _ := s.Data["meta"].(map[string]any)
+	for k, v := range meta {
+		if value, ok := v.(string); ok {
+			t.meta[k] = value
+		}
+	}
+
+	return t, nil
+}
+
+// cutPrefix is like strings.CutPrefix, but doesn't match an empty prefix.
+func cutPrefix(s, prefix string) (string, bool) {
+	if prefix == "" {
+		return "", false
+	}
+
+	return strings.CutPrefix(s, prefix)
+}
@@ -0,0 +1,156 @@
+package vault
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/hashicorp/vault/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// newVault returns a client of a fake Vault server, which knows the tokens.
+func newVault(t *testing.T, tokens map[string]map[string]any) *api.Client {
+	t.Helper()
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/auth/token/lookup" || r.Header.Get("X-Vault-Token") != "server-token" {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors": ["permission denied"]}`))
+			return
+		}
+
+		var body struct {
+			Token string `json:"token"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+
+		data, ok := tokens[body.Token]
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = w.Write([]byte(`{"errors": ["bad token"]}`))
+			return
+		}
+
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}))
+	t.Cleanup(s.Close)
+
+	client, err := api.NewClient(&api.Config{Address: s.URL})
+	require.NoError(t, err)
+	client.SetToken("server-token")
+
+	return client
+}
+
+func TestAuthorize(t *testing.T) {
+	client := newVault(t, map[string]map[string]any{
+		"s.infra": {
+			"display_name": "ldap-alice",
+			"entity_id":    "8d2b3f1c",
+			"policies":     []string{"default", "tfstate-infra"},
+		},
+		"s.reader": {
+			"display_name":      "ldap-bob",
+			"policies":          []string{"default"},
+			"identity_policies": []string{"tfstate-read-infra"},
+		},
+		"s.meta": {
+			"display_name": "token",
+			"policies":     []string{"default"},
+			"meta":         map[string]string{"terraform-backend": "apps/dev-*, apps/test"},
+		},
+	})
+
+	a := NewVaultAuth(client, config.VaultAuthConfig{
+		PolicyPrefix:     "tfstate-",
+		ReadPolicyPrefix: "tfstate-read-",
+		MetadataKey:      "terraform-backend",
+	})
+
+	tests := []struct {
+		name    string
+		token   string
+		op      auth.Operation
+		project string
+		state   string
+		ok      bool
+		err     string
+	}{
+		{"project policy", "s.infra", auth.Write, "infra", "prod", true, ""},
+		{"project policy other project", "s.infra", auth.Read, "apps", "prod", false, ""},
+		{"read policy reads", "s.reader", auth.Read, "infra", "prod", true, ""},
+		{"read policy writes", "s.reader", auth.Write, "infra", "prod", false, ""},
+		{"read policy isn't a project policy", "s.reader", auth.Write, "read-infra", "prod", false, ""},
+		{"read policy doesn't read prefixed project", "s.reader", auth.Read, "read-infra", "prod", false, ""},
+		{"project policy case-sensitive", "s.infra", auth.Read, "Infra", "prod", false, ""},
+		{"project policy longer project", "s.infra", auth.Read, "infra-prod", "prod", false, ""},
+		{"project policy shorter project", "s.infra", auth.Read, "infr", "prod", false, ""},
+		{"read policy case-sensitive", "s.reader", auth.Read, "INFRA", "prod", false, ""},
+		{"metadata pattern", "s.meta", auth.Delete, "apps", "dev-1", true, ""},
+		{"metadata other state", "s.meta", auth.Read, "apps", "prod", false, ""},
+		{"invalid token", "s.unknown", auth.Read, "infra", "prod", false, "bad token"},
+		{"empty token", "", auth.Read, "infra", "prod", false, "no vault token given"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := authorize(a, tt.token, &terraform.State{Project: tt.project, Name: tt.state}, tt.op)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+			} else {
+				require.NoError(t, err)
+			}
+			require.Equal(t, tt.ok, ok)
+		})
+	}
+
+	identity, err := a.Identify("s.infra")
+	require.NoError(t, err)
+	require.Equal(t, "8d2b3f1c", identity.Subject)
+	require.Equal(t, []string{"default", "tfstate-infra"}, identity.Groups)
+}
+
+func TestAuthorizeLongerPolicyPrefix(t *testing.T) {
+	client := newVault(t, map[string]map[string]any{
+		"s.writer": {"display_name": "ldap-alice", "policies": []string{"tfstate-rw-infra"}},
+		"s.reader": {"display_name": "ldap-bob", "policies": []string{"tfstate-infra"}},
+	})
+
+	// the policy prefix starts with the read policy prefix
+	a := NewVaultAuth(client, config.VaultAuthConfig{
+		PolicyPrefix:     "tfstate-rw-",
+		ReadPolicyPrefix: "tfstate-",
+	})
+
+	ok, err := authorize(a, "s.writer", &terraform.State{Project: "infra", Name: "prod"}, auth.Write)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = authorize(a, "s.writer", &terraform.State{Project: "rw-infra", Name: "prod"}, auth.Read)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	ok, err = authorize(a, "s.reader", &terraform.State{Project: "infra", Name: "prod"}, auth.Read)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = authorize(a, "s.reader", &terraform.State{Project: "infra", Name: "prod"}, auth.Write)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
+
+// authorize looks up the token and checks the operation like auth.Authenticate.
+func authorize(a *VaultAuth, token string, s *terraform.State, op auth.Operation) (bool, error) {
+	identity, err := a.Identify(token)
+	if err != nil {
+		return false, err
+	}
+
+	return identity.Authorize(s, op)
+}
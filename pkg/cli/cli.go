@@ -0,0 +1,332 @@
+// Package cli implements the terraform-backend command. Custom backends can be added by a main package, which
+// imports the packages registering them and calls Main.
+package cli
+
+import (
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/audit"
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/kms"
+	"github.com/nimbolus/terraform-backend/pkg/lock"
+	locallock "github.com/nimbolus/terraform-backend/pkg/lock/local"
+	"github.com/nimbolus/terraform-backend/pkg/migrate"
+	"github.com/nimbolus/terraform-backend/pkg/policy"
+	"github.com/nimbolus/terraform-backend/pkg/server"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/storage/mirror"
+)
+
+// Main parses the flags and runs the server or the given subcommand.
+func Main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "configuration file (yaml, toml or json)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+
+	switch flag.Arg(0) {
+	case "config":
+		configCommand(cfg, flag.Args()[1:])
+		return
+	case "policy":
+		policyCommand(cfg, flag.Args()[1:])
+		return
+	case "token":
+		tokenCommand(cfg, flag.Args()[1:])
+		return
+	}
+
+	if err := validate(cfg); err != nil {
+		log.Fatalf("invalid configuration:\n%v", err)
+	}
+
+	level, err := log.ParseLevel(cfg.LogLevel)
+	if err != nil {
+		log.Fatalf("failed to set log level: %v", err)
+	}
+	log.Infof("set log level to %s", level.String())
+	log.SetLevel(level)
+
+	if err := auth.Configure(cfg.Auth, cfg.Clients()); err != nil {
+		log.Fatal(err.Error())
+	}
+
+	if cfg.Auth.PolicyFile != "" {
+		p, err := policy.Load(cfg.Auth.PolicyFile)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		policy.Configure(p)
+		log.Infof("loaded policy with %d rules from %s", len(p.Rules), cfg.Auth.PolicyFile)
+	}
+
+	store, err := server.GetStorage(cfg)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	log.Infof("initialized %s storage backend", store.GetName())
+
+	locker, err := server.GetLocker(cfg)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	log.Infof("initialized %s lock backend", locker.GetName())
+
+	kms, err := server.GetKMS(cfg)
+	if err != nil {
+		log.Fatal(err.Error())
+	}
+	log.Infof("initialized %s KMS backend", kms.GetName())
+
+	if flag.NArg() > 0 {
+		switch flag.Arg(0) {
+		case "rotate":
+			rotate(store, locker, kms)
+		case "kms-migrate":
+			kmsMigrate(cfg, store, kms, flag.Args()[1:])
+		case "storage-migrate":
+			storageMigrate(cfg, store, locker, flag.Args()[1:])
+		default:
+			log.Fatalf("unknown command %s", flag.Arg(0))
+		}
+
+		return
+	}
+
+	if cfg.Audit.Sink != "" {
+		l, err := audit.New(cfg.Audit)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		audit.Configure(l)
+		log.Infof("writing audit log to %s", cfg.Audit.Sink)
+	}
+
+	server.ReapExpiredLocks(locker, cfg.Lock.ReapInterval)
+
+	addr := cfg.ListenAddr
+	metricsAddr := cfg.MetricsListenAddr
+
+	r := mux.NewRouter().StrictSlash(true)
+	r.HandleFunc("/states", server.ListHandler(store, locker))
+	r.HandleFunc("/state/{project}", server.ListHandler(store, locker))
+	r.HandleFunc("/state/{project}/{name}", server.StateHandler(store, locker, kms))
+	r.HandleFunc("/state/{project}/{name}/versions", server.VersionHandler(store, kms))
+	r.HandleFunc("/state/{project}/{name}/versions/{version}", server.VersionHandler(store, kms))
+	r.HandleFunc("/state/{project}/{name}/versions/{version}/restore", server.RestoreHandler(store, locker, kms))
+	r.HandleFunc("/health", server.HealthHandler)
+
+	if adminToken := cfg.AdminToken; adminToken != "" {
+		r.HandleFunc("/admin/locks", server.AdminLocksHandler(store, locker, adminToken))
+		r.HandleFunc("/admin/locks/{id}", server.AdminLocksHandler(store, locker, adminToken))
+		r.HandleFunc("/admin/kms/rotate", server.AdminRotateHandler(store, locker, kms, adminToken))
+	} else {
+		log.Info("admin API is disabled, because no admin token is set")
+	}
+
+	if addr != metricsAddr {
+		metricsRouter := mux.NewRouter().StrictSlash(true)
+		metricsRouter.HandleFunc("/metrics", server.MetricsHandler)
+
+		go func() {
+			log.Printf("listening on %s for metrics", metricsAddr)
+			err = http.ListenAndServe(metricsAddr, metricsRouter)
+			if err != nil {
+				log.Fatalf("failed to listen on %s for metrics: %v", metricsAddr, err)
+			}
+		}()
+	} else {
+		log.Printf("exposing metrics on default endpoint on %s", addr)
+		r.HandleFunc("/metrics", server.MetricsHandler)
+	}
+
+	server.RecordMetrics(store, locker, kms)
+
+	if cfg.TLSKey != "" && cfg.TLSCert != "" {
+		var tlsConfig *tls.Config
+		if tlsConfig, err = server.TLSConfig(cfg); err != nil {
+			log.Fatal(err.Error())
+		}
+
+		if tlsConfig != nil {
+			log.Printf("listening on %s with tls, client certificates are %s", addr, cfg.TLSClientAuth)
+		} else {
+			log.Printf("listening on %s with tls", addr)
+		}
+
+		srv := &http.Server{Addr: addr, Handler: r, TLSConfig: tlsConfig}
+		err = srv.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+	} else {
+		log.Printf("listening on %s", addr)
+		err = http.ListenAndServe(addr, r)
+	}
+	log.Fatalf("failed to listen on %s: %v", addr, err)
+}
+
+// rotate re-encrypts all stored states with the active KMS key and exits. The locks of the local lock backend only
+// exist in the memory of the server, so the states would be rotated while Terraform is writing them.
+func rotate(store storage.Storage, locker lock.Locker, k kms.KMS) {
+	if lock.Unwrap(locker).GetName() == locallock.Name {
+		log.Fatalf("the rotate command can't see the locks of the %s lock backend, use the admin API of the server instead: "+
+			"POST /admin/kms/rotate", locallock.Name)
+	}
+
+	result, err := server.RotateStates(store, locker, k)
+	if err != nil {
+		log.Fatalf("failed to rotate states: %v", err)
+	}
+
+	log.Infof("rotated %d states, %d unchanged", result.Rotated, result.Unchanged)
+
+	if len(result.Locked) > 0 {
+		log.Warnf("skipped %d locked states, run the rotation again later: %v", len(result.Locked), result.Locked)
+	}
+
+	if len(result.Failed) > 0 {
+		log.Fatalf("failed to rotate %d states: %v", len(result.Failed), result.Failed)
+	}
+}
+
+// kmsMigrate re-encrypts all stored states from the configured KMS to the target KMS and exits.
+func kmsMigrate(cfg *config.Config, store storage.Storage, source kms.KMS, args []string) {
+	flags := flag.NewFlagSet("kms-migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "decrypt and encrypt all states without writing them")
+	resume := flags.Bool("resume", false, "skip states which are already encrypted with the target KMS")
+	_ = flags.Parse(args)
+
+	if err := cfg.ValidateTargetKMS(); err != nil {
+		log.Fatalf("invalid target KMS configuration:\n%v", err)
+	}
+
+	target, err := server.GetTargetKMS(cfg)
+	if err != nil {
+		log.Fatalf("failed to initialize target KMS: %v", err)
+	}
+	log.Infof("migrating states from %s to %s KMS backend", source.GetName(), target.GetName())
+
+	result, err := migrate.KMS(store, source, target, migrate.KMSOptions{
+		DryRun: *dryRun,
+		Resume: *resume,
+	})
+	if err != nil {
+		log.Fatalf("failed to migrate states: %v", err)
+	}
+
+	log.Infof("migrated %d states, skipped %d states", result.Migrated, result.Skipped)
+
+	if len(result.Failed) > 0 {
+		log.Fatalf("failed to migrate %d states, fix the errors and run the migration again with --resume: %v",
+			len(result.Failed), result.Failed)
+	}
+}
+
+// storageMigrate copies all states from the configured storage backend to the target storage backend and exits.
+func storageMigrate(cfg *config.Config, store storage.Storage, locker lock.Locker, args []string) {
+	flags := flag.NewFlagSet("storage-migrate", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false, "compare all states without copying them")
+	_ = flags.Parse(args)
+
+	var source, target storage.Storage
+
+	if m, ok := store.(*mirror.MirrorStorage); ok {
+		// the mirror already writes to the target storage backend
+		source, target = m.Primary(), m.Secondary()
+	} else {
+		if err := cfg.ValidateTargetStorage(); err != nil {
+			log.Fatalf("invalid target storage configuration:\n%v", err)
+		}
+
+		var err error
+		if target, err = server.GetTargetStorage(cfg); err != nil {
+			log.Fatalf("failed to initialize target storage backend: %v", err)
+		}
+		source = store
+	}
+	log.Infof("migrating states from %s to %s storage backend", source.GetName(), target.GetName())
+
+	result, err := migrate.Storage(source, target, locker, migrate.StorageOptions{
+		DryRun: *dryRun,
+	})
+	if err != nil {
+		log.Fatalf("failed to migrate states: %v", err)
+	}
+
+	log.Infof("copied %d states, %d states already up to date", result.Migrated, result.Skipped)
+
+	if len(result.Locked) > 0 {
+		log.Warnf("skipped %d locked states, run the migration again later: %v", len(result.Locked), result.Locked)
+	}
+
+	if len(result.Failed) > 0 {
+		log.Fatalf("failed to migrate %d states: %v", len(result.Failed), result.Failed)
+	}
+}
+
+// configCommand runs the config subcommands and exits.
+func configCommand(cfg *config.Config, args []string) {
+	if len(args) == 0 || args[0] != "validate" {
+		log.Fatal("usage: terraform-backend [--config <file>] config validate")
+	}
+
+	if err := validate(cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("configuration is valid")
+}
+
+// validate checks the configuration, whether the configured backends are registered and the policy file.
+func validate(cfg *config.Config) error {
+	errs := []error{cfg.Validate(), server.ValidateBackends(cfg)}
+
+	if cfg.Auth.PolicyFile != "" {
+		_, err := policy.Load(cfg.Auth.PolicyFile)
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
+
+// policyCommand runs the test cases of the policy file (the configured one, if no file is given) and exits.
+func policyCommand(cfg *config.Config, args []string) {
+	if len(args) == 0 || args[0] != "test" || len(args) > 2 {
+		log.Fatal("usage: terraform-backend [--config <file>] policy test [<policy file>]")
+	}
+
+	file := cfg.Auth.PolicyFile
+	if len(args) == 2 {
+		file = args[1]
+	}
+
+	if file == "" {
+		log.Fatal("no policy file given and auth.policy_file isn't set")
+	}
+
+	p, err := policy.Load(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	if failures := p.RunTests(); len(failures) > 0 {
+		fmt.Fprintf(os.Stderr, "%d of %d policy tests failed:\n%v\n", len(failures), len(p.Tests), errors.Join(failures...))
+		os.Exit(1)
+	}
+
+	fmt.Printf("%d policy tests passed\n", len(p.Tests))
+}
@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth/token"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+const tokenUsage = `usage: terraform-backend [--config <file>] token <command>
+
+commands:
+  create --owner <owner> --states <patterns> [--permissions <operations>] [--expires <duration>] [--hash argon2id|bcrypt]
+  list
+  revoke <id>`
+
+// tokenCommand manages the API tokens of the token auth backend and exits.
+func tokenCommand(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		log.Fatal(tokenUsage)
+	}
+
+	store, err := token.NewStore(cfg.Auth.Token, cfg.Clients())
+	if err != nil {
+		log.Fatalf("failed to initialize token store: %v", err)
+	}
+
+	switch args[0] {
+	case "create":
+		createToken(store, args[1:])
+	case "list":
+		listTokens(store)
+	case "revoke":
+		if len(args) != 2 {
+			log.Fatal(tokenUsage)
+		}
+
+		if err := store.DeleteToken(args[1]); err != nil {
+			log.Fatalf("failed to revoke token %s: %v", args[1], err)
+		}
+
+		fmt.Printf("revoked token %s\n", args[1])
+	default:
+		log.Fatal(tokenUsage)
+	}
+}
+
+func createToken(store token.Store, args []string) {
+	flags := flag.NewFlagSet("token create", flag.ExitOnError)
+	owner := flags.String("owner", "", "owner of the token (required)")
+	states := flags.String("states", "", "glob patterns of <project>/<name> separated by commas (required)")
+	permissions := flags.String("permissions", "", "operations separated by commas (default all)")
+	expires := flags.Duration("expires", 0, "lifetime of the token (default no expiry)")
+	hash := flags.String("hash", token.Argon2id, "hash algorithm (argon2id or bcrypt)")
+	_ = flags.Parse(args)
+
+	if *owner == "" || *states == "" {
+		log.Fatal("--owner and --states are required")
+	}
+
+	t := &token.Token{
+		Owner:       *owner,
+		States:      splitList(*states),
+		Permissions: splitList(*permissions),
+	}
+
+	if *expires > 0 {
+		t.Expires = time.Now().Add(*expires).UTC()
+	}
+
+	secret, err := token.Create(store, *hash, t)
+	if err != nil {
+		log.Fatalf("failed to create token: %v", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "created token %s, it can't be shown again:\n", t.ID)
+	fmt.Println(secret)
+}
+
+func listTokens(store token.Store) {
+	tokens, err := store.ListTokens()
+	if err != nil {
+		log.Fatalf("failed to list tokens: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tOWNER\tSTATES\tPERMISSIONS\tCREATED\tEXPIRES")
+
+	for _, t := range tokens {
+		permissions, expires := "*", "never"
+		if len(t.Permissions) > 0 {
+			permissions = strings.Join(t.Permissions, ",")
+		}
+		if !t.Expires.IsZero() {
+			expires = t.Expires.Format(time.RFC3339)
+			if t.Expired(time.Now()) {
+				expires += " (expired)"
+			}
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Owner, strings.Join(t.States, ","), permissions,
+			t.Created.Format(time.RFC3339), expires)
+	}
+
+	_ = w.Flush()
+}
+
+// splitList splits a comma separated list and drops empty items.
+func splitList(s string) []string {
+	var items []string
+
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
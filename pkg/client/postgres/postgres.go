@@ -6,16 +6,11 @@ import (
 
 	_ "github.com/lib/pq"
 
-	"github.com/nimbolus/terraform-backend/internal"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 )
 
-func NewClient() (*sql.DB, error) {
-	connStr, err := internal.SecretEnvOrFile("postgres_connection", "postgres_connection_file")
-	if err != nil {
-		return nil, fmt.Errorf("getting postgres connection string: %w", err)
-	}
-
-	db, err := sql.Open("postgres", connStr)
+func NewClient(cfg config.PostgresConfig) (*sql.DB, error) {
+	db, err := sql.Open("postgres", cfg.Connection)
 	if err != nil {
 		return nil, fmt.Errorf("initializing postgres client: %w", err)
 	}
@@ -1,23 +1,19 @@
 package redis
 
 import (
-	"fmt"
 	"time"
 
 	redigo "github.com/gomodule/redigo/redis"
-	"github.com/spf13/viper"
 
-	"github.com/nimbolus/terraform-backend/internal"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 )
 
-func NewPool() *redigo.Pool {
-	viper.SetDefault("redis_addr", "localhost:6379")
-
+func NewPool(cfg config.RedisConfig) *redigo.Pool {
 	return &redigo.Pool{
 		MaxIdle:     3,
 		IdleTimeout: 240 * time.Second,
 		Dial: func() (redigo.Conn, error) {
-			c, err := redigo.Dial("tcp", viper.GetString("redis_addr"))
+			c, err := redigo.Dial("tcp", cfg.Addr)
 			if err != nil {
 				if c != nil {
 					c.Close()
@@ -26,13 +22,8 @@ func NewPool() *redigo.Pool {
 				return nil, err
 			}
 
-			pass, err := internal.SecretEnvOrFile("redis_password", "redis_password_file")
-			if err != nil {
-				return nil, fmt.Errorf("getting redis password: %w", err)
-			}
-
-			if pass != "" {
-				if _, err := c.Do("AUTH"); err != nil {
+			if cfg.Password != "" {
+				if _, err := c.Do("AUTH", cfg.Password); err != nil {
 					c.Close()
 
 					return nil, err
@@ -5,9 +5,9 @@ import (
 	"testing"
 
 	redigo "github.com/gomodule/redigo/redis"
-	"github.com/spf13/viper"
 
 	"github.com/nimbolus/terraform-backend/pkg/client/redis"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 )
 
 func NewPoolIfIntegrationTest(t testing.TB) *redigo.Pool {
@@ -17,9 +17,7 @@ func NewPoolIfIntegrationTest(t testing.TB) *redigo.Pool {
 		t.Skip("env var INTEGRATION_TEST not set")
 	}
 
-	t.Setenv("REDIS_ADDR", "localhost:6379")
-
-	viper.AutomaticEnv()
-
-	return redis.NewPool()
+	return redis.NewPool(config.RedisConfig{
+		Addr: "localhost:6379",
+	})
 }
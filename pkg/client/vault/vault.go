@@ -5,41 +5,34 @@ import (
 	"os"
 
 	vault "github.com/hashicorp/vault/api"
-	"github.com/spf13/viper"
 
-	"github.com/nimbolus/terraform-backend/internal"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 )
 
 const (
 	k8sServiceAccountFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
 )
 
-func NewVaultClient() (*vault.Client, error) {
-	config := vault.DefaultConfig()
-	if config.Address = viper.GetString("vault_addr"); config.Address == "" {
+func NewVaultClient(cfg config.VaultConfig) (*vault.Client, error) {
+	vaultConfig := vault.DefaultConfig()
+	if vaultConfig.Address = cfg.Addr; vaultConfig.Address == "" {
 		return nil, fmt.Errorf("unable to initialize vault client: no vault address defined")
 	}
 
-	client, err := vault.NewClient(config)
+	client, err := vault.NewClient(vaultConfig)
 	if err != nil {
 		return nil, fmt.Errorf("unable to initialize vault client: %w", err)
 	}
 
-	token, err := internal.SecretEnvOrFile("vault_token", "vault_token_file")
-	if err != nil {
-		return nil, fmt.Errorf("getting vault token: %w", err)
-	}
-
-	if token != "" {
-		client.SetToken(token)
-	} else if role := viper.GetString("vault_kube_auth_role"); role != "" {
+	if cfg.Token != "" {
+		client.SetToken(cfg.Token)
+	} else if role := cfg.KubeAuth.Role; role != "" {
 		jwt, err := os.ReadFile(k8sServiceAccountFile)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read k8s service account: %w", err)
 		}
 
-		viper.SetDefault("vault_kube_auth_name", "kubernetes")
-		path := fmt.Sprintf("auth/%s/login", viper.GetString("vault_kube_auth_name"))
+		path := fmt.Sprintf("auth/%s/login", cfg.KubeAuth.Name)
 		params := map[string]any{
 			"jwt":  string(jwt),
 			"role": role,
@@ -5,10 +5,10 @@ import (
 	"testing"
 
 	"github.com/hashicorp/vault/api"
-	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
 
 	"github.com/nimbolus/terraform-backend/pkg/client/vault"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 )
 
 func NewIfIntegrationTest(t testing.TB) *api.Client {
@@ -18,12 +18,10 @@ func NewIfIntegrationTest(t testing.TB) *api.Client {
 		t.Skip("env var INTEGRATION_TEST not set")
 	}
 
-	t.Setenv("VAULT_ADDR", "http://localhost:8200")
-	t.Setenv("VAULT_TOKEN", "dev-only-token")
-
-	viper.AutomaticEnv()
-
-	c, err := vault.NewVaultClient()
+	c, err := vault.NewVaultClient(config.VaultConfig{
+		Addr:  "http://localhost:8200",
+		Token: "dev-only-token",
+	})
 	require.NoError(t, err)
 
 	return c
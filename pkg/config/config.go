@@ -0,0 +1,644 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// Config is the configuration of the server. Every key can be set in the configuration file (e.g. storage.fs.dir)
+// or by the environment variable with the same name in upper case and dots replaced by underscores
+// (e.g. STORAGE_FS_DIR), which takes precedence.
+type Config struct {
+	LogLevel          string `mapstructure:"log_level"`
+	ListenAddr        string `mapstructure:"listen_addr"`
+	MetricsListenAddr string `mapstructure:"metrics_listen_addr"`
+	TLSKey            string `mapstructure:"tls_key"`
+	TLSCert           string `mapstructure:"tls_cert"`
+	TLSClientCA       string `mapstructure:"tls_client_ca"`
+	TLSClientAuth     string `mapstructure:"tls_client_auth"`
+	AdminToken        string `mapstructure:"admin_token"`
+	AdminTokenFile    string `mapstructure:"admin_token_file"`
+	// ForceUnlockEnabled is a top level key for compatibility with the FORCE_UNLOCK_ENABLED variable
+	ForceUnlockEnabled bool `mapstructure:"force_unlock_enabled"`
+
+	Storage StorageConfig `mapstructure:"storage"`
+	Lock    LockConfig    `mapstructure:"lock"`
+	KMS     KMSConfig     `mapstructure:"kms"`
+	Auth    AuthConfig    `mapstructure:"auth"`
+	Audit   AuditConfig   `mapstructure:"audit"`
+
+	Postgres PostgresConfig `mapstructure:"postgres"`
+	Redis    RedisConfig    `mapstructure:"redis"`
+	Vault    VaultConfig    `mapstructure:"vault"`
+
+	// the target backends are used by the storage-migrate and kms-migrate commands and for mirroring
+	TargetStorage  StorageConfig  `mapstructure:"target_storage"`
+	TargetPostgres PostgresConfig `mapstructure:"target_postgres"`
+	TargetKMS      KMSConfig      `mapstructure:"target_kms"`
+}
+
+type StorageConfig struct {
+	Backend       string                `mapstructure:"backend"`
+	MirrorEnabled bool                  `mapstructure:"mirror_enabled"`
+	FS            FSStorageConfig       `mapstructure:"fs"`
+	Postgres      PostgresStorageConfig `mapstructure:"postgres"`
+	S3            S3StorageConfig       `mapstructure:"s3"`
+	// Custom contains the settings of the backends, which aren't built in, by the name of the backend
+	// (e.g. storage.gcs.bucket), they can only be set in the configuration file (see DecodeCustom)
+	Custom map[string]any `mapstructure:",remain"`
+}
+
+type FSStorageConfig struct {
+	Dir string `mapstructure:"dir"`
+}
+
+type PostgresStorageConfig struct {
+	Table string `mapstructure:"table"`
+}
+
+type S3StorageConfig struct {
+	Endpoint      string `mapstructure:"endpoint"`
+	UseSSL        bool   `mapstructure:"use_ssl"`
+	AccessKey     string `mapstructure:"access_key"`
+	SecretKey     string `mapstructure:"secret_key"`
+	SecretKeyFile string `mapstructure:"secret_key_file"`
+	Bucket        string `mapstructure:"bucket"`
+}
+
+type LockConfig struct {
+	Backend      string             `mapstructure:"backend"`
+	TTL          time.Duration      `mapstructure:"ttl"`
+	ReapInterval time.Duration      `mapstructure:"reap_interval"`
+	Postgres     PostgresLockConfig `mapstructure:"postgres"`
+	// Custom contains the settings of the backends, which aren't built in, by the name of the backend
+	// (e.g. lock.etcd.endpoints), they can only be set in the configuration file (see DecodeCustom)
+	Custom map[string]any `mapstructure:",remain"`
+}
+
+type PostgresLockConfig struct {
+	Table string `mapstructure:"table"`
+}
+
+type KMSConfig struct {
+	Backend string `mapstructure:"backend"`
+	Key     string `mapstructure:"key"`
+	KeyFile string `mapstructure:"key_file"`
+	// RetiredKeys is a list of keys separated by commas or whitespace
+	RetiredKeys           string           `mapstructure:"retired_keys"`
+	RetiredKeysFile       string           `mapstructure:"retired_keys_file"`
+	VaultKeyPath          string           `mapstructure:"vault_key_path"`
+	Transit               TransitKMSConfig `mapstructure:"transit"`
+	EnvelopeEnabled       bool             `mapstructure:"envelope_enabled"`
+	RequireAssociatedData bool             `mapstructure:"require_associated_data"`
+	// Custom contains the settings of the backends, which aren't built in, by the name of the backend
+	// (e.g. kms.awskms.key_id), they can only be set in the configuration file (see DecodeCustom)
+	Custom map[string]any `mapstructure:",remain"`
+}
+
+type TransitKMSConfig struct {
+	Engine  string `mapstructure:"engine"`
+	Key     string `mapstructure:"key"`
+	Derived bool   `mapstructure:"derived"`
+}
+
+type AuthConfig struct {
+	// PolicyFile contains the rules, which are evaluated after the authentication of a request
+	PolicyFile string `mapstructure:"policy_file"`
+	// UserBackends is the order, in which the enabled auth backends authenticating user accounts (e.g. htpasswd and
+	// ldap) are tried, the ones which aren't listed are tried afterwards by name
+	UserBackends []string `mapstructure:"user_backends"`
+
+	Basic  BasicAuthConfig `mapstructure:"basic"`
+	JWT    JWTAuthConfig   `mapstructure:"jwt"`
+	GitLab CIAuthConfig    `mapstructure:"gitlab"`
+	GitHub CIAuthConfig    `mapstructure:"github"`
+	Token  TokenAuthConfig `mapstructure:"token"`
+	MTLS   MTLSAuthConfig  `mapstructure:"mtls"`
+	// Htpasswd authenticates user accounts, the basic auth username is the user instead of the name of the backend
+	Htpasswd HtpasswdAuthConfig `mapstructure:"htpasswd"`
+	// LDAP authenticates directory accounts like Htpasswd
+	LDAP LDAPAuthConfig `mapstructure:"ldap"`
+	// Vault authenticates Vault tokens, the basic auth password is the token
+	Vault VaultAuthConfig `mapstructure:"vault"`
+	// Custom contains the settings of the backends, which aren't built in, by the name of the backend
+	// (e.g. auth.oauth.client_id), they can only be set in the configuration file (see DecodeCustom)
+	Custom map[string]any `mapstructure:",remain"`
+}
+
+type BasicAuthConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+}
+
+type JWTAuthConfig struct {
+	// OIDCIssuerURL is used to verify the tokens, JWT auth is disabled if it's empty and no issuers are set
+	OIDCIssuerURL string `mapstructure:"oidc_issuer_url"`
+	// Audiences, ProjectClaim, StateClaim, PermissionsClaim, GroupsClaim and Match configure the issuer set by
+	// OIDCIssuerURL
+	Audiences        []string `mapstructure:"audiences"`
+	ProjectClaim     string   `mapstructure:"project_claim"`
+	StateClaim       string   `mapstructure:"state_claim"`
+	PermissionsClaim string   `mapstructure:"permissions_claim"`
+	GroupsClaim      string   `mapstructure:"groups_claim"`
+	Match            string   `mapstructure:"match"`
+	// Issuers are additional trusted issuers, which can only be set in the configuration file
+	Issuers []JWTIssuerConfig `mapstructure:"issuers"`
+	// JWKSRefreshInterval is the interval the signing keys of the issuer are refreshed in the background
+	JWKSRefreshInterval time.Duration `mapstructure:"jwks_refresh_interval"`
+}
+
+type JWTIssuerConfig struct {
+	URL string `mapstructure:"url"`
+	// Audiences contains the accepted values of the aud claim, it isn't checked if it's empty
+	Audiences []string `mapstructure:"audiences"`
+	// ProjectClaim and StateClaim are the paths (separated by dots) of the claims containing the patterns
+	// of the accessible projects and states
+	ProjectClaim string `mapstructure:"project_claim"`
+	StateClaim   string `mapstructure:"state_claim"`
+	// PermissionsClaim is the path of the claim containing the permitted operations, all operations are permitted
+	// if the token doesn't contain it
+	PermissionsClaim string `mapstructure:"permissions_claim"`
+	// GroupsClaim is the path of the claim containing the groups of the identity used by policies
+	GroupsClaim string `mapstructure:"groups_claim"`
+	// Match is the syntax of the patterns (exact, glob or regex)
+	Match string `mapstructure:"match"`
+}
+
+// TrustedIssuers returns the issuer set by OIDCIssuerURL and the additional issuers. The claims and the pattern
+// syntax of the additional issuers default to the ones of OIDCIssuerURL.
+func (c JWTAuthConfig) TrustedIssuers() []JWTIssuerConfig {
+	var issuers []JWTIssuerConfig
+
+	if c.OIDCIssuerURL != "" {
+		issuers = append(issuers, JWTIssuerConfig{
+			URL:              c.OIDCIssuerURL,
+			Audiences:        c.Audiences,
+			ProjectClaim:     c.ProjectClaim,
+			StateClaim:       c.StateClaim,
+			PermissionsClaim: c.PermissionsClaim,
+			GroupsClaim:      c.GroupsClaim,
+			Match:            c.Match,
+		})
+	}
+
+	for _, issuer := range c.Issuers {
+		if issuer.ProjectClaim == "" {
+			issuer.ProjectClaim = c.ProjectClaim
+		}
+
+		if issuer.StateClaim == "" {
+			issuer.StateClaim = c.StateClaim
+		}
+
+		if issuer.PermissionsClaim == "" {
+			issuer.PermissionsClaim = c.PermissionsClaim
+		}
+
+		if issuer.GroupsClaim == "" {
+			issuer.GroupsClaim = c.GroupsClaim
+		}
+
+		if issuer.Match == "" {
+			issuer.Match = c.Match
+		}
+
+		issuers = append(issuers, issuer)
+	}
+
+	return issuers
+}
+
+type TokenAuthConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Store is the backend of the hashed tokens (file or postgres)
+	Store    string              `mapstructure:"store"`
+	File     string              `mapstructure:"file"`
+	Postgres PostgresTokenConfig `mapstructure:"postgres"`
+}
+
+type PostgresTokenConfig struct {
+	Table string `mapstructure:"table"`
+}
+
+// CIAuthConfig configures the authentication with the OIDC tokens of CI jobs (e.g. GitLab CI or GitHub Actions).
+type CIAuthConfig struct {
+	Enabled   bool   `mapstructure:"enabled"`
+	IssuerURL string `mapstructure:"issuer_url"`
+	// Audiences contains the accepted values of the aud claim
+	Audiences []string `mapstructure:"audiences"`
+	// Match is the syntax of the patterns of the rules (exact, glob or regex)
+	Match string `mapstructure:"match"`
+	// Rules grant access to states, they can only be set in the configuration file
+	Rules []CIRuleConfig `mapstructure:"rules"`
+}
+
+// CIRuleConfig grants access to the states matching the project and state patterns, if all claim patterns match.
+// The project and state patterns can contain claims (e.g. ${namespace_path}).
+type CIRuleConfig struct {
+	Claims  map[string]string `mapstructure:"claims"`
+	Project string            `mapstructure:"project"`
+	State   string            `mapstructure:"state"`
+	// Permissions are the permitted operations (read, lock, write, delete or *), all if it's empty
+	Permissions []string `mapstructure:"permissions"`
+}
+
+type HtpasswdAuthConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// File is an htpasswd file with bcrypt hashes (htpasswd -B)
+	File string `mapstructure:"file"`
+	// Users grant access to projects, they can only be set in the configuration file
+	Users []HtpasswdUserConfig `mapstructure:"users"`
+}
+
+// HtpasswdUserConfig grants a user access to the states of the projects matching the glob patterns.
+type HtpasswdUserConfig struct {
+	Name     string   `mapstructure:"name"`
+	Projects []string `mapstructure:"projects"`
+	// Permissions are the permitted operations (read, lock, write, delete or *), all if it's empty
+	Permissions []string `mapstructure:"permissions"`
+	// Groups are used by policies
+	Groups []string `mapstructure:"groups"`
+}
+
+// LDAPAuthConfig configures the authentication of directory accounts, which bind with their username and password.
+type LDAPAuthConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	URL      string `mapstructure:"url"`
+	StartTLS bool   `mapstructure:"start_tls"`
+	// UserDN is the DN users bind with, {username} is replaced by the username
+	// (e.g. uid={username},ou=people,dc=example,dc=org)
+	UserDN      string `mapstructure:"user_dn"`
+	GroupBaseDN string `mapstructure:"group_base_dn"`
+	// GroupFilter finds the groups of the user, {dn} is replaced by the DN of the user and {username} by the username
+	GroupFilter string `mapstructure:"group_filter"`
+	// GroupAttribute is the attribute of the group names
+	GroupAttribute string        `mapstructure:"group_attribute"`
+	Timeout        time.Duration `mapstructure:"timeout"`
+	// Groups grant access to projects, they can only be set in the configuration file
+	Groups []LDAPGroupConfig `mapstructure:"groups"`
+}
+
+// LDAPGroupConfig grants the members of a group access to the states of the projects matching the glob patterns.
+type LDAPGroupConfig struct {
+	Name     string   `mapstructure:"name"`
+	Projects []string `mapstructure:"projects"`
+	// Permissions are the permitted operations (read, lock, write, delete or *), all if it's empty
+	Permissions []string `mapstructure:"permissions"`
+}
+
+// VaultAuthConfig configures the authentication with Vault tokens, which are looked up with the Vault client of the
+// server.
+type VaultAuthConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// PolicyPrefix is the prefix of the policies granting all operations on a project (<prefix><project>)
+	PolicyPrefix string `mapstructure:"policy_prefix"`
+	// ReadPolicyPrefix is the prefix of the policies granting read access to a project (<prefix><project>)
+	ReadPolicyPrefix string `mapstructure:"read_policy_prefix"`
+	// MetadataKey is the key of the token metadata listing glob patterns of <project>/<name>, which grant all
+	// operations, metadata is ignored if it's empty
+	MetadataKey string `mapstructure:"metadata_key"`
+}
+
+// AuditConfig configures the audit log of the state requests.
+type AuditConfig struct {
+	// Sink is where the events are written to (file, stdout or syslog), the audit log is disabled if it's empty
+	Sink   string            `mapstructure:"sink"`
+	File   string            `mapstructure:"file"`
+	Syslog AuditSyslogConfig `mapstructure:"syslog"`
+}
+
+type AuditSyslogConfig struct {
+	// Network is tcp, udp or unix, the local syslog daemon is used if it's empty
+	Network string `mapstructure:"network"`
+	Address string `mapstructure:"address"`
+	Tag     string `mapstructure:"tag"`
+}
+
+// MTLSAuthConfig configures the authentication with the client certificates verified by tls_client_ca.
+type MTLSAuthConfig struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Match is the syntax of the patterns of the rules (exact, glob or regex)
+	Match string `mapstructure:"match"`
+	// Rules grant access to states, they can only be set in the configuration file
+	Rules []MTLSRuleConfig `mapstructure:"rules"`
+}
+
+// MTLSRuleConfig grants access to the states matching the project and state patterns, if all certificate patterns,
+// which are set, match.
+type MTLSRuleConfig struct {
+	// Subject is matched against the distinguished name of the subject (e.g. CN=runner,O=infra)
+	Subject    string `mapstructure:"subject"`
+	CommonName string `mapstructure:"common_name"`
+	// URI, DNS and Email match if any subject alternative name of the type matches, URI SANs contain SPIFFE IDs
+	// (e.g. spiffe://cluster.local/ns/infra/sa/terraform)
+	URI     string `mapstructure:"uri"`
+	DNS     string `mapstructure:"dns"`
+	Email   string `mapstructure:"email"`
+	Project string `mapstructure:"project"`
+	State   string `mapstructure:"state"`
+	// Permissions are the permitted operations (read, lock, write, delete or *), all if it's empty
+	Permissions []string `mapstructure:"permissions"`
+}
+
+// ClientsConfig contains the configuration of the clients, which are shared by the backends.
+type ClientsConfig struct {
+	Postgres PostgresConfig
+	Redis    RedisConfig
+	Vault    VaultConfig
+}
+
+type PostgresConfig struct {
+	Connection     string `mapstructure:"connection"`
+	ConnectionFile string `mapstructure:"connection_file"`
+}
+
+type RedisConfig struct {
+	Addr         string `mapstructure:"addr"`
+	Password     string `mapstructure:"password"`
+	PasswordFile string `mapstructure:"password_file"`
+}
+
+type VaultConfig struct {
+	Addr      string              `mapstructure:"addr"`
+	Token     string              `mapstructure:"token"`
+	TokenFile string              `mapstructure:"token_file"`
+	KubeAuth  VaultKubeAuthConfig `mapstructure:"kube_auth"`
+}
+
+type VaultKubeAuthConfig struct {
+	Role string `mapstructure:"role"`
+	Name string `mapstructure:"name"`
+}
+
+// Default returns the configuration used for all keys, which are neither set in the configuration file
+// nor by environment variables.
+func Default() *Config {
+	storage := StorageConfig{
+		Backend:  "fs",
+		FS:       FSStorageConfig{Dir: "./states"},
+		Postgres: PostgresStorageConfig{Table: "states"},
+		S3: S3StorageConfig{
+			Endpoint: "s3.amazonaws.com",
+			UseSSL:   true,
+			Bucket:   "terraform-state",
+		},
+	}
+
+	kms := KMSConfig{
+		Backend: "local",
+	}
+
+	return &Config{
+		LogLevel:           "info",
+		ListenAddr:         ":8080",
+		MetricsListenAddr:  ":8081",
+		TLSClientAuth:      "optional",
+		ForceUnlockEnabled: true,
+		Storage:            storage,
+		Lock: LockConfig{
+			Backend:      "local",
+			TTL:          12 * time.Hour,
+			ReapInterval: time.Minute,
+			Postgres:     PostgresLockConfig{Table: "locks"},
+		},
+		KMS: kms,
+		Auth: AuthConfig{
+			UserBackends: []string{"htpasswd", "ldap"},
+			Basic:        BasicAuthConfig{Enabled: true},
+			JWT: JWTAuthConfig{
+				ProjectClaim:        "terraform-backend.project",
+				StateClaim:          "terraform-backend.state",
+				PermissionsClaim:    "terraform-backend.permissions",
+				GroupsClaim:         "groups",
+				Match:               "exact",
+				JWKSRefreshInterval: 15 * time.Minute,
+			},
+			GitLab: CIAuthConfig{
+				IssuerURL: "https://gitlab.com",
+				Match:     "glob",
+			},
+			GitHub: CIAuthConfig{
+				IssuerURL: "https://token.actions.githubusercontent.com",
+				Match:     "glob",
+			},
+			MTLS: MTLSAuthConfig{
+				Match: "glob",
+			},
+			Vault: VaultAuthConfig{
+				PolicyPrefix:     "tfstate-",
+				ReadPolicyPrefix: "tfstate-read-",
+			},
+			LDAP: LDAPAuthConfig{
+				GroupFilter:    "(member={dn})",
+				GroupAttribute: "cn",
+				Timeout:        5 * time.Second,
+			},
+			Htpasswd: HtpasswdAuthConfig{
+				File: "./htpasswd",
+			},
+			Token: TokenAuthConfig{
+				Store:    "file",
+				File:     "./tokens.json",
+				Postgres: PostgresTokenConfig{Table: "tokens"},
+			},
+		},
+		Audit: AuditConfig{
+			File:   "./audit.log",
+			Syslog: AuditSyslogConfig{Tag: "terraform-backend"},
+		},
+		Redis: RedisConfig{
+			Addr: "localhost:6379",
+		},
+		Vault: VaultConfig{
+			KubeAuth: VaultKubeAuthConfig{Name: "kubernetes"},
+		},
+		TargetStorage: storage,
+		TargetKMS:     kms,
+	}
+}
+
+// Clients returns the configuration of the clients used by the backends.
+func (c *Config) Clients() ClientsConfig {
+	return ClientsConfig{
+		Postgres: c.Postgres,
+		Redis:    c.Redis,
+		Vault:    c.Vault,
+	}
+}
+
+// TargetClients returns the configuration of the clients used by the target backends.
+func (c *Config) TargetClients() ClientsConfig {
+	clients := c.Clients()
+	clients.Postgres = c.TargetPostgres
+
+	return clients
+}
+
+// Load reads the configuration file (if file isn't empty) and the environment variables. The file format is derived
+// from the file extension (e.g. yaml, toml or json). Unknown keys in the file are rejected, except in the sections
+// of backends, which aren't built in (e.g. storage.gcs.bucket). Secrets which are set
+// by a file (e.g. kms.key_file) are read, so that only the value (e.g. kms.key) has to be used.
+func Load(file string) (*Config, error) {
+	v := viper.New()
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+
+	// environment variables are only considered for known keys, so every key gets a default
+	known, customSections := setDefaults(v, "", reflect.ValueOf(Default()).Elem())
+
+	if file != "" {
+		v.SetConfigFile(file)
+
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("reading configuration file %s: %w", file, err)
+		}
+
+		var unknown []string
+
+		for _, key := range v.AllKeys() {
+			if !slices.Contains(known, key) && !isCustomKey(key, known, customSections) {
+				unknown = append(unknown, key)
+			}
+		}
+
+		if len(unknown) > 0 {
+			slices.Sort(unknown)
+			return nil, fmt.Errorf("unknown keys in configuration file %s: %s", file, strings.Join(unknown, ", "))
+		}
+	}
+
+	cfg := &Config{}
+
+	if err := v.UnmarshalExact(cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	if err := readSecretFiles("", reflect.ValueOf(cfg).Elem()); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// setDefaults sets the default of every key and returns the keys and the sections, which contain the settings of
+// backends, which aren't built in.
+func setDefaults(v *viper.Viper, prefix string, val reflect.Value) ([]string, []string) {
+	var keys, customSections []string
+
+	for i := 0; i < val.NumField(); i++ {
+		tag := val.Type().Field(i).Tag.Get("mapstructure")
+		if strings.HasSuffix(tag, ",remain") {
+			customSections = append(customSections, strings.TrimSuffix(prefix, "."))
+			continue
+		}
+
+		key := prefix + tag
+
+		if field := val.Field(i); field.Kind() == reflect.Struct {
+			k, c := setDefaults(v, key+".", field)
+			keys, customSections = append(keys, k...), append(customSections, c...)
+		} else {
+			v.SetDefault(key, field.Interface())
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, customSections
+}
+
+// isCustomKey returns whether the key belongs to the section of a backend, which isn't built in
+// (e.g. storage.gcs.bucket). The sections of the built-in backends only contain known keys, so typos are still found.
+func isCustomKey(key string, known, customSections []string) bool {
+	for _, section := range customSections {
+		rest, ok := strings.CutPrefix(key, section+".")
+		if !ok {
+			continue
+		}
+
+		name, _, ok := strings.Cut(rest, ".")
+		if !ok {
+			// the settings of a backend are always a section
+			return false
+		}
+
+		backend := section + "." + name
+
+		return !slices.ContainsFunc(known, func(k string) bool {
+			return k == backend || strings.HasPrefix(k, backend+".")
+		})
+	}
+
+	return false
+}
+
+// DecodeCustom decodes the settings of a backend, which isn't built in, from its section in custom (e.g. the
+// Custom field of StorageConfig) into target. Unknown keys are rejected and target is left as is, if the section
+// isn't set. Like all keys, the keys of the section are lower case.
+func DecodeCustom(custom map[string]any, name string, target any) error {
+	section, ok := custom[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+
+	settings, ok := section.(map[string]any)
+	if !ok {
+		return fmt.Errorf("settings of backend %s are not a section", name)
+	}
+
+	v := viper.New()
+	if err := v.MergeConfigMap(settings); err != nil {
+		return fmt.Errorf("reading settings of backend %s: %w", name, err)
+	}
+
+	if err := v.UnmarshalExact(target); err != nil {
+		return fmt.Errorf("invalid settings of backend %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// readSecretFiles sets every field with a sibling field with the suffix _file (e.g. key and key_file)
+// to the content of the file, if the file is set.
+func readSecretFiles(prefix string, val reflect.Value) error {
+	fields := make(map[string]reflect.Value)
+
+	for i := 0; i < val.NumField(); i++ {
+		fields[val.Type().Field(i).Tag.Get("mapstructure")] = val.Field(i)
+	}
+
+	for name, field := range fields {
+		if field.Kind() == reflect.Struct {
+			if err := readSecretFiles(prefix+name+".", field); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		secretName := strings.TrimSuffix(name, "_file")
+
+		secret, ok := fields[secretName]
+		if !ok || secretName == name || field.String() == "" {
+			continue
+		}
+
+		if secret.String() != "" {
+			log.Warnf("both %s and %s are set, using %s", prefix+secretName, prefix+name, prefix+name)
+		}
+
+		content, err := os.ReadFile(field.String())
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", prefix+name, err)
+		}
+
+		secret.SetString(string(content))
+	}
+
+	return nil
+}
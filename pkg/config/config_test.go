@@ -0,0 +1,266 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testKey = "x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY="
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+	return file
+}
+
+func TestLoad(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+log_level: debug
+storage:
+  backend: postgres
+  postgres:
+    table: tfstates
+lock:
+  ttl: 1h
+kms:
+  key: `+testKey+`
+postgres:
+  connection: postgres://localhost/postgres
+`)
+
+	t.Setenv("STORAGE_POSTGRES_TABLE", "from_env")
+	t.Setenv("FORCE_UNLOCK_ENABLED", "false")
+
+	cfg, err := Load(file)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+
+	require.Equal(t, "debug", cfg.LogLevel)
+	require.Equal(t, "postgres", cfg.Storage.Backend)
+	require.Equal(t, "from_env", cfg.Storage.Postgres.Table, "environment variables take precedence")
+	require.Equal(t, time.Hour, cfg.Lock.TTL)
+	require.False(t, cfg.ForceUnlockEnabled)
+
+	// defaults
+	require.Equal(t, ":8080", cfg.ListenAddr)
+	require.Equal(t, time.Minute, cfg.Lock.ReapInterval)
+	require.True(t, cfg.Auth.Basic.Enabled)
+}
+
+func TestLoadWithoutFile(t *testing.T) {
+	t.Setenv("KMS_KEY", testKey)
+	t.Setenv("KMS_TRANSIT_ENGINE", "transit")
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	require.Equal(t, testKey, cfg.KMS.Key)
+	require.Equal(t, "transit", cfg.KMS.Transit.Engine)
+	require.Equal(t, "./states", cfg.Storage.FS.Dir)
+}
+
+func TestLoadUnknownKey(t *testing.T) {
+	file := writeFile(t, "config.toml", `
+[storage]
+backend = "fs"
+directory = "./states"
+`)
+
+	_, err := Load(file)
+	require.ErrorContains(t, err, "storage.directory")
+}
+
+func TestLoadCustomBackend(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+storage:
+  backend: gcs
+  gcs:
+    bucket: terraform-state
+    timeout: 30s
+auth:
+  oauth:
+    clientID: terraform-backend
+`)
+
+	cfg, err := Load(file)
+	require.NoError(t, err)
+
+	var gcs struct {
+		Bucket  string        `mapstructure:"bucket"`
+		Timeout time.Duration `mapstructure:"timeout"`
+		Prefix  string        `mapstructure:"prefix"`
+	}
+	gcs.Prefix = "states/"
+
+	require.NoError(t, DecodeCustom(cfg.Storage.Custom, "gcs", &gcs))
+	require.Equal(t, "terraform-state", gcs.Bucket)
+	require.Equal(t, 30*time.Second, gcs.Timeout)
+	require.Equal(t, "states/", gcs.Prefix, "unset keys keep their value")
+
+	var oauth struct {
+		ClientID string `mapstructure:"client_id"`
+	}
+
+	require.ErrorContains(t, DecodeCustom(cfg.Auth.Custom, "oauth", &oauth), "clientid")
+
+	// a backend without section keeps its defaults
+	require.NoError(t, DecodeCustom(cfg.Lock.Custom, "etcd", &oauth))
+
+	// the sections of the built-in backends are still checked
+	file = writeFile(t, "config.yaml", `
+storage:
+  s3:
+    bucket: terraform-state
+    region: eu-central-1
+  gcs: terraform-state
+`)
+
+	_, err = Load(file)
+	require.ErrorContains(t, err, "unknown keys in configuration file")
+	require.ErrorContains(t, err, "storage.gcs, storage.s3.region")
+}
+
+func TestLoadSecretFile(t *testing.T) {
+	t.Setenv("KMS_KEY", "ignored")
+	t.Setenv("KMS_KEY_FILE", writeFile(t, "key", testKey))
+	t.Setenv("ADMIN_TOKEN_FILE", writeFile(t, "token", "admin-secret"))
+
+	cfg, err := Load("")
+	require.NoError(t, err)
+	require.Equal(t, testKey, cfg.KMS.Key)
+	require.Equal(t, "admin-secret", cfg.AdminToken)
+
+	t.Setenv("KMS_KEY_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	_, err = Load("")
+	require.ErrorContains(t, err, "kms.key_file")
+}
+
+func TestValidate(t *testing.T) {
+	file := writeFile(t, "config.json", `{
+		"log_level": "verbose",
+		"tls_cert": "cert.pem",
+		"storage": {"backend": "postgres", "mirror_enabled": true},
+		"target_storage": {"fs": {"dir": ""}},
+		"lock": {"backend": "redis", "reap_interval": "0s"},
+		"kms": {"backend": "transit", "transit": {"key": "terraform-backend"}},
+		"audit": {"sink": "syslog", "syslog": {"network": "tcp"}},
+		"auth": {"token": {"enabled": true, "store": "sql"}, "mtls": {"enabled": true},
+			"htpasswd": {"enabled": true, "users": [{"name": "alice"}]},
+			"ldap": {"enabled": true, "url": "http://ldap.example.org", "user_dn": "dc=example,dc=org"},
+			"vault": {"enabled": true, "policy_prefix": "", "read_policy_prefix": ""}}
+	}`)
+
+	cfg, err := Load(file)
+	require.NoError(t, err)
+
+	err = cfg.Validate()
+	require.Error(t, err)
+
+	for _, msg := range []string{
+		"log_level (LOG_LEVEL)",
+		"tls_key (TLS_KEY)",
+		"postgres.connection (POSTGRES_CONNECTION): is required",
+		"target_storage.fs.dir (TARGET_STORAGE_FS_DIR): is required",
+		"lock.reap_interval (LOCK_REAP_INTERVAL): must be positive",
+		"kms.transit.engine (KMS_TRANSIT_ENGINE): is required",
+		"vault.addr (VAULT_ADDR): is required",
+		`auth.token.store (AUTH_TOKEN_STORE): unknown token store "sql"`,
+		"tls_client_ca (TLS_CLIENT_CA): is required by mtls auth",
+		"auth.mtls.rules (AUTH_MTLS_RULES): at least one rule is required",
+		"auth.htpasswd.users.0.projects (AUTH_HTPASSWD_USERS_0_PROJECTS): is required",
+		"auth.ldap.url (AUTH_LDAP_URL): must be an ldap:// or ldaps:// URL",
+		"auth.ldap.user_dn (AUTH_LDAP_USER_DN): must contain {username}",
+		"auth.ldap.group_base_dn (AUTH_LDAP_GROUP_BASE_DN): is required",
+		"audit.syslog.address (AUDIT_SYSLOG_ADDRESS): is required",
+		"auth.vault.policy_prefix (AUTH_VAULT_POLICY_PREFIX): a policy prefix or auth.vault.metadata_key is required",
+	} {
+		require.ErrorContains(t, err, msg)
+	}
+
+	require.NotContains(t, err.Error(), "kms.transit.key")
+}
+
+func TestLoadJWTIssuers(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+kms:
+  key: `+testKey+`
+auth:
+  jwt:
+    oidc_issuer_url: https://vault.example.com/v1/identity/oidc
+    issuers:
+      - url: https://keycloak.example.com/realms/main
+        audiences: [terraform-backend]
+        project_claim: groups
+        match: regex
+`)
+
+	t.Setenv("AUTH_JWT_AUDIENCES", "a,b")
+
+	cfg, err := Load(file)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+
+	issuers := cfg.Auth.JWT.TrustedIssuers()
+	require.Equal(t, []JWTIssuerConfig{{
+		URL:              "https://vault.example.com/v1/identity/oidc",
+		Audiences:        []string{"a", "b"},
+		ProjectClaim:     "terraform-backend.project",
+		StateClaim:       "terraform-backend.state",
+		PermissionsClaim: "terraform-backend.permissions",
+		GroupsClaim:      "groups",
+		Match:            "exact",
+	}, {
+		URL:              "https://keycloak.example.com/realms/main",
+		Audiences:        []string{"terraform-backend"},
+		ProjectClaim:     "groups",
+		StateClaim:       "terraform-backend.state",
+		PermissionsClaim: "terraform-backend.permissions",
+		GroupsClaim:      "groups",
+		Match:            "regex",
+	}}, issuers)
+
+	cfg.Auth.JWT.Issuers = append(cfg.Auth.JWT.Issuers, JWTIssuerConfig{})
+	err = cfg.Validate()
+	require.ErrorContains(t, err, "auth.jwt.issuers.1.url (AUTH_JWT_ISSUERS_1_URL): is required")
+}
+
+func TestLoadCIRules(t *testing.T) {
+	file := writeFile(t, "config.yaml", `
+kms:
+  key: `+testKey+`
+auth:
+  gitlab:
+    enabled: true
+    audiences: [terraform-backend]
+    rules:
+      - claims:
+          project_path: infra/*
+          ref_protected: "true"
+        project: ${namespace_path}
+        state: "*"
+`)
+
+	cfg, err := Load(file)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+
+	require.Equal(t, "https://gitlab.com", cfg.Auth.GitLab.IssuerURL)
+	require.Equal(t, []CIRuleConfig{{
+		Claims:  map[string]string{"project_path": "infra/*", "ref_protected": "true"},
+		Project: "${namespace_path}",
+		State:   "*",
+	}}, cfg.Auth.GitLab.Rules)
+
+	cfg.Auth.GitHub.Enabled = true
+	err = cfg.Validate()
+	require.ErrorContains(t, err, "auth.github.audiences (AUTH_GITHUB_AUDIENCES): is required")
+	require.ErrorContains(t, err, "auth.github.rules (AUTH_GITHUB_RULES): at least one rule is required")
+}
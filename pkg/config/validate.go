@@ -0,0 +1,332 @@
+package config
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Validate checks the configuration for missing required settings and invalid values. All problems are returned
+// together, every error names the key and the environment variable to fix it. The settings of the built-in backends
+// are checked, whether the configured backends are registered at all and the patterns of the auth backends are up to
+// the registries and the auth package.
+func (c *Config) Validate() error {
+	v := &validator{}
+
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		v.invalid("log_level", "%v", err)
+	}
+
+	v.required("listen_addr", c.ListenAddr)
+
+	if (c.TLSKey == "") != (c.TLSCert == "") {
+		v.invalid("tls_key", "tls_key and tls_cert have to be set together")
+	}
+
+	if c.TLSClientCA != "" && c.TLSCert == "" {
+		v.invalid("tls_client_ca", "client certificates require tls_cert and tls_key")
+	}
+
+	if c.TLSClientAuth != "optional" && c.TLSClientAuth != "required" {
+		v.invalid("tls_client_auth", "unknown mode %q (supported: optional, required)", c.TLSClientAuth)
+	}
+
+	v.storage("storage", c.Storage, c.Postgres, "postgres")
+
+	if c.Storage.MirrorEnabled {
+		v.storage("target_storage", c.TargetStorage, c.TargetPostgres, "target_postgres")
+	}
+
+	v.lock(c.Lock, c.Postgres, c.Redis)
+	v.kms("kms", c.KMS, c.Vault)
+
+	v.jwt(c.Auth.JWT)
+	v.ci("auth.gitlab", c.Auth.GitLab)
+	v.ci("auth.github", c.Auth.GitHub)
+	v.token(c.Auth.Token, c.Postgres)
+	v.mtls(c.Auth.MTLS, c.TLSClientCA)
+	v.htpasswd(c.Auth.Htpasswd)
+	v.ldap(c.Auth.LDAP)
+
+	if c.Auth.Vault.Enabled {
+		v.vault(c.Vault)
+
+		if c.Auth.Vault.PolicyPrefix == "" && c.Auth.Vault.ReadPolicyPrefix == "" && c.Auth.Vault.MetadataKey == "" {
+			v.invalid("auth.vault.policy_prefix", "a policy prefix or auth.vault.metadata_key is required")
+		}
+	}
+
+	v.audit(c.Audit)
+
+	return v.err()
+}
+
+// ValidateTargetKMS checks the configuration of the KMS states are migrated to.
+func (c *Config) ValidateTargetKMS() error {
+	v := &validator{}
+	v.kms("target_kms", c.TargetKMS, c.Vault)
+
+	return v.err()
+}
+
+// ValidateTargetStorage checks the configuration of the storage backend states are migrated to.
+func (c *Config) ValidateTargetStorage() error {
+	v := &validator{}
+	v.storage("target_storage", c.TargetStorage, c.TargetPostgres, "target_postgres")
+
+	return v.err()
+}
+
+type validator struct {
+	errs []error
+}
+
+// Invalid returns an error for an invalid key in the same format as Validate.
+func Invalid(key, format string, args ...any) error {
+	return fmt.Errorf("%s (%s): %s", key, EnvName(key), fmt.Sprintf(format, args...))
+}
+
+func (v *validator) invalid(key, format string, args ...any) {
+	v.errs = append(v.errs, Invalid(key, format, args...))
+}
+
+func (v *validator) required(key, value string) {
+	if value == "" {
+		v.invalid(key, "is required")
+	}
+}
+
+func (v *validator) storage(prefix string, s StorageConfig, pg PostgresConfig, pgPrefix string) {
+	switch s.Backend {
+	case "fs":
+		v.required(prefix+".fs.dir", s.FS.Dir)
+	case "postgres":
+		v.required(prefix+".postgres.table", s.Postgres.Table)
+		v.required(pgPrefix+".connection", pg.Connection)
+	case "s3":
+		v.required(prefix+".s3.endpoint", s.S3.Endpoint)
+		v.required(prefix+".s3.bucket", s.S3.Bucket)
+	}
+}
+
+func (v *validator) lock(l LockConfig, pg PostgresConfig, redis RedisConfig) {
+	if l.TTL < 0 {
+		v.invalid("lock.ttl", "must not be negative")
+	}
+
+	if l.ReapInterval <= 0 {
+		v.invalid("lock.reap_interval", "must be positive")
+	}
+
+	switch l.Backend {
+	case "redis":
+		v.required("redis.addr", redis.Addr)
+	case "postgres":
+		v.required("lock.postgres.table", l.Postgres.Table)
+		v.required("postgres.connection", pg.Connection)
+	}
+}
+
+func (v *validator) kms(prefix string, k KMSConfig, vault VaultConfig) {
+	switch k.Backend {
+	case "local":
+		if k.Key == "" {
+			v.invalid(prefix+".key", "is required (e.g. set it to this generated key: %s)", generateKey())
+		}
+	case "vault":
+		v.required(prefix+".vault_key_path", k.VaultKeyPath)
+		v.vault(vault)
+	case "transit":
+		v.required(prefix+".transit.engine", k.Transit.Engine)
+		v.required(prefix+".transit.key", k.Transit.Key)
+		v.vault(vault)
+	}
+}
+
+func (v *validator) vault(vault VaultConfig) {
+	v.required("vault.addr", vault.Addr)
+
+	if vault.Token == "" && vault.KubeAuth.Role == "" {
+		v.invalid("vault.token", "vault.token or vault.kube_auth.role is required")
+	}
+}
+
+func (v *validator) jwt(j JWTAuthConfig) {
+	issuers := j.TrustedIssuers()
+	if len(issuers) == 0 {
+		return
+	}
+
+	if j.JWKSRefreshInterval <= 0 {
+		v.invalid("auth.jwt.jwks_refresh_interval", "must be positive")
+	}
+
+	urls := make(map[string]bool)
+
+	for i, issuer := range j.Issuers {
+		v.required(fmt.Sprintf("auth.jwt.issuers.%d.url", i), issuer.URL)
+	}
+
+	for _, issuer := range issuers {
+		if urls[issuer.URL] {
+			v.invalid("auth.jwt.issuers", "issuer %s is set more than once", issuer.URL)
+		}
+		urls[issuer.URL] = true
+
+		if issuer.ProjectClaim == "" || issuer.StateClaim == "" {
+			v.invalid("auth.jwt.project_claim", "project and state claims of issuer %s are required", issuer.URL)
+		}
+	}
+}
+
+func (v *validator) ci(prefix string, ci CIAuthConfig) {
+	if !ci.Enabled {
+		return
+	}
+
+	v.required(prefix+".issuer_url", ci.IssuerURL)
+
+	// tokens issued for other services must not be accepted
+	if len(ci.Audiences) == 0 {
+		v.invalid(prefix+".audiences", "is required")
+	}
+
+	if len(ci.Rules) == 0 {
+		v.invalid(prefix+".rules", "at least one rule is required")
+	}
+
+	for i, rule := range ci.Rules {
+		v.required(fmt.Sprintf("%s.rules.%d.project", prefix, i), rule.Project)
+		v.required(fmt.Sprintf("%s.rules.%d.state", prefix, i), rule.State)
+	}
+}
+
+func (v *validator) token(t TokenAuthConfig, pg PostgresConfig) {
+	if !t.Enabled {
+		return
+	}
+
+	switch t.Store {
+	case "file":
+		v.required("auth.token.file", t.File)
+	case "postgres":
+		v.required("auth.token.postgres.table", t.Postgres.Table)
+		v.required("postgres.connection", pg.Connection)
+	default:
+		v.invalid("auth.token.store", "unknown token store %q (supported: file, postgres)", t.Store)
+	}
+}
+
+func (v *validator) mtls(m MTLSAuthConfig, clientCA string) {
+	if !m.Enabled {
+		return
+	}
+
+	if clientCA == "" {
+		v.invalid("tls_client_ca", "is required by mtls auth")
+	}
+
+	if len(m.Rules) == 0 {
+		v.invalid("auth.mtls.rules", "at least one rule is required")
+	}
+
+	for i, rule := range m.Rules {
+		prefix := fmt.Sprintf("auth.mtls.rules.%d", i)
+
+		// a rule without certificate patterns would grant access to every client
+		if rule.Subject == "" && rule.CommonName == "" && rule.URI == "" && rule.DNS == "" && rule.Email == "" {
+			v.invalid(prefix, "one of subject, common_name, uri, dns or email is required")
+		}
+
+		v.required(prefix+".project", rule.Project)
+		v.required(prefix+".state", rule.State)
+	}
+}
+
+func (v *validator) htpasswd(h HtpasswdAuthConfig) {
+	if !h.Enabled {
+		return
+	}
+
+	v.required("auth.htpasswd.file", h.File)
+
+	for i, user := range h.Users {
+		v.required(fmt.Sprintf("auth.htpasswd.users.%d.name", i), user.Name)
+
+		if len(user.Projects) == 0 {
+			v.invalid(fmt.Sprintf("auth.htpasswd.users.%d.projects", i), "is required")
+		}
+	}
+}
+
+func (v *validator) ldap(l LDAPAuthConfig) {
+	if !l.Enabled {
+		return
+	}
+
+	if u, err := url.Parse(l.URL); l.URL == "" {
+		v.invalid("auth.ldap.url", "is required")
+	} else if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") {
+		v.invalid("auth.ldap.url", "must be an ldap:// or ldaps:// URL")
+	}
+
+	if !strings.Contains(l.UserDN, "{username}") {
+		v.invalid("auth.ldap.user_dn", "must contain {username}")
+	}
+
+	v.required("auth.ldap.group_base_dn", l.GroupBaseDN)
+	v.required("auth.ldap.group_filter", l.GroupFilter)
+	v.required("auth.ldap.group_attribute", l.GroupAttribute)
+
+	if l.Timeout <= 0 {
+		v.invalid("auth.ldap.timeout", "must be positive")
+	}
+
+	for i, group := range l.Groups {
+		v.required(fmt.Sprintf("auth.ldap.groups.%d.name", i), group.Name)
+
+		if len(group.Projects) == 0 {
+			v.invalid(fmt.Sprintf("auth.ldap.groups.%d.projects", i), "is required")
+		}
+	}
+}
+
+func (v *validator) audit(a AuditConfig) {
+	switch a.Sink {
+	case "", "stdout":
+	case "file":
+		v.required("audit.file", a.File)
+	case "syslog":
+		switch a.Syslog.Network {
+		case "":
+		case "tcp", "udp", "unix":
+			v.required("audit.syslog.address", a.Syslog.Address)
+		default:
+			v.invalid("audit.syslog.network", "unknown network %q (supported: tcp, udp, unix)", a.Syslog.Network)
+		}
+	default:
+		v.invalid("audit.sink", "unknown sink %q (supported: file, stdout, syslog)", a.Sink)
+	}
+}
+
+func (v *validator) err() error {
+	return errors.Join(v.errs...)
+}
+
+// generateKey returns a random key for the local KMS.
+func generateKey() string {
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// EnvName returns the environment variable which sets the key.
+func EnvName(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
@@ -0,0 +1,214 @@
+package envelope
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/nimbolus/terraform-backend/pkg/kms"
+)
+
+const (
+	Name = "envelope"
+
+	// headerVersion 2 binds the state and the wrapped data key to the associated data, version 1 was used before
+	headerVersion   = 2
+	headerVersionV1 = 1
+	dataKeySize     = 32
+)
+
+// magic marks envelope ciphertexts, so that ciphertexts of the underlying KMS stay readable.
+var magic = []byte("TFBE")
+
+// KMS encrypts every state with a random data key, only the data key is encrypted (wrapped) by the underlying KMS.
+// The ciphertext consists of a header and the sealed state:
+//
+//	magic (4 bytes) | version (1 byte) | length of wrapped key (2 bytes) | wrapped key | nonce | sealed state
+type KMS struct {
+	kek kms.KMS
+	// strict rejects ciphertexts which aren't bound to associated data
+	strict bool
+}
+
+// NewKMS creates an envelope KMS, which wraps the data keys with kek.
+func NewKMS(kek kms.KMS) *KMS {
+	return &KMS{
+		kek: kek,
+	}
+}
+
+func (k *KMS) GetName() string {
+	return Name + "+" + k.kek.GetName()
+}
+
+// Unwrap returns the KMS wrapping the data keys.
+func (k *KMS) Unwrap() kms.KMS {
+	return k.kek
+}
+
+// RequireAssociatedData rejects ciphertexts created before associated data was supported,
+// once all states are re-encrypted.
+func (k *KMS) RequireAssociatedData() {
+	k.strict = true
+}
+
+func (k *KMS) Encrypt(d, ad []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, fmt.Errorf("failed to create data key for envelope KMS: %v", err)
+	}
+
+	gcm, err := buildCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	wrappedKey, err := k.kek.Encrypt(dataKey, ad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to create nonce for seal with envelope KMS: %v", err)
+	}
+
+	header, err := buildHeader(wrappedKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(append(header, nonce...), nonce, d, ad), nil
+}
+
+func (k *KMS) Decrypt(d, ad []byte) ([]byte, error) {
+	if !bytes.HasPrefix(d, magic) {
+		// the state was encrypted directly by the underlying KMS before envelope encryption was enabled
+		return k.kek.Decrypt(d, ad)
+	}
+
+	version, wrappedKey, sealed, err := parseHeader(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if version == headerVersionV1 {
+		if k.strict && len(ad) > 0 {
+			return nil, fmt.Errorf("failed to unseal with envelope KMS: ciphertext is not bound to associated data")
+		}
+
+		ad = nil
+	}
+
+	dataKey, err := k.kek.Decrypt(wrappedKey, ad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+
+	gcm, err := buildCipher(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(sealed) < nonceSize {
+		return nil, fmt.Errorf("failed to unseal with envelope KMS: ciphertext too short")
+	}
+
+	plaintext, err := gcm.Open(nil, sealed[:nonceSize], sealed[nonceSize:], ad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal with envelope KMS: %v", err)
+	}
+
+	return plaintext, nil
+}
+
+// Rewrap re-encrypts only the data key with the active key of the underlying KMS, the state itself stays unchanged.
+// States encrypted directly by the underlying KMS or with header version 1 are encrypted again.
+func (k *KMS) Rewrap(d, ad []byte) ([]byte, bool, error) {
+	if !bytes.HasPrefix(d, magic) || len(d) == len(magic) || d[len(magic)] != headerVersion {
+		plaintext, err := k.Decrypt(d, ad)
+		if err != nil {
+			return nil, false, err
+		}
+
+		ciphertext, err := k.Encrypt(plaintext, ad)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return ciphertext, true, nil
+	}
+
+	_, wrappedKey, sealed, err := parseHeader(d)
+	if err != nil {
+		return nil, false, err
+	}
+
+	newWrappedKey, rewrapped, err := kms.Rewrap(k.kek, wrappedKey, ad)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to rewrap data key: %w", err)
+	} else if !rewrapped {
+		return d, false, nil
+	}
+
+	header, err := buildHeader(newWrappedKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return append(header, sealed...), true, nil
+}
+
+func buildHeader(wrappedKey []byte) ([]byte, error) {
+	if len(wrappedKey) > 0xffff {
+		return nil, fmt.Errorf("wrapped data key is too long: %d bytes", len(wrappedKey))
+	}
+
+	header := make([]byte, 0, len(magic)+3+len(wrappedKey))
+	header = append(header, magic...)
+	header = append(header, headerVersion)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+
+	return append(header, wrappedKey...), nil
+}
+
+// parseHeader splits an envelope ciphertext into the header version, the wrapped data key and the sealed state.
+func parseHeader(d []byte) (byte, []byte, []byte, error) {
+	rest := d[len(magic):]
+	if len(rest) < 3 {
+		return 0, nil, nil, fmt.Errorf("failed to unseal with envelope KMS: header too short")
+	}
+
+	version := rest[0]
+	if version != headerVersion && version != headerVersionV1 {
+		return 0, nil, nil, fmt.Errorf("failed to unseal with envelope KMS: unsupported header version %d", version)
+	}
+
+	keyLen := int(binary.BigEndian.Uint16(rest[1:3]))
+	rest = rest[3:]
+
+	if len(rest) < keyLen {
+		return 0, nil, nil, fmt.Errorf("failed to unseal with envelope KMS: wrapped key too short")
+	}
+
+	return version, rest[:keyLen], rest[keyLen:], nil
+}
+
+func buildCipher(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create envelope KMS cipher: %v", err)
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create envelope KMS gcm: %v", err)
+	}
+
+	return gcm, nil
+}
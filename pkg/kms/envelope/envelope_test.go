@@ -0,0 +1,114 @@
+package envelope
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/kms/local"
+	"github.com/nimbolus/terraform-backend/pkg/kms/util"
+)
+
+func TestKMS(t *testing.T) {
+	kek, err := local.NewKMS("x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY=")
+	require.NoError(t, err)
+
+	util.KMSTest(t, NewKMS(kek))
+}
+
+func TestDirectCiphertext(t *testing.T) {
+	kek, err := local.NewKMS("x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY=")
+	require.NoError(t, err)
+
+	k := NewKMS(kek)
+	plain := []byte("direct")
+	ad := []byte("state-id")
+
+	// states encrypted before envelope encryption was enabled stay readable
+	cipher, err := kek.Encrypt(plain, ad)
+	require.NoError(t, err)
+
+	decrypted, err := k.Decrypt(cipher, ad)
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
+
+	converted, ok, err := k.Rewrap(cipher, ad)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.True(t, bytes.HasPrefix(converted, magic))
+
+	decrypted, err = k.Decrypt(converted, ad)
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
+}
+
+func TestRewrap(t *testing.T) {
+	oldKey := "x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY="
+	newKey := "jwS6UpASMOWpEmFn7C6I47BlmPt4cpdmYLKd2E7a4Zk="
+	plain := []byte("rewrap")
+	ad := []byte("state-id")
+
+	oldKEK, err := local.NewKMS(oldKey)
+	require.NoError(t, err)
+
+	cipher, err := NewKMS(oldKEK).Encrypt(plain, ad)
+	require.NoError(t, err)
+
+	kek, err := local.NewKMS(newKey, oldKey)
+	require.NoError(t, err)
+
+	k := NewKMS(kek)
+
+	rewrapped, ok, err := k.Rewrap(cipher, ad)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// only the data key is re-encrypted, the sealed state stays the same
+	_, _, sealed, err := parseHeader(cipher)
+	require.NoError(t, err)
+	require.True(t, bytes.HasSuffix(rewrapped, sealed))
+
+	_, ok, err = k.Rewrap(rewrapped, ad)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	newKEK, err := local.NewKMS(newKey)
+	require.NoError(t, err)
+
+	decrypted, err := NewKMS(newKEK).Decrypt(rewrapped, ad)
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
+}
+
+func TestHeaderV1(t *testing.T) {
+	kek, err := local.NewKMS("x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY=")
+	require.NoError(t, err)
+
+	k := NewKMS(kek)
+	plain := []byte("v1")
+	ad := []byte("state-id")
+
+	// header version 1 ciphertexts were created without associated data
+	cipher, err := k.Encrypt(plain, nil)
+	require.NoError(t, err)
+
+	cipher[len(magic)] = headerVersionV1
+
+	decrypted, err := k.Decrypt(cipher, ad)
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
+
+	rewrapped, ok, err := k.Rewrap(cipher, ad)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	k.RequireAssociatedData()
+
+	_, err = k.Decrypt(cipher, ad)
+	require.Error(t, err, "header version 1 should be rejected in strict mode")
+
+	decrypted, err = k.Decrypt(rewrapped, ad)
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
+}
@@ -1,7 +1,42 @@
 package kms
 
+// KMS encrypts and decrypts states. The associated data (e.g. the state ID) is authenticated together with the
+// ciphertext, so that a ciphertext can't be decrypted in the context of another state.
 type KMS interface {
 	GetName() string
-	Encrypt(d []byte) ([]byte, error)
-	Decrypt(d []byte) ([]byte, error)
+	Encrypt(d, ad []byte) ([]byte, error)
+	Decrypt(d, ad []byte) ([]byte, error)
+}
+
+// Rewrapper is implemented by KMS backends with multiple keys (or key versions), which can re-encrypt a
+// ciphertext with the active key. The returned bool is false if the ciphertext is already encrypted with it
+// and bound to the associated data.
+type Rewrapper interface {
+	Rewrap(d, ad []byte) ([]byte, bool, error)
+}
+
+// AssociatedDataEnforcer is implemented by KMS backends, which can reject ciphertexts created before associated data
+// was supported. Until then these ciphertexts are decrypted without associated data.
+type AssociatedDataEnforcer interface {
+	RequireAssociatedData()
+}
+
+// Rewrap re-encrypts the ciphertext with the active key of k. If k doesn't implement Rewrapper,
+// the ciphertext is decrypted and encrypted again.
+func Rewrap(k KMS, d, ad []byte) ([]byte, bool, error) {
+	if r, ok := k.(Rewrapper); ok {
+		return r.Rewrap(d, ad)
+	}
+
+	plaintext, err := k.Decrypt(d, ad)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ciphertext, err := k.Encrypt(plaintext, ad)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return ciphertext, true, nil
 }
@@ -1,29 +1,80 @@
 package local
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"io"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/kms"
+)
+
+const (
+	Name = "local"
+
+	// ciphertexts are tagged with the ID of the key, which encrypted them: local:v2:<key id>:<nonce><ciphertext>
+	// v2 ciphertexts are bound to the associated data, v1 ciphertexts and ciphertexts without prefix
+	// were created before associated data (or key rotation) was supported.
+	ciphertextPrefixV1 = "local:v1:"
+	ciphertextPrefixV2 = "local:v2:"
 )
 
-const Name = "local"
+func init() {
+	kms.Register(Name, func(cfg config.KMSConfig, _ config.ClientsConfig) (kms.KMS, error) {
+		if cfg.Key == "" {
+			return nil, fmt.Errorf("no key for local KMS defined")
+		}
 
+		return NewKMS(cfg.Key, SplitKeys(cfg.RetiredKeys)...)
+	})
+}
+
+// transitCiphertext matches the prefix of Vault Transit ciphertexts (e.g. vault:v1:)
+var transitCiphertext = regexp.MustCompile(`^vault:v[0-9]+:`)
+
+// KMS encrypts with the active key and decrypts with the active key or any of the retired keys.
 type KMS struct {
-	cipher cipher.AEAD
+	activeID string
+	ciphers  map[string]cipher.AEAD
+	// ids contains the key IDs in the order legacy ciphertexts are tried, beginning with the active key
+	ids []string
+	// strict rejects ciphertexts which aren't bound to associated data
+	strict bool
 }
 
-func NewKMS(key string) (*KMS, error) {
-	gcm, err := buildCipher(key)
-	if err != nil {
-		return nil, err
+// NewKMS creates a local KMS, which encrypts with key. The retired keys are only used for decryption,
+// so that states encrypted before a key rotation stay readable.
+func NewKMS(key string, retiredKeys ...string) (*KMS, error) {
+	k := &KMS{
+		ciphers: make(map[string]cipher.AEAD),
+	}
+
+	for _, key := range append([]string{key}, retiredKeys...) {
+		id, gcm, err := buildCipher(key)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := k.ciphers[id]; ok {
+			continue
+		}
+
+		k.ciphers[id] = gcm
+		k.ids = append(k.ids, id)
 	}
 
-	return &KMS{
-		cipher: gcm,
-	}, nil
+	k.activeID = k.ids[0]
+
+	return k, nil
 }
 
 func GenerateKey() (string, error) {
@@ -39,20 +90,146 @@ func (k *KMS) GetName() string {
 	return Name
 }
 
-func (k *KMS) Encrypt(d []byte) ([]byte, error) {
-	nonce := make([]byte, k.cipher.NonceSize())
+// ActiveKeyID returns the ID of the key used for encryption.
+func (k *KMS) ActiveKeyID() string {
+	return k.activeID
+}
+
+// RequireAssociatedData rejects ciphertexts created before associated data was supported,
+// once all states are re-encrypted.
+func (k *KMS) RequireAssociatedData() {
+	k.strict = true
+}
+
+func (k *KMS) Encrypt(d, ad []byte) ([]byte, error) {
+	gcm := k.ciphers[k.activeID]
+
+	nonce := make([]byte, gcm.NonceSize())
 	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
 		return nil, fmt.Errorf("failed to create nonce for seal with local KMS: %v", err)
 	}
 
-	return k.cipher.Seal(nonce, nonce, d, nil), nil
+	prefix := []byte(ciphertextPrefixV2 + k.activeID + ":")
+	sealed := append(prefix, nonce...)
+
+	return gcm.Seal(sealed, nonce, d, ad), nil
+}
+
+func (k *KMS) Decrypt(d, ad []byte) ([]byte, error) {
+	c, err := parseCiphertext(d)
+	if err != nil {
+		return nil, err
+	}
+
+	if !c.bound && !c.transit {
+		if k.strict && len(ad) > 0 {
+			return nil, fmt.Errorf("failed to unseal with simple KMS: ciphertext is not bound to associated data")
+		}
+
+		ad = nil
+	}
+
+	if c.id != "" {
+		gcm, ok := k.ciphers[c.id]
+		if !ok {
+			return nil, fmt.Errorf("failed to unseal with simple KMS: unknown key id %s", c.id)
+		}
+
+		return open(gcm, c.data, ad)
+	}
+
+	// legacy and Vault Transit ciphertexts carry no key id, so all keys are tried
+	for _, id := range k.ids {
+		if plaintext, err := open(k.ciphers[id], c.data, ad); err == nil {
+			return plaintext, nil
+		}
+	}
+
+	if c.transit && len(ad) > 0 && !k.strict {
+		// Vault Transit ciphertexts created before associated data was supported
+		for _, id := range k.ids {
+			if plaintext, err := open(k.ciphers[id], c.data, nil); err == nil {
+				return plaintext, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("failed to unseal with simple KMS: no matching key")
+}
+
+// Rewrap re-encrypts the ciphertext with the active key and binds it to the associated data, if it was encrypted
+// with a retired key or before key IDs and associated data were introduced.
+func (k *KMS) Rewrap(d, ad []byte) ([]byte, bool, error) {
+	c, err := parseCiphertext(d)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if c.bound && c.id == k.activeID {
+		return d, false, nil
+	}
+
+	plaintext, err := k.Decrypt(d, ad)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ciphertext, err := k.Encrypt(plaintext, ad)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return ciphertext, true, nil
+}
+
+type parsedCiphertext struct {
+	// id of the key, empty for legacy ciphertexts
+	id string
+	// bound is true if the ciphertext is bound to associated data
+	bound bool
+	// transit is true for ciphertexts of the Vault Transit engine, which can be decrypted with an exported key
+	transit bool
+	data    []byte
+}
+
+// parseCiphertext splits a tagged ciphertext into the key ID and the sealed data.
+func parseCiphertext(d []byte) (parsedCiphertext, error) {
+	var rest []byte
+	var bound bool
+
+	switch {
+	case bytes.HasPrefix(d, []byte(ciphertextPrefixV2)):
+		rest, bound = d[len(ciphertextPrefixV2):], true
+	case bytes.HasPrefix(d, []byte(ciphertextPrefixV1)):
+		rest = d[len(ciphertextPrefixV1):]
+	case transitCiphertext.Match(d):
+		data, err := base64.StdEncoding.DecodeString(string(transitCiphertext.ReplaceAll(d, nil)))
+		if err != nil {
+			return parsedCiphertext{}, fmt.Errorf("failed to unseal with simple KMS: invalid transit ciphertext: %v", err)
+		}
+
+		return parsedCiphertext{transit: true, data: data}, nil
+	default:
+		return parsedCiphertext{data: d}, nil
+	}
+
+	i := bytes.IndexByte(rest, ':')
+	if i < 0 {
+		return parsedCiphertext{}, fmt.Errorf("failed to unseal with simple KMS: invalid ciphertext prefix")
+	}
+
+	return parsedCiphertext{id: string(rest[:i]), bound: bound, data: rest[i+1:]}, nil
 }
 
-func (k *KMS) Decrypt(d []byte) ([]byte, error) {
-	nonceSize := k.cipher.NonceSize()
+func open(gcm cipher.AEAD, d, ad []byte) ([]byte, error) {
+	nonceSize := gcm.NonceSize()
+	if len(d) < nonceSize {
+		return nil, fmt.Errorf("failed to unseal with simple KMS: ciphertext too short")
+	}
+
 	nonce, ciphertext := d[:nonceSize], d[nonceSize:]
 
-	plaintext, err := k.cipher.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, ad)
 	if err != nil {
 		return nil, fmt.Errorf("failed to unseal with simple KMS: %v", err)
 	}
@@ -60,21 +237,31 @@ func (k *KMS) Decrypt(d []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
-func buildCipher(key string) (cipher.AEAD, error) {
+// buildCipher creates the cipher of a key and derives the key ID from the hash of the key.
+func buildCipher(key string) (string, cipher.AEAD, error) {
 	k, err := base64.StdEncoding.DecodeString(key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create simple KMS key: %v", err)
+		return "", nil, fmt.Errorf("failed to create simple KMS key: %v", err)
 	}
 
 	block, err := aes.NewCipher(k)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create simple KMS cipher: %v", err)
+		return "", nil, fmt.Errorf("failed to create simple KMS cipher: %v", err)
 	}
 
 	gcm, err := cipher.NewGCM(block)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create simple KMS gcm: %v", err)
+		return "", nil, fmt.Errorf("failed to create simple KMS gcm: %v", err)
 	}
 
-	return gcm, err
+	hash := sha256.Sum256(k)
+
+	return hex.EncodeToString(hash[:8]), gcm, nil
+}
+
+// SplitKeys splits a list of keys separated by commas or whitespace.
+func SplitKeys(keys string) []string {
+	return strings.FieldsFunc(keys, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
 }
@@ -1,6 +1,7 @@
 package local
 
 import (
+	"encoding/base64"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -14,3 +15,118 @@ func TestKMS(t *testing.T) {
 
 	util.KMSTest(t, k)
 }
+
+func TestKeyRotation(t *testing.T) {
+	oldKey := "x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY="
+	newKey := "jwS6UpASMOWpEmFn7C6I47BlmPt4cpdmYLKd2E7a4Zk="
+	plain := []byte("rotate")
+	ad := []byte("state-id")
+
+	oldKMS, err := NewKMS(oldKey)
+	require.NoError(t, err)
+
+	oldCipher, err := oldKMS.Encrypt(plain, ad)
+	require.NoError(t, err)
+
+	k, err := NewKMS(newKey, oldKey)
+	require.NoError(t, err)
+	require.NotEqual(t, oldKMS.ActiveKeyID(), k.ActiveKeyID())
+
+	// ciphertexts of retired keys can still be decrypted
+	decrypted, err := k.Decrypt(oldCipher, ad)
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
+
+	newCipher, ok, err := k.Rewrap(oldCipher, ad)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, ok, err = k.Rewrap(newCipher, ad)
+	require.NoError(t, err)
+	require.False(t, ok, "ciphertext of the active key should not be rewrapped")
+
+	newKMS, err := NewKMS(newKey)
+	require.NoError(t, err)
+
+	decrypted, err = newKMS.Decrypt(newCipher, ad)
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
+
+	_, err = newKMS.Decrypt(oldCipher, ad)
+	require.Error(t, err, "ciphertext of a removed key should not be decryptable")
+}
+
+func TestLegacyCiphertext(t *testing.T) {
+	key := "x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY="
+	plain := []byte("legacy")
+	ad := []byte("state-id")
+
+	k, err := NewKMS("jwS6UpASMOWpEmFn7C6I47BlmPt4cpdmYLKd2E7a4Zk=", key)
+	require.NoError(t, err)
+
+	id, gcm, err := buildCipher(key)
+	require.NoError(t, err)
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	for name, legacyCipher := range map[string][]byte{
+		// created before key ids were introduced, consisting of the nonce and the sealed data only
+		"untagged": gcm.Seal(nonce, nonce, plain, nil),
+		// created before associated data was supported
+		"v1": gcm.Seal([]byte(ciphertextPrefixV1+id+":"+string(nonce)), nonce, plain, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			decrypted, err := k.Decrypt(legacyCipher, ad)
+			require.NoError(t, err)
+			require.Equal(t, plain, decrypted)
+
+			newCipher, ok, err := k.Rewrap(legacyCipher, ad)
+			require.NoError(t, err)
+			require.True(t, ok)
+			require.Contains(t, string(newCipher), ciphertextPrefixV2+k.ActiveKeyID()+":")
+
+			_, err = k.Decrypt(newCipher, []byte("other-state-id"))
+			require.Error(t, err, "rewrapped ciphertext should be bound to the associated data")
+
+			strict, err := NewKMS("jwS6UpASMOWpEmFn7C6I47BlmPt4cpdmYLKd2E7a4Zk=", key)
+			require.NoError(t, err)
+
+			strict.RequireAssociatedData()
+
+			_, err = strict.Decrypt(legacyCipher, ad)
+			require.Error(t, err, "legacy ciphertext should be rejected in strict mode")
+
+			decrypted, err = strict.Decrypt(newCipher, ad)
+			require.NoError(t, err)
+			require.Equal(t, plain, decrypted)
+		})
+	}
+}
+
+func TestTransitCiphertext(t *testing.T) {
+	// an exported Vault Transit key
+	key := "x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY="
+	plain := []byte("transit")
+	ad := []byte("state-id")
+
+	k, err := NewKMS(key)
+	require.NoError(t, err)
+
+	_, gcm, err := buildCipher(key)
+	require.NoError(t, err)
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	for name, sealed := range map[string][]byte{
+		"with associated data":    gcm.Seal(nonce, nonce, plain, ad),
+		"without associated data": gcm.Seal(nonce, nonce, plain, nil),
+	} {
+		t.Run(name, func(t *testing.T) {
+			transitCipher := []byte("vault:v1:" + base64.StdEncoding.EncodeToString(sealed))
+
+			decrypted, err := k.Decrypt(transitCipher, ad)
+			require.NoError(t, err)
+			require.Equal(t, plain, decrypted)
+		})
+	}
+}
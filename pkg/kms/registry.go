@@ -0,0 +1,63 @@
+package kms
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// Factory creates a KMS backend from its configuration.
+type Factory func(cfg config.KMSConfig, clients config.ClientsConfig) (KMS, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a KMS backend available by name, it's meant to be called in the init function of the package
+// implementing the backend. Register panics if it's called twice with the same name.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic("kms: Register called twice for backend " + name)
+	}
+
+	factories[name] = factory
+}
+
+// Backends returns the sorted names of the registered KMS backends.
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New creates the KMS backend configured by cfg.Backend.
+func New(cfg config.KMSConfig, clients config.ClientsConfig) (KMS, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[cfg.Backend]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("KMS backend %s is not implemented (registered: %s)", cfg.Backend, strings.Join(Backends(), ", "))
+	}
+
+	k, err := factory(cfg, clients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize KMS backend %s: %v", cfg.Backend, err)
+	}
+
+	return k, nil
+}
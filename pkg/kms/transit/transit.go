@@ -3,23 +3,46 @@ package transit
 import (
 	"encoding/base64"
 	"fmt"
+	"strings"
 
 	"github.com/hashicorp/vault/api"
+
+	vaultclient "github.com/nimbolus/terraform-backend/pkg/client/vault"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/kms"
 )
 
 const Name = "transit"
 
+func init() {
+	kms.Register(Name, func(cfg config.KMSConfig, clients config.ClientsConfig) (kms.KMS, error) {
+		client, err := vaultclient.NewVaultClient(clients.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("failed to setup Vault client for Vault KMS: %v", err)
+		}
+
+		return NewVaultTransit(client, cfg.Transit.Engine, cfg.Transit.Key, cfg.Transit.Derived), nil
+	})
+}
+
 type VaultTransit struct {
 	client *api.Client
 	engine string
 	key    string
+	// derived keys get the associated data as key derivation context, other keys as AEAD associated data
+	derived bool
+	// strict rejects ciphertexts which aren't bound to associated data
+	strict bool
 }
 
-func NewVaultTransit(client *api.Client, engine string, key string) *VaultTransit {
+// NewVaultTransit creates a KMS backend using the given key of a Vault Transit engine. If the key was created with
+// key derivation enabled, derived has to be set, so that the associated data is sent as derivation context.
+func NewVaultTransit(client *api.Client, engine string, key string, derived bool) *VaultTransit {
 	return &VaultTransit{
-		client: client,
-		engine: engine,
-		key:    key,
+		client:  client,
+		engine:  engine,
+		key:     key,
+		derived: derived,
 	}
 }
 
@@ -27,10 +50,16 @@ func (v *VaultTransit) GetName() string {
 	return Name
 }
 
-func (v *VaultTransit) Encrypt(d []byte) ([]byte, error) {
-	params := map[string]any{
+// RequireAssociatedData rejects ciphertexts created before associated data was supported,
+// once all states are re-encrypted.
+func (v *VaultTransit) RequireAssociatedData() {
+	v.strict = true
+}
+
+func (v *VaultTransit) Encrypt(d, ad []byte) ([]byte, error) {
+	params := v.withAssociatedData(map[string]any{
 		"plaintext": base64.StdEncoding.EncodeToString(d),
-	}
+	}, ad)
 	path := fmt.Sprintf("%s/encrypt/%s", v.engine, v.key)
 	res, err := v.client.Logical().Write(path, params)
 	if err != nil {
@@ -45,10 +74,32 @@ func (v *VaultTransit) Encrypt(d []byte) ([]byte, error) {
 	return []byte(ciphertext), nil
 }
 
-func (v *VaultTransit) Decrypt(d []byte) ([]byte, error) {
-	params := map[string]any{
-		"ciphertext": string(d),
+func (v *VaultTransit) Decrypt(d, ad []byte) ([]byte, error) {
+	data, _, err := v.decrypt(d, ad)
+
+	return data, err
+}
+
+// decrypt returns the plaintext and whether the ciphertext is bound to the associated data. Transit ciphertexts
+// don't show if they were created with associated data, so without derivation the decryption is retried without it.
+func (v *VaultTransit) decrypt(d, ad []byte) ([]byte, bool, error) {
+	data, err := v.decryptWith(d, ad)
+	if err == nil || len(ad) == 0 || v.derived || v.strict {
+		return data, err == nil && len(ad) > 0, err
+	}
+
+	data, legacyErr := v.decryptWith(d, nil)
+	if legacyErr != nil {
+		return nil, false, err
 	}
+
+	return data, false, nil
+}
+
+func (v *VaultTransit) decryptWith(d, ad []byte) ([]byte, error) {
+	params := v.withAssociatedData(map[string]any{
+		"ciphertext": string(d),
+	}, ad)
 	path := fmt.Sprintf("%s/decrypt/%s", v.engine, v.key)
 	res, err := v.client.Logical().Write(path, params)
 	if err != nil {
@@ -67,3 +118,75 @@ func (v *VaultTransit) Decrypt(d []byte) ([]byte, error) {
 
 	return data, nil
 }
+
+// Rewrap re-encrypts the ciphertext with the latest version of the transit key. For derived keys the plaintext never
+// leaves Vault, otherwise the associated data isn't supported by the rewrap endpoint and the ciphertext is decrypted
+// and encrypted again.
+func (v *VaultTransit) Rewrap(d, ad []byte) ([]byte, bool, error) {
+	if v.derived || len(ad) == 0 {
+		return v.rewrap(d, ad)
+	}
+
+	plaintext, bound, err := v.decrypt(d, ad)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ciphertext, err := v.Encrypt(plaintext, ad)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if bound && keyVersion(string(ciphertext)) == keyVersion(string(d)) {
+		return d, false, nil
+	}
+
+	return ciphertext, true, nil
+}
+
+func (v *VaultTransit) rewrap(d, ad []byte) ([]byte, bool, error) {
+	params := v.withAssociatedData(map[string]any{
+		"ciphertext": string(d),
+	}, ad)
+	path := fmt.Sprintf("%s/rewrap/%s", v.engine, v.key)
+	res, err := v.client.Logical().Write(path, params)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to rewrap with transit engine: %v", err)
+	}
+
+	ciphertext, ok := res.Data["ciphertext"].(string)
+	if !ok {
+		return nil, false, fmt.Errorf("failed to get ciphertext")
+	}
+
+	// Vault rewraps the ciphertext even if it's already encrypted with the latest key version
+	if keyVersion(ciphertext) == keyVersion(string(d)) {
+		return d, false, nil
+	}
+
+	return []byte(ciphertext), true, nil
+}
+
+func (v *VaultTransit) withAssociatedData(params map[string]any, ad []byte) map[string]any {
+	if len(ad) == 0 {
+		return params
+	}
+
+	if v.derived {
+		params["context"] = base64.StdEncoding.EncodeToString(ad)
+	} else {
+		params["associated_data"] = base64.StdEncoding.EncodeToString(ad)
+	}
+
+	return params
+}
+
+// keyVersion returns the key version prefix of a transit ciphertext (e.g. vault:v2).
+func keyVersion(ciphertext string) string {
+	parts := strings.SplitN(ciphertext, ":", 3)
+	if len(parts) < 3 {
+		return ""
+	}
+
+	return parts[0] + ":" + parts[1]
+}
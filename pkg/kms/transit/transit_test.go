@@ -3,6 +3,8 @@ package transit
 import (
 	"testing"
 
+	"github.com/stretchr/testify/require"
+
 	"github.com/nimbolus/terraform-backend/pkg/client/vault/vaulttest"
 	"github.com/nimbolus/terraform-backend/pkg/kms/util"
 )
@@ -10,5 +12,33 @@ import (
 func TestKMS(t *testing.T) {
 	v := vaulttest.NewIfIntegrationTest(t)
 
-	util.KMSTest(t, NewVaultTransit(v, "transit", "terraform-backend"))
+	util.KMSTest(t, NewVaultTransit(v, "transit", "terraform-backend", false))
+}
+
+func TestRewrap(t *testing.T) {
+	v := vaulttest.NewIfIntegrationTest(t)
+	k := NewVaultTransit(v, "transit", "terraform-backend", false)
+
+	plain := []byte("rewrap")
+	ad := []byte("state-id")
+
+	cipher, err := k.Encrypt(plain, ad)
+	require.NoError(t, err)
+
+	rewrapped, ok, err := k.Rewrap(cipher, ad)
+	require.NoError(t, err)
+	require.False(t, ok, "ciphertext of the latest key version should not be rewrapped")
+	require.Equal(t, cipher, rewrapped)
+
+	_, err = v.Logical().Write("transit/keys/terraform-backend/rotate", nil)
+	require.NoError(t, err)
+
+	rewrapped, ok, err = k.Rewrap(cipher, ad)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.NotEqual(t, keyVersion(string(cipher)), keyVersion(string(rewrapped)))
+
+	decrypted, err := k.Decrypt(rewrapped, ad)
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
 }
@@ -13,18 +13,22 @@ func KMSTest(t *testing.T, k kms.KMS) {
 	t.Log(k.GetName())
 
 	plain := []byte(rand.Text())
+	ad := []byte(rand.Text())
 
 	t.Logf("plaintext: %s", plain)
 
-	cipher, err := k.Encrypt(plain)
+	cipher, err := k.Encrypt(plain, ad)
 	require.NoError(t, err)
 
 	t.Logf("ciphertext: %v", cipher)
 
-	decrypted, err := k.Decrypt(cipher)
+	decrypted, err := k.Decrypt(cipher, ad)
 	require.NoError(t, err)
 
 	t.Logf("decrypted: %s", decrypted)
 
 	require.Equal(t, plain, decrypted)
+
+	_, err = k.Decrypt(cipher, []byte(rand.Text()))
+	require.Error(t, err, "ciphertext should not be decryptable with other associated data")
 }
@@ -0,0 +1,43 @@
+package vault
+
+import (
+	"fmt"
+
+	vaultclient "github.com/nimbolus/terraform-backend/pkg/client/vault"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/kms"
+	"github.com/nimbolus/terraform-backend/pkg/kms/local"
+)
+
+// Name of the KMS backend, which reads the keys of a local KMS from a Vault KV secret.
+const Name = "vault"
+
+func init() {
+	kms.Register(Name, NewKMS)
+}
+
+// NewKMS creates a local KMS with the key (and the optional retired_keys) stored in the Vault KV secret
+// at cfg.VaultKeyPath.
+func NewKMS(cfg config.KMSConfig, clients config.ClientsConfig) (kms.KMS, error) {
+	if cfg.VaultKeyPath == "" {
+		return nil, fmt.Errorf("no vault key path for Vault KMS defined")
+	}
+
+	client, err := vaultclient.NewVaultClient(clients.Vault)
+	if err != nil {
+		return nil, fmt.Errorf("failed to setup Vault client for Vault KMS: %v", err)
+	}
+
+	key, err := vaultclient.GetKvValue(client, cfg.VaultKeyPath, "key")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get key for Vault KMS: %v", err)
+	}
+
+	// retired keys are optional
+	retiredKeys, err := vaultclient.GetKvValue(client, cfg.VaultKeyPath, "retired_keys")
+	if err != nil {
+		retiredKeys = ""
+	}
+
+	return local.NewKMS(key, local.SplitKeys(retiredKeys)...)
+}
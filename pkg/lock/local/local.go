@@ -3,20 +3,32 @@ package local
 import (
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/lock"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
 const Name = "local"
 
+func init() {
+	lock.Register(Name, func(cfg config.LockConfig, _ config.ClientsConfig) (lock.Locker, error) {
+		return NewLock(cfg.TTL), nil
+	})
+}
+
 type Lock struct {
 	mutex sync.Mutex
 	db    map[string]terraform.LockInfo
+	ttl   time.Duration
 }
 
-func NewLock() *Lock {
+// NewLock creates a local lock backend, the locks expire after the given TTL (0 disables the expiry).
+func NewLock(ttl time.Duration) *Lock {
 	return &Lock{
-		db: make(map[string]terraform.LockInfo),
+		db:  make(map[string]terraform.LockInfo),
+		ttl: ttl,
 	}
 }
 
@@ -29,7 +41,7 @@ func (l *Lock) Lock(s *terraform.State) (bool, error) {
 	defer l.mutex.Unlock()
 
 	lock, ok := l.db[s.ID]
-	if ok {
+	if ok && !lock.Expired() {
 		if lock.Equal(s.Lock) {
 			// you already have the lock
 			return true, nil
@@ -40,6 +52,10 @@ func (l *Lock) Lock(s *terraform.State) (bool, error) {
 		return false, nil
 	}
 
+	if l.ttl > 0 {
+		s.Lock.Expires = time.Now().Add(l.ttl)
+	}
+
 	l.db[s.ID] = s.Lock
 
 	return true, nil
@@ -70,9 +86,40 @@ func (l *Lock) GetLock(s *terraform.State) (terraform.LockInfo, error) {
 	defer l.mutex.Unlock()
 
 	lock, ok := l.db[s.ID]
-	if !ok {
+	if !ok || lock.Expired() {
 		return terraform.LockInfo{}, fmt.Errorf("no lock found for state %s", s.ID)
 	}
 
 	return lock, nil
 }
+
+func (l *Lock) ListLocks() (map[string]terraform.LockInfo, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	locks := make(map[string]terraform.LockInfo, len(l.db))
+
+	for id, lock := range l.db {
+		if !lock.Expired() {
+			locks[id] = lock
+		}
+	}
+
+	return locks, nil
+}
+
+func (l *Lock) ReapExpiredLocks() (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	count := 0
+
+	for id, lock := range l.db {
+		if lock.Expired() {
+			delete(l.db, id)
+			count++
+		}
+	}
+
+	return count, nil
+}
@@ -2,12 +2,31 @@ package local
 
 import (
 	"testing"
+	"time"
 
 	"github.com/nimbolus/terraform-backend/pkg/lock/util"
 )
 
 func TestLock(t *testing.T) {
-	l := NewLock()
+	l := NewLock(time.Hour)
 
 	util.LockTest(t, l)
 }
+
+func TestLockExpiry(t *testing.T) {
+	l := NewLock(500 * time.Millisecond)
+
+	util.LockExpiryTest(t, l, 500*time.Millisecond)
+}
+
+func TestConcurrentLock(t *testing.T) {
+	l := NewLock(time.Hour)
+
+	util.ConcurrentLockTest(t, l)
+}
+
+func TestListLocks(t *testing.T) {
+	l := NewLock(time.Hour)
+
+	util.ListLocksTest(t, l)
+}
@@ -13,6 +13,25 @@ type Locker interface {
 	GetLock(s *terraform.State) (terraform.LockInfo, error)
 }
 
+// Reaper is implemented by lock backends which need to clean up expired locks actively.
+type Reaper interface {
+	ReapExpiredLocks() (int, error)
+}
+
+// Lister is implemented by lock backends which can list all held locks, keyed by the state ID.
+type Lister interface {
+	ListLocks() (map[string]terraform.LockInfo, error)
+}
+
+// Unwrap returns the lock backend wrapped by l, or l itself if it isn't wrapped.
+func Unwrap(l Locker) Locker {
+	if w, ok := l.(interface{ Unwrap() Locker }); ok {
+		return Unwrap(w.Unwrap())
+	}
+
+	return l
+}
+
 type LockerWithForceUnlockEnabled struct {
 	Locker
 }
@@ -32,3 +51,7 @@ func (l *LockerWithForceUnlockEnabled) Unlock(state *terraform.State) (bool, err
 
 	return l.Locker.Unlock(state)
 }
+
+func (l *LockerWithForceUnlockEnabled) Unwrap() Locker {
+	return l.Locker
+}
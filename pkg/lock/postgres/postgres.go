@@ -7,20 +7,37 @@ import (
 	"fmt"
 	"time"
 
+	pgclient "github.com/nimbolus/terraform-backend/pkg/client/postgres"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/lock"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
 const Name = "postgres"
 
+func init() {
+	lock.Register(Name, func(cfg config.LockConfig, clients config.ClientsConfig) (lock.Locker, error) {
+		db, err := pgclient.NewClient(clients.Postgres)
+		if err != nil {
+			return nil, fmt.Errorf("creating postgres client: %w", err)
+		}
+
+		return NewLock(db, cfg.Postgres.Table, cfg.TTL)
+	})
+}
+
 type Lock struct {
 	db    *sql.DB
 	table string
+	ttl   time.Duration
 }
 
-func NewLock(db *sql.DB, table string) (*Lock, error) {
+// NewLock creates a Postgres lock backend, the locks expire after the given TTL (0 disables the expiry).
+func NewLock(db *sql.DB, table string, ttl time.Duration) (*Lock, error) {
 	l := &Lock{
 		db:    db,
 		table: table,
+		ttl:   ttl,
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
@@ -40,6 +57,10 @@ func NewLock(db *sql.DB, table string) (*Lock, error) {
 		return nil, fmt.Errorf("creating locks table: %w", err)
 	}
 
+	if _, err := tx.Exec(`ALTER TABLE ` + l.table + ` ADD COLUMN IF NOT EXISTS expires_at TIMESTAMP WITH TIME ZONE;`); err != nil {
+		return nil, fmt.Errorf("migrating locks table: %w", err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("committing locks table: %w", err)
 	}
@@ -63,26 +84,53 @@ func (l *Lock) Lock(s *terraform.State) (bool, error) {
 	defer tx.Rollback() // nolint: errcheck
 
 	var rawLock []byte
+	var expires sql.NullTime
 
-	if err := tx.QueryRow(`SELECT lock_data FROM `+l.table+` WHERE state_id = $1`, s.ID).Scan(&rawLock); err != nil {
+	err = tx.QueryRow(`SELECT lock_data, expires_at FROM `+l.table+` WHERE state_id = $1`, s.ID).Scan(&rawLock, &expires)
+	if err == nil && expires.Valid && time.Now().After(expires.Time) {
+		// the existing lock is expired and gets replaced
+		if _, err := tx.Exec(`DELETE FROM `+l.table+` WHERE state_id = $1`, s.ID); err != nil {
+			return false, err
+		}
+
+		err = sql.ErrNoRows
+	}
+
+	if err != nil {
 		if err == sql.ErrNoRows {
+			if l.ttl > 0 {
+				s.Lock.Expires = time.Now().Add(l.ttl)
+			}
+
 			lockBytes, err := json.Marshal(s.Lock)
 			if err != nil {
 				return false, err
 			}
 
-			if _, err := tx.Exec(`INSERT INTO `+l.table+` (state_id, lock_data) VALUES ($1, $2)`, s.ID, lockBytes); err != nil {
+			res, err := tx.Exec(`INSERT INTO `+l.table+` (state_id, lock_data, expires_at) VALUES ($1, $2, $3)
+				ON CONFLICT (state_id) DO NOTHING`,
+				s.ID, lockBytes, sql.NullTime{Time: s.Lock.Expires, Valid: !s.Lock.Expires.IsZero()})
+			if err != nil {
 				return false, err
 			}
 
-			if err := tx.Commit(); err != nil {
+			if inserted, err := res.RowsAffected(); err != nil {
 				return false, err
+			} else if inserted == 1 {
+				if err := tx.Commit(); err != nil {
+					return false, err
+				}
+
+				return true, nil
 			}
 
-			return true, nil
+			// the state was locked concurrently by someone else
+			if err := tx.QueryRow(`SELECT lock_data FROM `+l.table+` WHERE state_id = $1`, s.ID).Scan(&rawLock); err != nil {
+				return false, err
+			}
+		} else {
+			return false, err
 		}
-
-		return false, err
 	}
 
 	var lock terraform.LockInfo
@@ -149,7 +197,8 @@ func (l *Lock) GetLock(s *terraform.State) (terraform.LockInfo, error) {
 
 	var rawLock []byte
 
-	if err := l.db.QueryRowContext(ctx, `SELECT lock_data FROM `+l.table+` WHERE state_id = $1`, s.ID).Scan(&rawLock); err != nil {
+	if err := l.db.QueryRowContext(ctx, `SELECT lock_data FROM `+l.table+` WHERE state_id = $1
+		AND (expires_at IS NULL OR expires_at > $2)`, s.ID, time.Now()).Scan(&rawLock); err != nil {
 		return terraform.LockInfo{}, err
 	}
 
@@ -161,3 +210,51 @@ func (l *Lock) GetLock(s *terraform.State) (terraform.LockInfo, error) {
 
 	return lock, nil
 }
+
+func (l *Lock) ListLocks() (map[string]terraform.LockInfo, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := l.db.QueryContext(ctx, `SELECT state_id, lock_data FROM `+l.table+`
+		WHERE expires_at IS NULL OR expires_at > $1`, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	locks := make(map[string]terraform.LockInfo)
+
+	for rows.Next() {
+		var id string
+		var rawLock []byte
+
+		if err := rows.Scan(&id, &rawLock); err != nil {
+			return nil, err
+		}
+
+		var lock terraform.LockInfo
+
+		if err := json.Unmarshal(rawLock, &lock); err != nil {
+			return nil, fmt.Errorf("decoding lock of state %s: %w", id, err)
+		}
+
+		locks[id] = lock
+	}
+
+	return locks, rows.Err()
+}
+
+func (l *Lock) ReapExpiredLocks() (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	res, err := l.db.ExecContext(ctx, `DELETE FROM `+l.table+` WHERE expires_at <= $1`, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := res.RowsAffected()
+
+	return int(count), err
+}
@@ -2,6 +2,7 @@ package postgres
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -10,8 +11,29 @@ import (
 )
 
 func TestLock(t *testing.T) {
-	l, err := NewLock(postgrestest.NewIfIntegrationTest(t), "locks")
+	l, err := NewLock(postgrestest.NewIfIntegrationTest(t), "locks", time.Hour)
 	require.NoError(t, err)
 
 	util.LockTest(t, l)
 }
+
+func TestLockExpiry(t *testing.T) {
+	l, err := NewLock(postgrestest.NewIfIntegrationTest(t), "locks", 500*time.Millisecond)
+	require.NoError(t, err)
+
+	util.LockExpiryTest(t, l, 500*time.Millisecond)
+}
+
+func TestConcurrentLock(t *testing.T) {
+	l, err := NewLock(postgrestest.NewIfIntegrationTest(t), "locks", time.Hour)
+	require.NoError(t, err)
+
+	util.ConcurrentLockTest(t, l)
+}
+
+func TestListLocks(t *testing.T) {
+	l, err := NewLock(postgrestest.NewIfIntegrationTest(t), "locks", time.Hour)
+	require.NoError(t, err)
+
+	util.ListLocksTest(t, l)
+}
@@ -6,36 +6,67 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
-	"github.com/go-redsync/redsync/v4"
-	"github.com/go-redsync/redsync/v4/redis"
-	rsredigo "github.com/go-redsync/redsync/v4/redis/redigo"
 	redigo "github.com/gomodule/redigo/redis"
-	"github.com/google/uuid"
-	log "github.com/sirupsen/logrus"
 
+	redisclient "github.com/nimbolus/terraform-backend/pkg/client/redis"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/lock"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
 const (
-	Name    = "redis"
-	lockKey = "terraform-backend-state-lock"
+	Name      = "redis"
+	keyPrefix = "terraform-backend-lock:"
 )
 
-type Lock struct {
-	pool   *redigo.Pool
-	rsPool redis.Pool
-	client *redsync.Redsync
+func init() {
+	lock.Register(Name, func(cfg config.LockConfig, clients config.ClientsConfig) (lock.Locker, error) {
+		return NewLock(redisclient.NewPool(clients.Redis), cfg.TTL), nil
+	})
 }
 
-func NewLock(pool *redigo.Pool) *Lock {
-	rsPool := rsredigo.NewPool(pool)
+var (
+	// lockScript sets the lock of a state if it isn't locked yet, otherwise the current lock is returned.
+	// KEYS[1]: lock key, KEYS[2]: legacy lock key, ARGV[1]: encoded lock, ARGV[2]: expiry in milliseconds (0 disables
+	// the expiry)
+	lockScript = redigo.NewScript(2, `
+local current = redis.call('GET', KEYS[1]) or redis.call('GET', KEYS[2])
+if current then
+	return current
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+else
+	redis.call('SET', KEYS[1], ARGV[1])
+end
+return false
+`)
+
+	// unlockScript deletes the lock of a state only if it wasn't changed in the meantime.
+	// KEYS[1]: lock key, ARGV[1]: encoded lock
+	unlockScript = redigo.NewScript(1, `
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+)
+
+// Lock stores the lock of every state in its own key, which is changed atomically by Lua scripts.
+// Therefore locking different states doesn't interfere.
+type Lock struct {
+	pool *redigo.Pool
+	ttl  time.Duration
+}
 
+// NewLock creates a Redis lock backend, the locks expire after the given TTL (0 disables the expiry).
+func NewLock(pool *redigo.Pool, ttl time.Duration) *Lock {
 	return &Lock{
-		pool:   pool,
-		rsPool: rsPool,
-		client: redsync.New(rsPool),
+		pool: pool,
+		ttl:  ttl,
 	}
 }
 
@@ -43,165 +74,177 @@ func (r *Lock) GetName() string {
 	return Name
 }
 
-func (r *Lock) Lock(s *terraform.State) (locked bool, err error) {
-	mutex := r.client.NewMutex(lockKey, redsync.WithExpiry(12*time.Hour), redsync.WithTries(1), redsync.WithGenValueFunc(func() (string, error) {
-		return uuid.New().String(), nil
-	}))
-
-	// lock the global redis mutex
-	if err := mutex.Lock(); err != nil {
-		log.Errorf("failed to lock redsync mutex: %v", err)
-
+func (r *Lock) Lock(s *terraform.State) (bool, error) {
+	conn, err := r.pool.GetContext(context.Background())
+	if err != nil {
 		return false, err
 	}
 
-	defer func() {
-		// unlock the global redis mutex
-		if _, mutErr := mutex.Unlock(); mutErr != nil {
-			log.Errorf("failed to unlock redsync mutex: %v", mutErr)
+	defer conn.Close()
 
-			if err != nil {
-				err = errors.Join(err, mutErr)
-			}
-		}
-	}()
+	newLock := s.Lock
+	if r.ttl > 0 {
+		// the key expires in Redis, so expired locks don't need to be reaped
+		newLock.Expires = time.Now().Add(r.ttl)
+	}
 
-	// check if the state is already locked
-	lock, err := r.getLock(s)
+	value, err := encodeLock(newLock)
 	if err != nil {
-		if !errors.Is(err, redigo.ErrNil) {
-			return false, err
-		}
+		return false, err
+	}
 
-		// state is not locked
-		// set the lock for the state
-		if err := r.setLock(s); err != nil {
-			return false, err
-		}
+	reply, err := lockScript.Do(conn, getKey(s.ID), s.ID, value, r.ttl.Milliseconds())
+	if err != nil {
+		return false, err
+	}
 
+	if reply == nil {
 		// you have the lock now
+		s.Lock = newLock
+
 		return true, nil
 	}
 
-	// state is locked
-	if lock.Equal(s.Lock) {
-		return true, nil
+	current, err := redigo.String(reply, nil)
+	if err != nil {
+		return false, err
+	}
+
+	lock, err := decodeLock(current)
+	if err != nil {
+		return false, err
 	}
 
+	// if the lock is equal, you already have the lock
+	locked := lock.Equal(s.Lock)
 	s.Lock = lock
 
-	return false, nil
+	return locked, nil
 }
 
-func (r *Lock) Unlock(s *terraform.State) (unlocked bool, err error) {
-	mutex := r.client.NewMutex(lockKey, redsync.WithExpiry(12*time.Hour), redsync.WithTries(1), redsync.WithGenValueFunc(func() (string, error) {
-		return uuid.New().String(), nil
-	}))
-
-	// lock the global redis mutex
-	if err := mutex.Lock(); err != nil {
-		log.Errorf("failed to lock redsync mutex: %v", err)
-
+func (r *Lock) Unlock(s *terraform.State) (bool, error) {
+	conn, err := r.pool.GetContext(context.Background())
+	if err != nil {
 		return false, err
 	}
 
-	defer func() {
-		// unlock the global redis mutex
-		if _, mutErr := mutex.Unlock(); mutErr != nil {
-			log.Errorf("failed to unlock redsync mutex: %v", mutErr)
+	defer conn.Close()
 
-			if err != nil {
-				err = errors.Join(err, mutErr)
-			}
-		}
-	}()
+	key, current, err := getCurrent(conn, s.ID)
+	if errors.Is(err, redigo.ErrNil) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
 
-	lock, err := r.getLock(s)
+	lock, err := decodeLock(current)
 	if err != nil {
-		return false, nil
+		return false, err
 	}
 
 	if !lock.Equal(s.Lock) {
+		s.Lock = lock
+
 		return false, nil
 	}
 
-	if err := r.deleteLock(s); err != nil {
+	deleted, err := redigo.Int(unlockScript.Do(conn, key, current))
+	if err != nil {
 		return false, err
 	}
 
-	return true, nil
+	return deleted == 1, nil
 }
 
-func (r *Lock) GetLock(s *terraform.State) (lock terraform.LockInfo, err error) {
-	mutex := r.client.NewMutex(lockKey, redsync.WithExpiry(12*time.Hour), redsync.WithTries(1), redsync.WithGenValueFunc(func() (string, error) {
-		return uuid.New().String(), nil
-	}))
-
-	// lock the global redis mutex
-	if err := mutex.Lock(); err != nil {
-		log.Errorf("failed to lock redsync mutex: %v", err)
-
+func (r *Lock) GetLock(s *terraform.State) (terraform.LockInfo, error) {
+	conn, err := r.pool.GetContext(context.Background())
+	if err != nil {
 		return terraform.LockInfo{}, err
 	}
 
-	defer func() {
-		// unlock the global redis mutex
-		if _, mutErr := mutex.Unlock(); mutErr != nil {
-			log.Errorf("failed to unlock redsync mutex: %v", mutErr)
+	defer conn.Close()
 
-			if err != nil {
-				err = errors.Join(err, mutErr)
-			}
-		}
-	}()
+	_, current, err := getCurrent(conn, s.ID)
+	if err != nil {
+		return terraform.LockInfo{}, err
+	}
 
-	return r.getLock(s)
+	return decodeLock(current)
 }
 
-func (r *Lock) setLock(s *terraform.State) error {
-	ctx := context.Background()
-
-	conn, err := r.pool.GetContext(ctx)
+func (r *Lock) ListLocks() (map[string]terraform.LockInfo, error) {
+	conn, err := r.pool.GetContext(context.Background())
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	defer conn.Close()
 
-	rawLock, err := json.Marshal(s.Lock)
-	if err != nil {
-		return err
-	}
+	locks := make(map[string]terraform.LockInfo)
+	cursor := 0
 
-	lockString := base64.StdEncoding.EncodeToString(rawLock)
+	for {
+		reply, err := redigo.Values(conn.Do("SCAN", cursor, "MATCH", keyPrefix+"*", "COUNT", 100))
+		if err != nil {
+			return nil, err
+		}
 
-	reply, err := redigo.String(conn.Do("SET", s.ID, lockString, "NX", "PX", int(12*time.Hour/time.Millisecond)))
-	if err != nil {
-		return err
-	}
+		var keys []string
 
-	if reply != "OK" {
-		return fmt.Errorf("could not set lock for id %s", s.ID)
-	}
+		if _, err := redigo.Scan(reply, &cursor, &keys); err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			current, err := redigo.String(conn.Do("GET", key))
+			if errors.Is(err, redigo.ErrNil) {
+				// the lock was released or expired in the meantime
+				continue
+			} else if err != nil {
+				return nil, err
+			}
 
-	return nil
+			lock, err := decodeLock(current)
+			if err != nil {
+				return nil, fmt.Errorf("decoding lock %s: %w", key, err)
+			}
+
+			locks[strings.TrimPrefix(key, keyPrefix)] = lock
+		}
+
+		if cursor == 0 {
+			return locks, nil
+		}
+	}
 }
 
-func (r *Lock) getLock(s *terraform.State) (terraform.LockInfo, error) {
-	ctx := context.Background()
+func getKey(id string) string {
+	return keyPrefix + id
+}
 
-	conn, err := r.pool.GetContext(ctx)
-	if err != nil {
-		return terraform.LockInfo{}, err
+// getCurrent returns the key and the encoded lock of the state. Older versions stored the lock with the plain state ID
+// as key, these locks are still respected, so that the states stay locked while upgrading.
+func getCurrent(conn redigo.Conn, id string) (string, string, error) {
+	current, err := redigo.String(conn.Do("GET", getKey(id)))
+	if !errors.Is(err, redigo.ErrNil) {
+		return getKey(id), current, err
 	}
 
-	defer conn.Close()
+	current, err = redigo.String(conn.Do("GET", id))
+
+	return id, current, err
+}
 
-	value, err := redigo.String(conn.Do("GET", s.ID))
+func encodeLock(lock terraform.LockInfo) (string, error) {
+	rawLock, err := json.Marshal(lock)
 	if err != nil {
-		return terraform.LockInfo{}, err
+		return "", err
 	}
 
+	return base64.StdEncoding.EncodeToString(rawLock), nil
+}
+
+func decodeLock(value string) (terraform.LockInfo, error) {
 	rawLock, err := base64.StdEncoding.DecodeString(value)
 	if err != nil {
 		return terraform.LockInfo{}, err
@@ -215,25 +258,3 @@ func (r *Lock) getLock(s *terraform.State) (terraform.LockInfo, error) {
 
 	return lock, nil
 }
-
-func (r *Lock) deleteLock(s *terraform.State) error {
-	ctx := context.Background()
-
-	conn, err := r.pool.GetContext(ctx)
-	if err != nil {
-		return err
-	}
-
-	defer conn.Close()
-
-	count, err := redigo.Int(conn.Do("DEL", s.ID))
-	if err != nil {
-		return err
-	}
-
-	if count != 1 {
-		return fmt.Errorf("deleted %d redis keys while unlocking id %s", count, s.ID)
-	}
-
-	return nil
-}
@@ -2,7 +2,9 @@ package redis
 
 import (
 	"testing"
+	"time"
 
+	redigo "github.com/gomodule/redigo/redis"
 	"github.com/google/uuid"
 
 	"github.com/nimbolus/terraform-backend/pkg/client/redis/redistest"
@@ -11,13 +13,31 @@ import (
 )
 
 func TestLock(t *testing.T) {
-	l := NewLock(redistest.NewPoolIfIntegrationTest(t))
+	l := NewLock(redistest.NewPoolIfIntegrationTest(t), time.Hour)
 
 	util.LockTest(t, l)
 }
 
+func TestLockExpiry(t *testing.T) {
+	l := NewLock(redistest.NewPoolIfIntegrationTest(t), 500*time.Millisecond)
+
+	util.LockExpiryTest(t, l, 500*time.Millisecond)
+}
+
+func TestConcurrentLock(t *testing.T) {
+	l := NewLock(redistest.NewPoolIfIntegrationTest(t), time.Hour)
+
+	util.ConcurrentLockTest(t, l)
+}
+
+func TestListLocks(t *testing.T) {
+	l := NewLock(redistest.NewPoolIfIntegrationTest(t), time.Hour)
+
+	util.ListLocksTest(t, l)
+}
+
 func TestGetLock(t *testing.T) {
-	l := NewLock(redistest.NewPoolIfIntegrationTest(t))
+	l := NewLock(redistest.NewPoolIfIntegrationTest(t), time.Hour)
 
 	expectedLock := uuid.New().String()
 
@@ -29,15 +49,30 @@ func TestGetLock(t *testing.T) {
 	}
 
 	{
-		err := l.setLock(s)
+		locked, err := l.Lock(s)
+		if err != nil || !locked {
+			t.Error(err)
+		}
+	}
+
+	// the lock is stored in its own key, which expires with the lock
+	{
+		conn := l.pool.Get()
+		defer conn.Close()
+
+		ttl, err := redigo.Int64(conn.Do("PTTL", getKey(s.ID)))
 		if err != nil {
 			t.Error(err)
 		}
+
+		if ttl <= 0 || ttl > time.Hour.Milliseconds() {
+			t.Errorf("unexpected lock key ttl: %d", ttl)
+		}
 	}
 
 	// retrieve it again
 	{
-		lock, err := l.getLock(s)
+		lock, err := l.GetLock(s)
 		if err != nil {
 			t.Error(err)
 		}
@@ -49,8 +84,78 @@ func TestGetLock(t *testing.T) {
 
 	// delete lock
 	{
-		err := l.deleteLock(s)
+		unlocked, err := l.Unlock(s)
+		if err != nil || !unlocked {
+			t.Error(err)
+		}
+	}
+}
+
+func TestLegacyLock(t *testing.T) {
+	l := NewLock(redistest.NewPoolIfIntegrationTest(t), time.Hour)
+
+	s := &terraform.State{
+		ID:      terraform.GetStateID("test", "legacy"),
+		Project: "test",
+		Name:    "legacy",
+		Lock:    terraform.LockInfo{ID: uuid.New().String()},
+	}
+
+	// a lock set by an older version with the plain state ID as key
+	{
+		value, err := encodeLock(s.Lock)
 		if err != nil {
+			t.Fatal(err)
+		}
+
+		conn := l.pool.Get()
+		defer conn.Close()
+
+		if _, err := conn.Do("SET", s.ID, value, "PX", time.Hour.Milliseconds()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// other lock holders are rejected
+	{
+		other := *s
+		other.Lock = terraform.LockInfo{ID: uuid.New().String()}
+
+		locked, err := l.Lock(&other)
+		if err != nil || locked {
+			t.Errorf("state locked despite legacy lock: %v", err)
+		}
+
+		if other.Lock.ID != s.Lock.ID {
+			t.Errorf("lock mismatch: %s != %s", other.Lock.ID, s.Lock.ID)
+		}
+	}
+
+	{
+		lock, err := l.GetLock(s)
+		if err != nil {
+			t.Error(err)
+		}
+
+		if lock.ID != s.Lock.ID {
+			t.Errorf("lock mismatch: %s != %s", lock.ID, s.Lock.ID)
+		}
+	}
+
+	// the holder can release the legacy lock
+	{
+		unlocked, err := l.Unlock(s)
+		if err != nil || !unlocked {
+			t.Error(err)
+		}
+
+		locked, err := l.Lock(s)
+		if err != nil || !locked {
+			t.Error(err)
+		}
+
+		unlocked, err = l.Unlock(s)
+		if err != nil || !unlocked {
 			t.Error(err)
 		}
 	}
@@ -1,6 +1,8 @@
 package util
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
@@ -83,3 +85,236 @@ func LockTest(t *testing.T, l lock.Locker) {
 		t.Error(err)
 	}
 }
+
+// LockExpiryTest verifies that a lock created by l with the given TTL expires.
+func LockExpiryTest(t *testing.T, l lock.Locker, ttl time.Duration) {
+	t.Log(l.GetName())
+
+	s1 := terraform.State{
+		ID:      terraform.GetStateID("test", "expiry"),
+		Project: "test",
+		Name:    "expiry",
+		Lock: terraform.LockInfo{
+			ID:        uuid.New().String(),
+			Operation: "LockExpiryTest",
+			Who:       "test",
+			Version:   "0.0.0",
+			Created:   time.Now().String(),
+		},
+	}
+
+	s2 := s1
+	s2.Lock.ID = uuid.New().String()
+
+	if locked, err := l.Lock(&s1); err != nil || !locked {
+		t.Fatal(err)
+	}
+
+	if lock, err := l.GetLock(&s1); err != nil {
+		t.Error(err)
+	} else if lock.Expires.IsZero() || lock.Expires.After(time.Now().Add(ttl)) {
+		t.Errorf("lock should expire within %s: %s", ttl, lock.Expires)
+	}
+
+	if locked, err := l.Lock(&s2); err != nil || locked {
+		t.Error("should not be able to lock before the lock expired")
+	}
+
+	if s2.Lock.Expires.IsZero() {
+		t.Error("failed Lock() should return the expiry of the current lock")
+	}
+
+	time.Sleep(ttl + 100*time.Millisecond)
+
+	if _, err := l.GetLock(&s1); err == nil {
+		t.Error("expired lock should not be returned")
+	}
+
+	s2.Lock.Expires = time.Time{}
+
+	if locked, err := l.Lock(&s2); err != nil || !locked {
+		t.Errorf("should be able to lock after the lock expired: %v", err)
+	}
+
+	if reaper, ok := l.(lock.Reaper); ok {
+		time.Sleep(ttl + 100*time.Millisecond)
+
+		if count, err := reaper.ReapExpiredLocks(); err != nil || count < 1 {
+			t.Errorf("should reap the expired lock: %d %v", count, err)
+		}
+
+		if unlocked, err := l.Unlock(&s2); err != nil || unlocked {
+			t.Error("should not be able to unlock a reaped lock")
+		}
+
+		return
+	}
+
+	if unlocked, err := l.Unlock(&s2); err != nil || !unlocked {
+		t.Error(err)
+	}
+}
+
+// ConcurrentLockTest verifies that l serializes concurrent lock attempts on the same state, while different
+// states can be locked independently.
+func ConcurrentLockTest(t *testing.T, l lock.Locker) {
+	t.Log(l.GetName())
+
+	const workers = 20
+
+	newState := func(name string) *terraform.State {
+		return &terraform.State{
+			ID:      terraform.GetStateID("test", name),
+			Project: "test",
+			Name:    name,
+			Lock: terraform.LockInfo{
+				ID:        uuid.New().String(),
+				Operation: "ConcurrentLockTest",
+				Who:       "test",
+				Version:   "0.0.0",
+				Created:   time.Now().String(),
+			},
+		}
+	}
+
+	// every worker locks its own state
+	{
+		states := make([]*terraform.State, workers)
+		for i := range states {
+			states[i] = newState(fmt.Sprintf("concurrent-%d", i))
+		}
+
+		var wg sync.WaitGroup
+		errs := make(chan error, workers)
+
+		for _, s := range states {
+			wg.Add(1)
+
+			go func(s *terraform.State) {
+				defer wg.Done()
+
+				if locked, err := l.Lock(s); err != nil {
+					errs <- err
+				} else if !locked {
+					errs <- fmt.Errorf("state %s is locked by %s", s.Name, s.Lock.ID)
+				}
+			}(s)
+		}
+
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			t.Errorf("should be able to lock different states concurrently: %v", err)
+		}
+
+		for _, s := range states {
+			if unlocked, err := l.Unlock(s); err != nil || !unlocked {
+				t.Errorf("failed to unlock state %s: %v", s.Name, err)
+			}
+		}
+	}
+
+	// all workers compete for the same state
+	{
+		states := make([]*terraform.State, workers)
+		for i := range states {
+			states[i] = newState("contended")
+		}
+
+		var wg sync.WaitGroup
+		locked := make([]bool, workers)
+		errs := make([]error, workers)
+
+		for i, s := range states {
+			wg.Add(1)
+
+			go func(i int, s *terraform.State) {
+				defer wg.Done()
+
+				locked[i], errs[i] = l.Lock(s)
+			}(i, s)
+		}
+
+		wg.Wait()
+
+		var owner *terraform.State
+
+		for i, s := range states {
+			if errs[i] != nil {
+				t.Errorf("failed to lock state: %v", errs[i])
+			} else if locked[i] {
+				if owner != nil {
+					t.Errorf("state was locked by %s and %s at the same time", owner.Lock.ID, s.Lock.ID)
+				}
+
+				owner = s
+			}
+		}
+
+		if owner == nil {
+			t.Fatal("state should be locked by one of the workers")
+		}
+
+		for i, s := range states {
+			if errs[i] == nil && !locked[i] && !s.Lock.Equal(owner.Lock) {
+				t.Errorf("failed Lock() should return the lock of the owner: %s != %s", s.Lock, owner.Lock)
+			}
+		}
+
+		if unlocked, err := l.Unlock(owner); err != nil || !unlocked {
+			t.Error(err)
+		}
+	}
+}
+
+// ListLocksTest verifies that l lists the held locks, if it implements lock.Lister.
+func ListLocksTest(t *testing.T, l lock.Locker) {
+	t.Log(l.GetName())
+
+	lister, ok := l.(lock.Lister)
+	if !ok {
+		t.Skipf("lock backend %s doesn't support listing", l.GetName())
+	}
+
+	s1 := terraform.State{
+		ID:      terraform.GetStateID("test", "list"),
+		Project: "test",
+		Name:    "list",
+		Lock: terraform.LockInfo{
+			ID:        uuid.New().String(),
+			Operation: "ListLocksTest",
+			Who:       "test",
+			Version:   "0.0.0",
+			Created:   time.Now().String(),
+		},
+	}
+
+	if locked, err := l.Lock(&s1); err != nil || !locked {
+		t.Fatal(err)
+	}
+
+	locks, err := lister.ListLocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lock, ok := locks[s1.ID]; !ok {
+		t.Error("held lock should be listed")
+	} else if !lock.Equal(s1.Lock) {
+		t.Errorf("lock is not equal: %s != %s", lock, s1.Lock)
+	}
+
+	if unlocked, err := l.Unlock(&s1); err != nil || !unlocked {
+		t.Error(err)
+	}
+
+	locks, err = lister.ListLocks()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := locks[s1.ID]; ok {
+		t.Error("released lock should not be listed")
+	}
+}
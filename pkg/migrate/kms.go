@@ -0,0 +1,177 @@
+package migrate
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/kms"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// KMSOptions control the migration of states to another KMS.
+type KMSOptions struct {
+	// DryRun decrypts and encrypts every state, but doesn't write anything.
+	DryRun bool
+	// Resume skips states, which can already be decrypted with the target KMS.
+	Resume bool
+}
+
+// Result summarizes a migration.
+type Result struct {
+	Migrated int
+	Skipped  int
+	// Locked contains the states which were skipped, because they were locked by someone else
+	Locked []string
+	Failed []string
+}
+
+// KMS re-encrypts all states of store (including their versions, if supported by the storage backend) from the source
+// to the target KMS. The migration is meant to run offline, so the states are not locked.
+func KMS(store storage.Storage, source, target kms.KMS, opts KMSOptions) (*Result, error) {
+	lister, ok := store.(storage.Lister)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s does not support listing", store.GetName())
+	}
+
+	versioned, _ := store.(storage.Versioned)
+	writer, _ := store.(storage.VersionWriter)
+	importer, _ := store.(storage.Importer)
+
+	if versioned != nil && writer == nil && !opts.DryRun {
+		return nil, fmt.Errorf("storage backend %s does not support writing versions", store.GetName())
+	}
+
+	// the current state is written without creating a version, which would duplicate the latest version
+	if importer == nil && !opts.DryRun {
+		return nil, fmt.Errorf("storage backend %s does not support importing states", store.GetName())
+	}
+
+	infos, err := lister.ListStates()
+	if err != nil {
+		return nil, fmt.Errorf("listing states: %w", err)
+	}
+
+	result := &Result{
+		Failed: []string{},
+	}
+
+	for i, info := range infos {
+		logger := log.WithFields(log.Fields{
+			"progress": fmt.Sprintf("%d/%d", i+1, len(infos)),
+			"state_id": info.ID,
+			"project":  info.Project,
+			"name":     info.Name,
+		})
+
+		migrated, err := migrateStateKMS(info.ID, store, versioned, writer, importer, source, target, opts)
+		switch {
+		case err != nil:
+			logger.WithError(err).Error("failed to migrate state")
+			result.Failed = append(result.Failed, info.ID)
+		case !migrated:
+			logger.Info("skipped state, it's already encrypted with the target KMS")
+			result.Skipped++
+		case opts.DryRun:
+			logger.Info("state can be migrated (dry run)")
+			result.Migrated++
+		default:
+			logger.Info("migrated state")
+			result.Migrated++
+		}
+	}
+
+	return result, nil
+}
+
+func migrateStateKMS(id string, store storage.Storage, versioned storage.Versioned, writer storage.VersionWriter,
+	importer storage.Importer, source, target kms.KMS, opts KMSOptions) (bool, error) {
+	ad := []byte(id)
+
+	state, err := store.GetState(id)
+	if err != nil {
+		return false, fmt.Errorf("getting state: %w", err)
+	}
+
+	// the current state is written last, so a state which can be decrypted with the target KMS is complete
+	if opts.Resume && len(state.Data) > 0 {
+		if _, err := target.Decrypt(state.Data, ad); err == nil {
+			return false, nil
+		}
+	}
+
+	var versions []storage.StateVersion
+	versionData := make(map[int][]byte)
+
+	if versioned != nil {
+		if versions, err = versioned.ListStateVersions(id); err != nil {
+			return false, fmt.Errorf("listing versions: %w", err)
+		}
+	}
+
+	// every version is re-encrypted before anything is written, so that a state isn't migrated partially
+	for _, v := range versions {
+		stateVersion, err := versioned.GetStateVersion(id, v.Version)
+		if err != nil {
+			return false, fmt.Errorf("getting version %d: %w", v.Version, err)
+		}
+
+		data, err := reencrypt(stateVersion.Data, ad, source, target, opts.Resume)
+		if err != nil {
+			return false, fmt.Errorf("re-encrypting version %d: %w", v.Version, err)
+		}
+
+		versionData[v.Version] = data
+	}
+
+	data, err := reencrypt(state.Data, ad, source, target, false)
+	if err != nil {
+		return false, fmt.Errorf("re-encrypting state: %w", err)
+	}
+
+	if opts.DryRun {
+		return true, nil
+	}
+
+	for _, v := range versions {
+		if err := writer.PutStateVersion(id, v, versionData[v.Version]); err != nil {
+			return false, fmt.Errorf("writing version %d: %w", v.Version, err)
+		}
+	}
+
+	state.Data = data
+
+	if err := importer.ImportState(state); err != nil {
+		return false, fmt.Errorf("writing state: %w", err)
+	}
+
+	return true, nil
+}
+
+// reencrypt decrypts d with the source and encrypts it with the target KMS. If resume is set, data which is already
+// encrypted with the target KMS (by an interrupted migration) is returned as is.
+func reencrypt(d, ad []byte, source, target kms.KMS, resume bool) ([]byte, error) {
+	if len(d) == 0 {
+		return d, nil
+	}
+
+	plaintext, err := source.Decrypt(d, ad)
+	if err != nil {
+		if !resume {
+			return nil, err
+		}
+
+		if _, targetErr := target.Decrypt(d, ad); targetErr != nil {
+			return nil, err
+		}
+
+		return d, nil
+	}
+
+	if _, err := terraform.ParseStateFile(plaintext); err != nil {
+		log.WithField("state_id", string(ad)).Warnf("decrypted data is not a valid state: %v", err)
+	}
+
+	return target.Encrypt(plaintext, ad)
+}
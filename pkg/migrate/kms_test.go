@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/kms/local"
+	"github.com/nimbolus/terraform-backend/pkg/storage/filesystem"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestKMS(t *testing.T) {
+	store, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	source, err := local.NewKMS("x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY=")
+	require.NoError(t, err)
+
+	target, err := local.NewKMS("jwS6UpASMOWpEmFn7C6I47BlmPt4cpdmYLKd2E7a4Zk=")
+	require.NoError(t, err)
+
+	id := terraform.GetStateID("project1", "example")
+	states := []string{
+		`{"version": 4, "serial": 1, "lineage": "a1b2"}`,
+		`{"version": 4, "serial": 2, "lineage": "a1b2"}`,
+	}
+
+	for _, plain := range states {
+		data, err := source.Encrypt([]byte(plain), []byte(id))
+		require.NoError(t, err)
+
+		require.NoError(t, store.SaveState(&terraform.State{ID: id, Project: "project1", Name: "example", Data: data}))
+	}
+
+	result, err := KMS(store, source, target, KMSOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Migrated)
+
+	// a dry run doesn't change anything
+	current, err := store.GetState(id)
+	require.NoError(t, err)
+	_, err = source.Decrypt(current.Data, []byte(id))
+	require.NoError(t, err)
+
+	result, err = KMS(store, source, target, KMSOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Migrated)
+	require.Empty(t, result.Failed)
+
+	current, err = store.GetState(id)
+	require.NoError(t, err)
+
+	decrypted, err := target.Decrypt(current.Data, []byte(id))
+	require.NoError(t, err)
+	require.Equal(t, states[1], string(decrypted))
+
+	// the versions are rewritten in place, the migration doesn't add a version
+	versions, err := store.ListStateVersions(id)
+	require.NoError(t, err)
+	require.Len(t, versions, len(states))
+
+	for i, plain := range states {
+		version, err := store.GetStateVersion(id, i+1)
+		require.NoError(t, err)
+
+		decrypted, err := target.Decrypt(version.Data, []byte(id))
+		require.NoError(t, err)
+		require.Equal(t, plain, string(decrypted))
+	}
+
+	// migrated states can't be decrypted with the source KMS anymore
+	result, err = KMS(store, source, target, KMSOptions{})
+	require.NoError(t, err)
+	require.Len(t, result.Failed, 1)
+
+	result, err = KMS(store, source, target, KMSOptions{Resume: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Skipped)
+	require.Empty(t, result.Failed)
+
+	// an interrupted migration is resumed without adding a version
+	current.Data, err = source.Encrypt([]byte(states[1]), []byte(id))
+	require.NoError(t, err)
+	require.NoError(t, store.ImportState(current))
+
+	result, err = KMS(store, source, target, KMSOptions{Resume: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Migrated)
+	require.Empty(t, result.Failed)
+
+	versions, err = store.ListStateVersions(id)
+	require.NoError(t, err)
+	require.Len(t, versions, len(states))
+}
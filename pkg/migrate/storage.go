@@ -0,0 +1,245 @@
+package migrate
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/lock"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+var errStateLocked = errors.New("state is locked")
+
+// StorageOptions control the migration of states to another storage backend.
+type StorageOptions struct {
+	// DryRun compares the states of both storage backends, but doesn't copy anything.
+	DryRun bool
+}
+
+// Storage copies all states of source (including their metadata and versions, if supported by both storage backends)
+// to target. States which already match in both backends are skipped, so the copy can be repeated until no state
+// differs. Every state is locked while it's copied, states which are locked by someone else are skipped. After the copy
+// the checksums of the state and its versions are compared.
+func Storage(source, target storage.Storage, locker lock.Locker, opts StorageOptions) (*Result, error) {
+	lister, ok := source.(storage.Lister)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s does not support listing", source.GetName())
+	}
+
+	if _, ok := target.(storage.Importer); !ok && !opts.DryRun {
+		return nil, fmt.Errorf("storage backend %s does not support importing states", target.GetName())
+	}
+
+	if _, ok := source.(storage.Versioned); ok && !opts.DryRun {
+		if _, ok := target.(storage.VersionWriter); !ok {
+			log.Warnf("storage backend %s does not support writing versions, only the current states are copied", target.GetName())
+		}
+	}
+
+	infos, err := lister.ListStates()
+	if err != nil {
+		return nil, fmt.Errorf("listing states: %w", err)
+	}
+
+	result := &Result{
+		Locked: []string{},
+		Failed: []string{},
+	}
+
+	for i, info := range infos {
+		logger := log.WithFields(log.Fields{
+			"progress": fmt.Sprintf("%d/%d", i+1, len(infos)),
+			"state_id": info.ID,
+			"project":  info.Project,
+			"name":     info.Name,
+		})
+
+		copied, err := copyState(info.ID, source, target, locker, opts)
+		switch {
+		case errors.Is(err, errStateLocked):
+			logger.Warn("skipped locked state, run the migration again later")
+			result.Locked = append(result.Locked, info.ID)
+		case err != nil:
+			logger.WithError(err).Error("failed to copy state")
+			result.Failed = append(result.Failed, info.ID)
+		case !copied:
+			logger.Info("skipped state, it's already up to date in the target storage")
+			result.Skipped++
+		case opts.DryRun:
+			logger.Info("state differs and would be copied (dry run)")
+			result.Migrated++
+		default:
+			logger.Info("copied and verified state")
+			result.Migrated++
+		}
+	}
+
+	return result, nil
+}
+
+// storedState is the current state and its versions as stored by a storage backend.
+type storedState struct {
+	state    *terraform.State
+	versions []storage.StateVersion
+	data     map[int][]byte
+}
+
+func copyState(id string, source, target storage.Storage, locker lock.Locker, opts StorageOptions) (bool, error) {
+	if !opts.DryRun {
+		unlock, err := lockState(id, locker)
+		if err != nil {
+			return false, err
+		}
+		defer unlock()
+	}
+
+	src, err := readState(id, source)
+	if err != nil {
+		return false, fmt.Errorf("reading source state: %w", err)
+	}
+
+	dst, err := readState(id, target)
+	if err != nil && !errors.Is(err, storage.ErrStateNotFound) {
+		return false, fmt.Errorf("reading target state: %w", err)
+	}
+
+	// versions can only be compared if they are copied
+	_, versioned := target.(storage.Versioned)
+	if _, ok := target.(storage.VersionWriter); !ok {
+		versioned = false
+	}
+
+	if dst != nil && verify(src, dst, versioned) == nil {
+		return false, nil
+	}
+
+	if opts.DryRun {
+		return true, nil
+	}
+
+	if writer, ok := target.(storage.VersionWriter); ok {
+		for _, v := range src.versions {
+			if err := writer.PutStateVersion(id, v, src.data[v.Version]); err != nil {
+				return false, fmt.Errorf("writing version %d: %w", v.Version, err)
+			}
+		}
+	}
+
+	// the current state is written last, so that a state is only complete if all versions were copied
+	if err := target.(storage.Importer).ImportState(src.state); err != nil {
+		return false, fmt.Errorf("importing state: %w", err)
+	}
+
+	if dst, err = readState(id, target); err != nil {
+		return false, fmt.Errorf("reading copied state: %w", err)
+	}
+
+	if err := verify(src, dst, versioned); err != nil {
+		return false, fmt.Errorf("verifying copied state: %w", err)
+	}
+
+	return true, nil
+}
+
+// lockState locks the state while it's copied, so that it isn't changed in between. The returned function unlocks it.
+func lockState(id string, locker lock.Locker) (func(), error) {
+	migrateLock := terraform.LockInfo{
+		ID:        uuid.New().String(),
+		Operation: "Migrate",
+		Who:       "terraform-backend",
+		Created:   time.Now().UTC().Format(time.RFC3339),
+		Info:      "copy state to another storage backend",
+	}
+
+	state := &terraform.State{ID: id, Lock: migrateLock}
+
+	if ok, err := locker.Lock(state); err != nil {
+		return nil, fmt.Errorf("locking state: %w", err)
+	} else if !ok {
+		return nil, errStateLocked
+	}
+
+	return func() {
+		state.Lock = migrateLock
+		if _, err := locker.Unlock(state); err != nil {
+			log.Errorf("failed to unlock state with id %s after migration: %v", id, err)
+		}
+	}, nil
+}
+
+func readState(id string, s storage.Storage) (*storedState, error) {
+	state, err := s.GetState(id)
+	if err != nil {
+		return nil, err
+	}
+
+	stored := &storedState{
+		state: state,
+		data:  make(map[int][]byte),
+	}
+
+	versioned, ok := s.(storage.Versioned)
+	if !ok {
+		return stored, nil
+	}
+
+	if stored.versions, err = versioned.ListStateVersions(id); err != nil {
+		return nil, fmt.Errorf("listing versions: %w", err)
+	}
+
+	for _, v := range stored.versions {
+		version, err := versioned.GetStateVersion(id, v.Version)
+		if err != nil {
+			return nil, fmt.Errorf("getting version %d: %w", v.Version, err)
+		}
+
+		stored.data[v.Version] = version.Data
+	}
+
+	return stored, nil
+}
+
+// verify compares the checksums of the state data and of all versions, if the target keeps versions.
+func verify(src, dst *storedState, versioned bool) error {
+	if checksum(src.state.Data) != checksum(dst.state.Data) {
+		return fmt.Errorf("checksum of state data differs")
+	}
+
+	if src.state.Project != dst.state.Project || src.state.Name != dst.state.Name ||
+		src.state.Metadata.AuthMethod != dst.state.Metadata.AuthMethod ||
+		src.state.Metadata.LastWriter != dst.state.Metadata.LastWriter ||
+		src.state.Metadata.Serial != dst.state.Metadata.Serial || src.state.Metadata.Lineage != dst.state.Metadata.Lineage {
+		return fmt.Errorf("metadata differs")
+	}
+
+	if !versioned {
+		return nil
+	}
+
+	if len(src.versions) != len(dst.versions) {
+		return fmt.Errorf("number of versions differs: %d != %d", len(src.versions), len(dst.versions))
+	}
+
+	for _, v := range src.versions {
+		d, ok := dst.data[v.Version]
+		if !ok {
+			return fmt.Errorf("version %d is missing", v.Version)
+		}
+
+		if checksum(src.data[v.Version]) != checksum(d) {
+			return fmt.Errorf("checksum of version %d differs", v.Version)
+		}
+	}
+
+	return nil
+}
+
+func checksum(d []byte) [sha256.Size]byte {
+	return sha256.Sum256(d)
+}
@@ -0,0 +1,95 @@
+package migrate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/lock/local"
+	"github.com/nimbolus/terraform-backend/pkg/storage/filesystem"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestStorage(t *testing.T) {
+	source, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	target, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	locker := local.NewLock(0)
+
+	state := &terraform.State{
+		ID:       terraform.GetStateID("project1", "example"),
+		Project:  "project1",
+		Name:     "example",
+		Metadata: terraform.Metadata{AuthMethod: "basic", LastWriter: "user@example"},
+	}
+
+	versions := []string{"v1", "v2", "v3"}
+	for _, d := range versions {
+		state.Data = []byte(d)
+		require.NoError(t, source.SaveState(state))
+	}
+
+	result, err := Storage(source, target, locker, StorageOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Migrated)
+
+	// a dry run doesn't copy anything
+	infos, err := target.ListStates()
+	require.NoError(t, err)
+	require.Empty(t, infos)
+
+	result, err = Storage(source, target, locker, StorageOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Migrated)
+	require.Empty(t, result.Failed)
+
+	copied, err := target.GetState(state.ID)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v3"), copied.Data)
+	require.Equal(t, state.Project, copied.Project)
+	require.Equal(t, state.Name, copied.Name)
+	require.Equal(t, "user@example", copied.Metadata.LastWriter)
+	require.True(t, state.Metadata.Created.Equal(copied.Metadata.Created))
+
+	copiedVersions, err := target.ListStateVersions(state.ID)
+	require.NoError(t, err)
+	require.Len(t, copiedVersions, len(versions))
+
+	for i, d := range versions {
+		version, err := target.GetStateVersion(state.ID, i+1)
+		require.NoError(t, err)
+		require.Equal(t, d, string(version.Data))
+	}
+
+	// states which are up to date are skipped
+	result, err = Storage(source, target, locker, StorageOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Skipped)
+
+	// locked states are skipped
+	state.Lock = terraform.LockInfo{ID: "other", Who: "someone"}
+	ok, err := locker.Lock(state)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	state.Data = []byte("v4")
+	require.NoError(t, source.SaveState(state))
+
+	result, err = Storage(source, target, locker, StorageOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{state.ID}, result.Locked)
+
+	_, err = locker.Unlock(state)
+	require.NoError(t, err)
+
+	result, err = Storage(source, target, locker, StorageOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Migrated)
+
+	copied, err = target.GetState(state.ID)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v4"), copied.Data)
+}
@@ -0,0 +1,36 @@
+package policy
+
+import (
+	"sync"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+var (
+	mu sync.RWMutex
+	// active is the policy evaluated for all requests, it's set on startup by Configure
+	active *Policy
+)
+
+// Configure sets the policy evaluated by Authorize, nil disables the evaluation.
+func Configure(p *Policy) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	active = p
+}
+
+// Authorize evaluates the policy for the operation on the state by the identity, which was authenticated by
+// auth.Authenticate. Without a policy all requests are allowed, so that only the auth backends decide.
+func Authorize(identity *auth.Identity, s *terraform.State, op auth.Operation) Decision {
+	mu.RLock()
+	p := active
+	mu.RUnlock()
+
+	if p == nil {
+		return Decision{Allowed: true}
+	}
+
+	return p.Evaluate(identity, s.Project, s.Name, op)
+}
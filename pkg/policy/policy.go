@@ -0,0 +1,224 @@
+// Package policy evaluates declarative access rules against the identity of a request, the state and the operation.
+// It's evaluated after the authentication, so a request has to be permitted by the auth backend and the policy.
+package policy
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/spf13/viper"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/pattern"
+)
+
+const (
+	Allow = "allow"
+	Deny  = "deny"
+)
+
+// Policy contains the rules and the test cases of a policy file. A request is denied, if a deny rule matches or no
+// allow rule matches.
+type Policy struct {
+	// Match is the syntax of all patterns (exact, glob or regex)
+	Match string `mapstructure:"match"`
+	Rules []Rule `mapstructure:"rules"`
+	Tests []Test `mapstructure:"tests"`
+}
+
+// Rule matches a request, if all of its set conditions match. Each list matches, if any of its patterns matches.
+type Rule struct {
+	Name string `mapstructure:"name"`
+	// Effect is allow (default) or deny
+	Effect   string   `mapstructure:"effect"`
+	Backends []string `mapstructure:"backends"`
+	Subjects []string `mapstructure:"subjects"`
+	// Groups matches, if any group of the identity matches any of the patterns
+	Groups []string `mapstructure:"groups"`
+	// Claims maps claim paths (separated by dots) to patterns, which have to match all. The keys are matched
+	// case-insensitively, since they're lower-cased when the file is loaded.
+	Claims map[string]string `mapstructure:"claims"`
+	// States are patterns of <project>/<name>
+	States     []string `mapstructure:"states"`
+	Operations []string `mapstructure:"operations"`
+
+	operations []auth.Operation
+	// the compiled patterns of the conditions
+	backends, subjects, groups, states []*regexp.Regexp
+	claims                             map[string]*regexp.Regexp
+}
+
+// Decision is the result of the evaluation of a request.
+type Decision struct {
+	Allowed bool
+	// Rule is the name of the rule, which decided, it's empty if no rule matched
+	Rule string
+}
+
+func (d Decision) String() string {
+	verdict := "denied"
+	if d.Allowed {
+		verdict = "allowed"
+	}
+
+	if d.Rule == "" {
+		return verdict + " (no rule matched)"
+	}
+
+	return fmt.Sprintf("%s by rule %s", verdict, d.Rule)
+}
+
+// Load reads the policy file, the format is derived from the file extension (e.g. yaml, toml or json).
+func Load(file string) (*Policy, error) {
+	v := viper.New()
+	v.SetConfigFile(file)
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, fmt.Errorf("reading policy file %s: %w", file, err)
+	}
+
+	p := &Policy{}
+	if err := v.UnmarshalExact(p); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", file, err)
+	}
+
+	if err := p.compile(); err != nil {
+		return nil, fmt.Errorf("invalid policy file %s: %w", file, err)
+	}
+
+	return p, nil
+}
+
+// compile sets the defaults and checks the rules.
+func (p *Policy) compile() error {
+	if p.Match == "" {
+		p.Match = string(pattern.Glob)
+	}
+
+	if !pattern.Syntax(p.Match).Valid() {
+		return fmt.Errorf("unknown pattern syntax %q (supported: exact, glob, regex)", p.Match)
+	}
+
+	for i := range p.Rules {
+		r := &p.Rules[i]
+
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rules[%d]", i)
+		}
+
+		if r.Effect == "" {
+			r.Effect = Allow
+		} else if r.Effect != Allow && r.Effect != Deny {
+			return fmt.Errorf("rule %s: unknown effect %q (supported: allow, deny)", r.Name, r.Effect)
+		}
+
+		if len(r.States) == 0 || len(r.Operations) == 0 {
+			return fmt.Errorf("rule %s: states and operations are required", r.Name)
+		}
+
+		ops, err := auth.ParseOperations(r.Operations)
+		if err != nil {
+			return fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+		r.operations = ops
+
+		// patterns are compiled once, so that invalid patterns are reported on startup
+		syntax := pattern.Syntax(p.Match)
+		for _, c := range []struct {
+			patterns []string
+			compiled *[]*regexp.Regexp
+		}{
+			{r.Backends, &r.backends},
+			{r.Subjects, &r.subjects},
+			{r.Groups, &r.groups},
+			{r.States, &r.states},
+		} {
+			if *c.compiled, err = compileAll(syntax, c.patterns); err != nil {
+				return fmt.Errorf("rule %s: %w", r.Name, err)
+			}
+		}
+
+		r.claims = make(map[string]*regexp.Regexp, len(r.Claims))
+		for claim, claimPattern := range r.Claims {
+			if r.claims[claim], err = pattern.Compile(syntax, claimPattern); err != nil {
+				return fmt.Errorf("rule %s: %w", r.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func compileAll(syntax pattern.Syntax, patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+
+	for _, ptrn := range patterns {
+		re, err := pattern.Compile(syntax, ptrn)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, re)
+	}
+
+	return compiled, nil
+}
+
+// Evaluate decides whether the identity may perform the operation on the state of the project.
+func (p *Policy) Evaluate(identity *auth.Identity, project, name string, op auth.Operation) Decision {
+	var allowedBy string
+
+	for _, r := range p.Rules {
+		if !r.matches(identity, project+"/"+name, op) {
+			continue
+		}
+
+		if r.Effect == Deny {
+			return Decision{Allowed: false, Rule: r.Name}
+		}
+
+		if allowedBy == "" {
+			allowedBy = r.Name
+		}
+	}
+
+	return Decision{Allowed: allowedBy != "", Rule: allowedBy}
+}
+
+func (r *Rule) matches(identity *auth.Identity, state string, op auth.Operation) bool {
+	if !slices.Contains(r.operations, op) {
+		return false
+	}
+
+	if !matchAny(r.states, state) {
+		return false
+	}
+
+	if len(r.backends) > 0 && !matchAny(r.backends, identity.Backend) {
+		return false
+	}
+
+	if len(r.subjects) > 0 && !matchAny(r.subjects, identity.Subject) {
+		return false
+	}
+
+	if len(r.groups) > 0 && !slices.ContainsFunc(identity.Groups, func(group string) bool {
+		return matchAny(r.groups, group)
+	}) {
+		return false
+	}
+
+	for claim, re := range r.claims {
+		// a claim, which isn't a string, a list of strings or a scalar, doesn't match
+		values, _ := auth.ClaimValues(identity.Claims, claim)
+		if !slices.ContainsFunc(values, re.MatchString) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func matchAny(patterns []*regexp.Regexp, value string) bool {
+	return slices.ContainsFunc(patterns, func(re *regexp.Regexp) bool { return re.MatchString(value) })
+}
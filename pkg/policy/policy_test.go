@@ -0,0 +1,140 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+)
+
+const testPolicy = `
+rules:
+  - name: infra
+    groups: [infra]
+    states: ["prod/*", "dev/*"]
+    operations: [read, lock, write]
+  - name: devs-read-prod
+    groups: [devs]
+    states: ["prod/*"]
+    operations: [read]
+  - name: devs-write-dev
+    groups: [devs]
+    states: ["dev/*"]
+    operations: [read, lock, write]
+  - name: admins
+    groups: [admins]
+    states: ["*"]
+    operations: ["*"]
+  - name: protected-ci
+    backends: [gitlab]
+    claims:
+      ref_protected: "true"
+    states: ["prod/*"]
+    operations: [read, lock, write]
+  - name: nimbolus-actions
+    backends: [github]
+    claims:
+      repositoryOwner: nimbolus
+    states: ["apps/*"]
+    operations: [read]
+  - name: no-legacy
+    effect: deny
+    backends: [basic]
+    states: ["prod/*"]
+    operations: ["*"]
+tests:
+  - name: infra writes prod
+    identity: {groups: [infra]}
+    state: prod/network
+    operation: write
+    allowed: true
+  - name: infra can't delete
+    identity: {groups: [infra]}
+    state: prod/network
+    operation: delete
+    allowed: false
+  - name: devs read prod
+    identity: {groups: [devs]}
+    state: prod/network
+    operation: read
+    allowed: true
+`
+
+func writePolicy(t *testing.T, content string) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(content), 0600))
+
+	return file
+}
+
+func TestEvaluate(t *testing.T) {
+	p, err := Load(writePolicy(t, testPolicy))
+	require.NoError(t, err)
+	require.Empty(t, p.RunTests())
+
+	tests := []struct {
+		name     string
+		identity auth.Identity
+		state    string
+		op       auth.Operation
+		decision Decision
+	}{
+		{"infra write prod", auth.Identity{Groups: []string{"infra"}}, "prod/network", auth.Write, Decision{true, "infra"}},
+		{"infra delete prod", auth.Identity{Groups: []string{"infra"}}, "prod/network", auth.Delete, Decision{false, ""}},
+		{"devs read prod", auth.Identity{Groups: []string{"other", "devs"}}, "prod/network", auth.Read, Decision{true, "devs-read-prod"}},
+		{"devs write prod", auth.Identity{Groups: []string{"devs"}}, "prod/network", auth.Write, Decision{false, ""}},
+		{"devs write dev", auth.Identity{Groups: []string{"devs"}}, "dev/network", auth.Write, Decision{true, "devs-write-dev"}},
+		{"admins delete", auth.Identity{Groups: []string{"admins"}}, "prod/network", auth.Delete, Decision{true, "admins"}},
+		{"no groups", auth.Identity{}, "dev/network", auth.Read, Decision{false, ""}},
+		{"protected ci", auth.Identity{Backend: "gitlab", Claims: map[string]any{"ref_protected": true}}, "prod/app", auth.Write, Decision{true, "protected-ci"}},
+		{"unprotected ci", auth.Identity{Backend: "gitlab", Claims: map[string]any{"ref_protected": false}}, "prod/app", auth.Write, Decision{false, ""}},
+		{"mixed-case claim", auth.Identity{Backend: "github", Claims: map[string]any{"repositoryOwner": "nimbolus"}}, "apps/web", auth.Read, Decision{true, "nimbolus-actions"}},
+		{"mixed-case claim other value", auth.Identity{Backend: "github", Claims: map[string]any{"repositoryOwner": "other"}}, "apps/web", auth.Read, Decision{false, ""}},
+		{"deny wins", auth.Identity{Backend: "basic", Groups: []string{"admins"}}, "prod/app", auth.Read, Decision{false, "no-legacy"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			project, name, _ := strings.Cut(test.state, "/")
+			require.Equal(t, test.decision, p.Evaluate(&test.identity, project, name, test.op))
+		})
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	p, err := Load(writePolicy(t, testPolicy+`
+  - name: wrong expectation
+    identity: {groups: [devs]}
+    state: prod/network
+    operation: delete
+    allowed: true
+`))
+	require.NoError(t, err)
+
+	failures := p.RunTests()
+	require.Len(t, failures, 1)
+	require.ErrorContains(t, failures[0], "wrong expectation: delete of prod/network was denied (no rule matched), expected allowed=true")
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]string{
+		"unknown key":       "rules:\n  - state: [\"*\"]\n",
+		"missing states":    "rules:\n  - operations: [read]\n",
+		"unknown operation": "rules:\n  - states: [\"*\"]\n    operations: [admin]\n",
+		"unknown effect":    "rules:\n  - states: [\"*\"]\n    operations: [read]\n    effect: maybe\n",
+		"invalid regex":     "match: regex\nrules:\n  - states: [\"prod/(\"]\n    operations: [read]\n",
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writePolicy(t, content))
+			require.Error(t, err)
+		})
+	}
+}
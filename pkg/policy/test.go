@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+)
+
+// Test is a test case of a policy file, which is evaluated offline by the policy test command.
+type Test struct {
+	Name     string       `mapstructure:"name"`
+	Identity TestIdentity `mapstructure:"identity"`
+	// State is <project>/<name>
+	State     string `mapstructure:"state"`
+	Operation string `mapstructure:"operation"`
+	Allowed   bool   `mapstructure:"allowed"`
+}
+
+type TestIdentity struct {
+	Backend string         `mapstructure:"backend"`
+	Subject string         `mapstructure:"subject"`
+	Groups  []string       `mapstructure:"groups"`
+	Claims  map[string]any `mapstructure:"claims"`
+}
+
+// RunTests evaluates the test cases of the policy and returns the failed ones.
+func (p *Policy) RunTests() []error {
+	var failures []error
+
+	for i, test := range p.Tests {
+		name := test.Name
+		if name == "" {
+			name = fmt.Sprintf("tests[%d]", i)
+		}
+
+		project, state, ok := strings.Cut(test.State, "/")
+		if !ok {
+			failures = append(failures, fmt.Errorf("%s: state %q isn't in the format <project>/<name>", name, test.State))
+			continue
+		}
+
+		op := auth.Operation(test.Operation)
+		if _, err := auth.ParseOperations([]string{test.Operation}); err != nil || test.Operation == "*" {
+			failures = append(failures, fmt.Errorf("%s: unknown operation %q", name, test.Operation))
+			continue
+		}
+
+		identity := &auth.Identity{
+			Backend: test.Identity.Backend,
+			Subject: test.Identity.Subject,
+			Groups:  test.Identity.Groups,
+			Claims:  test.Identity.Claims,
+		}
+
+		if d := p.Evaluate(identity, project, state, op); d.Allowed != test.Allowed {
+			failures = append(failures, fmt.Errorf("%s: %s of %s was %s, expected allowed=%t", name, op, test.State, d, test.Allowed))
+		}
+	}
+
+	return failures
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/audit"
+	"github.com/nimbolus/terraform-backend/pkg/lock"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// operations of the admin API in the audit log
+const (
+	forceUnlockOperation = "force-unlock"
+	rotateOperation      = "rotate"
+)
+
+// AdminLock is returned by the admin API for every held lock.
+type AdminLock struct {
+	StateID string             `json:"state_id"`
+	Project string             `json:"project,omitempty"`
+	Name    string             `json:"name,omitempty"`
+	Lock    terraform.LockInfo `json:"lock"`
+}
+
+// AdminLocksHandler lists all held locks (GET) or a single lock of the state in the path (GET), and force-releases
+// the lock of a state (DELETE). The request has to be authenticated by basic auth with the admin token as password,
+// the username is recorded as admin in the audit log.
+func AdminLocksHandler(store storage.Storage, locker lock.Locker, token string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Infof("%s %s", r.Method, r.URL.Path)
+
+		admin, ok := authenticateAdmin(w, r, token)
+		if !ok {
+			return
+		}
+
+		id, hasID := mux.Vars(r)["id"]
+
+		switch {
+		case r.Method == http.MethodGet && !hasID:
+			ListLocks(w, r, locker, store)
+		case r.Method == http.MethodGet:
+			GetAdminLock(w, r, id, locker, store)
+		case r.Method == http.MethodDelete && hasID:
+			ForceReleaseLock(w, r, admin, id, locker)
+		default:
+			HTTPResponse(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+	}
+}
+
+func ListLocks(w http.ResponseWriter, r *http.Request, locker lock.Locker, store storage.Storage) {
+	lister, ok := lock.Unwrap(locker).(lock.Lister)
+	if !ok {
+		HTTPResponse(w, r, http.StatusNotImplemented, "Lock backend does not support listing")
+		return
+	}
+
+	locks, err := lister.ListLocks()
+	if err != nil {
+		log.Errorf("failed to list locks: %v", err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	infos := getStateInfos(store)
+	entries := []AdminLock{}
+
+	for id, lockInfo := range locks {
+		info := infos[id]
+		entries = append(entries, AdminLock{
+			StateID: id,
+			Project: info.Project,
+			Name:    info.Name,
+			Lock:    lockInfo,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].StateID < entries[j].StateID
+	})
+
+	body, err := json.Marshal(entries)
+	if err != nil {
+		log.Errorf("failed to marshal locks: %v", err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	HTTPResponse(w, r, http.StatusOK, string(body))
+}
+
+func GetAdminLock(w http.ResponseWriter, r *http.Request, id string, locker lock.Locker, store storage.Storage) {
+	lockInfo, err := locker.GetLock(&terraform.State{ID: id})
+	if err != nil {
+		log.Debugf("no lock found for state with id %s: %v", id, err)
+		HTTPResponse(w, r, http.StatusNotFound, "")
+		return
+	}
+
+	entry := AdminLock{
+		StateID: id,
+		Lock:    lockInfo,
+	}
+
+	// the state doesn't exist yet, if it was locked before it was saved for the first time
+	if stored, err := store.GetState(id); err == nil {
+		entry.Project, entry.Name = stored.Project, stored.Name
+	} else if !errors.Is(err, storage.ErrStateNotFound) {
+		log.Warnf("failed to get state with id %s for lock: %v", id, err)
+	}
+
+	body, err := json.Marshal(entry)
+	if err != nil {
+		log.Errorf("failed to marshal lock: %v", err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	HTTPResponse(w, r, http.StatusOK, string(body))
+}
+
+// ForceReleaseLock releases the current lock of a state regardless of its holder.
+func ForceReleaseLock(w http.ResponseWriter, r *http.Request, admin, id string, locker lock.Locker) {
+	rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	w = rec
+
+	e := audit.Event{StateID: id, Operation: forceUnlockOperation}
+	defer func() { auditAdmin(r, admin, rec.code, e) }()
+
+	state := &terraform.State{ID: id}
+
+	lockInfo, err := locker.GetLock(state)
+	if err != nil {
+		log.Debugf("no lock found for state with id %s: %v", id, err)
+		HTTPResponse(w, r, http.StatusNotFound, "")
+		return
+	}
+
+	state.Lock = lockInfo
+	e.LockID = lockInfo.ID
+
+	if ok, err := locker.Unlock(state); err != nil {
+		log.Errorf("failed to force-release lock of state with id %s: %v", id, err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	} else if !ok {
+		// the lock was changed in the meantime, the admin has to check the new lock first
+		HTTPResponse(w, r, http.StatusConflict, "Lock changed while releasing")
+		return
+	}
+
+	log.Warnf("lock %s of state with id %s (held by %s) force-released by admin %s", lockInfo.ID, id, lockInfo.Who, admin)
+
+	HTTPResponse(w, r, http.StatusOK, "")
+}
+
+// authenticateAdmin checks the admin token of the request and returns the name of the admin.
+// If the authentication fails, the response is written and false is returned.
+func authenticateAdmin(w http.ResponseWriter, r *http.Request, token string) (string, bool) {
+	admin, password, ok := r.BasicAuth()
+	if !ok {
+		HTTPResponse(w, r, http.StatusForbidden, "no basic auth header found")
+		return "", false
+	}
+
+	if token == "" || subtle.ConstantTimeCompare([]byte(password), []byte(token)) != 1 {
+		log.Warnf("admin authentication failed for %s from %s", admin, r.RemoteAddr)
+		HTTPResponse(w, r, http.StatusForbidden, "Permission denied")
+		return "", false
+	}
+
+	return admin, true
+}
+
+// getStateInfos returns the stored states by their ID, so that project and name can be shown for locks.
+func getStateInfos(store storage.Storage) map[string]storage.StateInfo {
+	infos := make(map[string]storage.StateInfo)
+
+	lister, ok := store.(storage.Lister)
+	if !ok {
+		return infos
+	}
+
+	states, err := lister.ListStates()
+	if err != nil {
+		log.Warnf("failed to list states for locks: %v", err)
+		return infos
+	}
+
+	for _, info := range states {
+		infos[info.ID] = info
+	}
+
+	return infos
+}
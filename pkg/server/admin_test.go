@@ -0,0 +1,58 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestAdminLocksHandler(t *testing.T) {
+	s := newTestServer(t)
+	address := s.URL + "/state/project1/example"
+
+	lockInfo, err := json.Marshal(&tf.LockInfo{ID: "cf290ef3-6090-410e-9784-d017a4b1536a", Who: "user@host", Operation: "OperationTypeApply"})
+	require.NoError(t, err)
+
+	code, _ := doRequest(t, "LOCK", address, lockInfo)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"?ID=cf290ef3-6090-410e-9784-d017a4b1536a", []byte(`{"version": 4, "serial": 1, "lineage": "a1b2"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	// the state credentials don't grant admin access
+	code, _ = doRequest(t, http.MethodGet, s.URL+"/admin/locks", nil)
+	require.Equal(t, http.StatusForbidden, code)
+
+	code, body := doRequestWithAuth(t, http.MethodGet, s.URL+"/admin/locks", nil, "admin", testAdminToken)
+	require.Equal(t, http.StatusOK, code)
+
+	var locks []AdminLock
+	require.NoError(t, json.Unmarshal(body, &locks))
+	require.Len(t, locks, 1)
+	require.Equal(t, "project1", locks[0].Project)
+	require.Equal(t, "example", locks[0].Name)
+	require.Equal(t, "user@host", locks[0].Lock.Who)
+
+	id := locks[0].StateID
+
+	code, body = doRequestWithAuth(t, http.MethodGet, s.URL+"/admin/locks/"+id, nil, "admin", testAdminToken)
+	require.Equal(t, http.StatusOK, code)
+
+	var lock AdminLock
+	require.NoError(t, json.Unmarshal(body, &lock))
+	require.Equal(t, locks[0], lock)
+
+	code, _ = doRequestWithAuth(t, http.MethodDelete, s.URL+"/admin/locks/"+id, nil, "admin", testAdminToken)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequestWithAuth(t, http.MethodDelete, s.URL+"/admin/locks/"+id, nil, "admin", testAdminToken)
+	require.Equal(t, http.StatusNotFound, code)
+
+	// the state can be locked by someone else now
+	code, _ = doRequest(t, "LOCK", address, []byte(`{"ID": "0a8e4a5c-3b51-4c5e-9d5b-5f1f0f3c4e2d"}`))
+	require.Equal(t, http.StatusOK, code)
+}
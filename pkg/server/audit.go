@@ -0,0 +1,100 @@
+package server
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/nimbolus/terraform-backend/pkg/audit"
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// statusRecorder records the response code for the audit log.
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// auditState writes the audit event of a request to the state endpoint. The identity was resolved by the
+// authentication of the request, it's nil if the credentials were rejected.
+func auditState(r *http.Request, body []byte, code int, identity *auth.Identity, authenticated bool) {
+	if !audit.Enabled() {
+		return
+	}
+
+	e := audit.Event{Operation: string(stateOperations[r.Method])}
+
+	switch r.Method {
+	case "LOCK", "UNLOCK":
+		var lock terraform.LockInfo
+		if json.Unmarshal(body, &lock) == nil {
+			e.LockID = lock.ID
+		}
+	case http.MethodPost:
+		e.LockID = r.URL.Query().Get("ID")
+
+		if f, err := terraform.ParseStateFile(body); err == nil {
+			e.Serial = &f.Serial
+		}
+	}
+
+	auditRequest(r, code, identity, authenticated, e)
+}
+
+// auditRequest completes the audit event of a request, which is authenticated by the auth backends, and writes it.
+// Project and state are taken from the path. The identity is nil, if the credentials were rejected.
+func auditRequest(r *http.Request, code int, identity *auth.Identity, authenticated bool, e audit.Event) {
+	if !audit.Enabled() {
+		return
+	}
+
+	vars := mux.Vars(r)
+	e.Time = time.Now().UTC()
+	e.Authenticated = authenticated
+	e.Project, e.State = vars["project"], vars["name"]
+	e.Method = r.Method
+	e.Code = code
+	e.ClientIP = clientIP(r)
+	e.ForwardedFor = r.Header.Get("X-Forwarded-For")
+
+	if identity != nil {
+		e.AuthMethod, e.Subject = identity.Backend, identity.Subject
+	} else {
+		// the credentials were rejected, so only the selected backend is known
+		e.AuthMethod = auth.Method(r)
+	}
+
+	audit.Log(e)
+}
+
+// auditAdmin writes the audit event of a request to the admin API, which was authenticated by the admin token.
+func auditAdmin(r *http.Request, admin string, code int, e audit.Event) {
+	e.Time = time.Now().UTC()
+	e.Subject = admin
+	e.AuthMethod = "admin"
+	e.Authenticated = true
+	e.Method = r.Method
+	e.Code = code
+	e.ClientIP = clientIP(r)
+	e.ForwardedFor = r.Header.Get("X-Forwarded-For")
+
+	audit.Log(e)
+}
+
+// clientIP returns the address of the connection without the port.
+func clientIP(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+
+	return r.RemoteAddr
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/audit"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+func TestAudit(t *testing.T) {
+	file := configureAudit(t)
+
+	s := newTestServer(t)
+	address := s.URL + "/state/project1/example"
+	lockID := "cf290ef3-6090-410e-9784-d017a4b1536a"
+
+	code, _ := doRequest(t, "LOCK", address, []byte(`{"ID": "`+lockID+`"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"?ID="+lockID, []byte(`{"version": 4, "serial": 3, "lineage": "a1b2"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequestWithAuth(t, http.MethodGet, address, nil, "unknown", "secret")
+	require.Equal(t, http.StatusForbidden, code)
+
+	code, _ = doRequest(t, "PATCH", address, nil)
+	require.Equal(t, http.StatusNotImplemented, code)
+
+	var events []audit.Event
+	for _, e := range readAuditEvents(t, file) {
+		require.Equal(t, "project1", e.Project)
+		require.Equal(t, "example", e.State)
+
+		e.Project, e.State = "", ""
+		events = append(events, e)
+	}
+
+	serial := uint64(3)
+	require.Equal(t, []audit.Event{
+		{AuthMethod: "basic", Authenticated: true, Method: "LOCK", Operation: "lock", LockID: lockID, Code: http.StatusOK},
+		{AuthMethod: "basic", Authenticated: true, Method: http.MethodPost, Operation: "write", LockID: lockID, Serial: &serial, Code: http.StatusOK},
+		{Method: http.MethodGet, Operation: "read", Code: http.StatusForbidden},
+		{AuthMethod: "basic", Method: "PATCH", Code: http.StatusNotImplemented},
+	}, events)
+}
+
+func TestAuditVersions(t *testing.T) {
+	file := configureAudit(t)
+
+	s := newTestServer(t)
+	address := s.URL + "/state/project1/example"
+
+	lockID := "cf290ef3-6090-410e-9784-d017a4b1536a"
+
+	code, _ := doRequest(t, "LOCK", address, []byte(`{"ID": "`+lockID+`"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	for _, serial := range []string{"1", "2"} {
+		code, _ = doRequest(t, http.MethodPost, address+"?ID="+lockID, []byte(`{"version": 4, "serial": `+serial+`, "lineage": "a1b2"}`))
+		require.Equal(t, http.StatusOK, code)
+	}
+
+	code, _ = doRequest(t, "UNLOCK", address, []byte(`{"ID": "`+lockID+`"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodGet, address+"/versions", nil)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodGet, address+"/versions/1", nil)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequestWithAuth(t, http.MethodGet, address+"/versions/1", nil, "unknown", "secret")
+	require.Equal(t, http.StatusForbidden, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"/versions/1/restore", nil)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"/versions/9/restore", nil)
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, _ = doRequest(t, http.MethodGet, s.URL+"/states", nil)
+	require.Equal(t, http.StatusOK, code)
+
+	events := readAuditEvents(t, file)
+	require.Len(t, events, 10)
+
+	// the restored state gets the serial after the current one
+	serial := uint64(3)
+	require.Equal(t, []audit.Event{
+		{AuthMethod: "basic", Authenticated: true, Project: "project1", State: "example", Method: http.MethodGet, Operation: "list-versions", Code: http.StatusOK},
+		{AuthMethod: "basic", Authenticated: true, Project: "project1", State: "example", Method: http.MethodGet, Operation: "read-version", Code: http.StatusOK},
+		{Project: "project1", State: "example", Method: http.MethodGet, Operation: "read-version", Code: http.StatusForbidden},
+		{AuthMethod: "basic", Authenticated: true, Project: "project1", State: "example", Method: http.MethodPost, Operation: "restore", Serial: &serial, Code: http.StatusOK},
+		{AuthMethod: "basic", Authenticated: true, Project: "project1", State: "example", Method: http.MethodPost, Operation: "restore", Code: http.StatusNotFound},
+		{AuthMethod: "basic", Authenticated: true, Method: http.MethodGet, Operation: "list", Code: http.StatusOK},
+	}, events[4:])
+}
+
+func TestAuditAdmin(t *testing.T) {
+	file := configureAudit(t)
+
+	s := newTestServer(t)
+	lockID := "cf290ef3-6090-410e-9784-d017a4b1536a"
+
+	code, _ := doRequest(t, "LOCK", s.URL+"/state/project1/example", []byte(`{"ID": "`+lockID+`"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	code, body := doRequestWithAuth(t, http.MethodGet, s.URL+"/admin/locks", nil, "alice", testAdminToken)
+	require.Equal(t, http.StatusOK, code)
+
+	var locks []AdminLock
+	require.NoError(t, json.Unmarshal(body, &locks))
+	require.Len(t, locks, 1)
+
+	id := locks[0].StateID
+
+	code, _ = doRequestWithAuth(t, http.MethodDelete, s.URL+"/admin/locks/"+id, nil, "alice", testAdminToken)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequestWithAuth(t, http.MethodDelete, s.URL+"/admin/locks/"+id, nil, "alice", testAdminToken)
+	require.Equal(t, http.StatusNotFound, code)
+
+	code, _ = doRequestWithAuth(t, http.MethodPost, s.URL+"/admin/kms/rotate", nil, "alice", testAdminToken)
+	require.Equal(t, http.StatusOK, code)
+
+	events := readAuditEvents(t, file)
+	require.Len(t, events, 4)
+	require.Equal(t, []audit.Event{
+		{Subject: "alice", AuthMethod: "admin", Authenticated: true, StateID: id, Method: http.MethodDelete, Operation: "force-unlock", LockID: lockID, Code: http.StatusOK},
+		{Subject: "alice", AuthMethod: "admin", Authenticated: true, StateID: id, Method: http.MethodDelete, Operation: "force-unlock", Code: http.StatusNotFound},
+		{Subject: "alice", AuthMethod: "admin", Authenticated: true, Method: http.MethodPost, Operation: "rotate", Code: http.StatusOK},
+	}, events[1:])
+}
+
+// configureAudit writes the audit log of the test to a file and returns its name.
+func configureAudit(t *testing.T) string {
+	t.Helper()
+
+	file := filepath.Join(t.TempDir(), "audit.log")
+
+	l, err := audit.New(config.AuditConfig{Sink: "file", File: file})
+	require.NoError(t, err)
+
+	audit.Configure(l)
+	t.Cleanup(func() {
+		audit.Configure(nil)
+		_ = l.Close()
+	})
+
+	return file
+}
+
+// readAuditEvents returns the events of the audit log without time and client IP, which are checked for every event.
+func readAuditEvents(t *testing.T, file string) []audit.Event {
+	t.Helper()
+
+	f, err := os.Open(file)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var events []audit.Event
+	for scanner := bufio.NewScanner(f); scanner.Scan(); {
+		var e audit.Event
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &e))
+
+		require.False(t, e.Time.IsZero())
+		require.Equal(t, "127.0.0.1", e.ClientIP)
+
+		e.Time, e.ClientIP = time.Time{}, ""
+		events = append(events, e)
+	}
+
+	return events
+}
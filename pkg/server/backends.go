@@ -0,0 +1,60 @@
+package server
+
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/kms"
+	"github.com/nimbolus/terraform-backend/pkg/lock"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+
+	// the built-in backends register themselves in their init functions
+	_ "github.com/nimbolus/terraform-backend/pkg/auth/basic"
+	_ "github.com/nimbolus/terraform-backend/pkg/auth/github"
+	_ "github.com/nimbolus/terraform-backend/pkg/auth/gitlab"
+	_ "github.com/nimbolus/terraform-backend/pkg/auth/htpasswd"
+	_ "github.com/nimbolus/terraform-backend/pkg/auth/jwt"
+	_ "github.com/nimbolus/terraform-backend/pkg/auth/ldap"
+	_ "github.com/nimbolus/terraform-backend/pkg/auth/mtls"
+	_ "github.com/nimbolus/terraform-backend/pkg/auth/token"
+	_ "github.com/nimbolus/terraform-backend/pkg/auth/vault"
+	_ "github.com/nimbolus/terraform-backend/pkg/kms/local"
+	_ "github.com/nimbolus/terraform-backend/pkg/kms/transit"
+	_ "github.com/nimbolus/terraform-backend/pkg/kms/vault"
+	_ "github.com/nimbolus/terraform-backend/pkg/lock/local"
+	_ "github.com/nimbolus/terraform-backend/pkg/lock/postgres"
+	_ "github.com/nimbolus/terraform-backend/pkg/lock/redis"
+	_ "github.com/nimbolus/terraform-backend/pkg/storage/filesystem"
+	_ "github.com/nimbolus/terraform-backend/pkg/storage/postgres"
+	_ "github.com/nimbolus/terraform-backend/pkg/storage/s3"
+)
+
+// ValidateBackends checks that the configured backends are registered and that the patterns of the auth backends
+// are supported, so that a typo is reported by config validate instead of on startup.
+func ValidateBackends(cfg *config.Config) error {
+	var errs []error
+
+	check := func(key, backend string, registered []string) {
+		if !slices.Contains(registered, backend) {
+			errs = append(errs, config.Invalid(key, "unknown backend %q (registered: %s)", backend,
+				strings.Join(registered, ", ")))
+		}
+	}
+
+	check("storage.backend", cfg.Storage.Backend, storage.Backends())
+	check("lock.backend", cfg.Lock.Backend, lock.Backends())
+	check("kms.backend", cfg.KMS.Backend, kms.Backends())
+
+	if cfg.Storage.MirrorEnabled {
+		check("target_storage.backend", cfg.TargetStorage.Backend, storage.Backends())
+	}
+
+	if err := auth.Validate(cfg.Auth); err != nil {
+		errs = append(errs, err)
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,45 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/storage/filesystem"
+)
+
+func TestCustomBackend(t *testing.T) {
+	dir := t.TempDir()
+
+	storage.Register("custom", func(_ config.StorageConfig, _ config.ClientsConfig) (storage.Storage, error) {
+		return filesystem.NewFileSystemStorage(dir)
+	})
+
+	cfg := config.Default()
+	cfg.Storage.Backend = "custom"
+	require.NoError(t, ValidateBackends(cfg))
+
+	s, err := GetStorage(cfg)
+	require.NoError(t, err)
+	require.Equal(t, filesystem.Name, s.GetName())
+
+	require.Panics(t, func() {
+		storage.Register("custom", nil)
+	})
+}
+
+func TestValidateBackends(t *testing.T) {
+	cfg := config.Default()
+	cfg.Storage.Backend = "gcs"
+	cfg.Lock.Backend = "etcd"
+
+	err := ValidateBackends(cfg)
+	require.ErrorContains(t, err, `storage.backend (STORAGE_BACKEND): unknown backend "gcs" (registered: `)
+	require.ErrorContains(t, err, `lock.backend (LOCK_BACKEND): unknown backend "etcd" (registered: local, postgres, redis)`)
+	require.NotContains(t, err.Error(), "kms.backend")
+
+	_, err = GetStorage(cfg)
+	require.ErrorContains(t, err, "storage backend gcs is not implemented")
+}
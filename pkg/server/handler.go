@@ -15,6 +15,7 @@ import (
 	"github.com/nimbolus/terraform-backend/pkg/auth"
 	"github.com/nimbolus/terraform-backend/pkg/kms"
 	"github.com/nimbolus/terraform-backend/pkg/lock"
+	"github.com/nimbolus/terraform-backend/pkg/policy"
 	"github.com/nimbolus/terraform-backend/pkg/storage"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
@@ -38,6 +39,14 @@ func HealthHandler(w http.ResponseWriter, r *http.Request) {
 
 func StateHandler(store storage.Storage, locker lock.Locker, kms kms.KMS) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		w = rec
+
+		var identity *auth.Identity
+		var authenticated bool
+		var body []byte
+		defer func() { auditState(r, body, rec.code, identity, authenticated) }()
+
 		body, err := io.ReadAll(r.Body)
 		defer r.Body.Close()
 		if err != nil {
@@ -45,25 +54,19 @@ func StateHandler(store storage.Storage, locker lock.Locker, kms kms.KMS) func(h
 			return
 		}
 
-		vars := mux.Vars(r)
-		state := &terraform.State{
-			ID:      terraform.GetStateID(vars["project"], vars["name"]),
-			Project: vars["project"],
-			Name:    vars["name"],
-		}
-
 		log.Infof("%s %s", r.Method, r.URL.Path)
 		log.Tracef("request: %s %s: %s", r.Method, r.URL.Path, body)
 
-		if ok, err := auth.Authenticate(r, state); err != nil {
-			log.Warnf("failed process authentication for state id %s: %v", state.ID, err)
-			HTTPResponse(w, r, http.StatusForbidden, err.Error())
+		op, ok := stateOperations[r.Method]
+		if !ok {
+			log.Warnf("unknown method %s called", r.Method)
+			HTTPResponse(w, r, http.StatusNotImplemented, "Not implemented")
 
 			return
-		} else if !ok {
-			log.Warnf("failed to authenticate request for state id %s", state.ID)
-			HTTPResponse(w, r, http.StatusForbidden, "Permission denied")
+		}
 
+		state, id, ok := authenticateState(w, r, op)
+		if identity, authenticated = id, ok; !ok {
 			return
 		}
 
@@ -78,15 +81,61 @@ func StateHandler(store storage.Storage, locker lock.Locker, kms kms.KMS) func(h
 			Post(w, r, state, body, locker, store, kms)
 		case http.MethodDelete:
 			Delete(w, r, state, store)
-		default:
-			log.Warnf("unknown method %s called", r.Method)
-			HTTPResponse(w, r, http.StatusNotImplemented, "Not implemented")
-
-			return
 		}
 	}
 }
 
+// stateOperations maps the methods of the state endpoint to the operations, which have to be permitted.
+var stateOperations = map[string]auth.Operation{
+	"LOCK":            auth.Lock,
+	"UNLOCK":          auth.Lock,
+	http.MethodGet:    auth.Read,
+	http.MethodPost:   auth.Write,
+	http.MethodDelete: auth.Delete,
+}
+
+// authenticateState builds the state from the request path, authenticates the request for the operation on it and
+// evaluates the policy. If either fails, the response is written and false is returned. The identity is returned
+// even if it's denied, so that it can be recorded.
+func authenticateState(w http.ResponseWriter, r *http.Request, op auth.Operation) (*terraform.State, *auth.Identity, bool) {
+	vars := mux.Vars(r)
+	state := &terraform.State{
+		ID:      terraform.GetStateID(vars["project"], vars["name"]),
+		Project: vars["project"],
+		Name:    vars["name"],
+	}
+
+	identity, err := auth.Authenticate(r)
+	if err != nil {
+		log.Warnf("failed process authentication for state id %s: %v", state.ID, err)
+		// the reason may reveal the configured auth backends or their users, so it's only logged
+		HTTPResponse(w, r, http.StatusForbidden, "Permission denied")
+
+		return nil, nil, false
+	}
+
+	if ok, err := identity.Authorize(state, op); err != nil {
+		log.Warnf("failed process authentication for state id %s: %v", state.ID, err)
+		HTTPResponse(w, r, http.StatusForbidden, "Permission denied")
+
+		return nil, identity, false
+	} else if !ok {
+		log.Warnf("failed to authenticate request to %s state id %s", op, state.ID)
+		HTTPResponse(w, r, http.StatusForbidden, "Permission denied")
+
+		return nil, identity, false
+	}
+
+	if decision := policy.Authorize(identity, state, op); !decision.Allowed {
+		log.Warnf("policy denied request to %s state id %s: %s", op, state.ID, decision)
+		HTTPResponse(w, r, http.StatusForbidden, "Permission denied")
+
+		return nil, identity, false
+	}
+
+	return state, identity, true
+}
+
 func Lock(w http.ResponseWriter, r *http.Request, state *terraform.State, body []byte, locker lock.Locker) {
 	log.Debugf("try to lock state with id %s", state.ID)
 
@@ -162,7 +211,7 @@ func Get(w http.ResponseWriter, r *http.Request, state *terraform.State, store s
 	}
 
 	if kms != nil && len(state.Data) > 0 {
-		state.Data, err = kms.Decrypt(state.Data)
+		state.Data, err = kms.Decrypt(state.Data, []byte(state.ID))
 		if err != nil {
 			log.Errorf("failed to decrypt state with id %s: %v", state.ID, err)
 			HTTPResponse(w, r, http.StatusInternalServerError, "")
@@ -189,9 +238,17 @@ func Post(w http.ResponseWriter, r *http.Request, state *terraform.State, body [
 		return
 	}
 
+	if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); force {
+		log.Warnf("skipping serial and lineage check for state with id %s", state.ID)
+	} else if code, err := verifyStateUpdate(state, body, store, kms); err != nil {
+		log.Warnf("rejecting state with id %s: %v", state.ID, err)
+		HTTPResponse(w, r, code, err.Error())
+		return
+	}
+
 	log.Debugf("save state with id %s", state.ID)
 
-	data, err := kms.Encrypt(body)
+	data, err := kms.Encrypt(body, []byte(state.ID))
 	if err != nil {
 		log.Errorf("failed to encrypt state with id %s: %v", state.ID, err)
 		HTTPResponse(w, r, http.StatusInternalServerError, "")
@@ -199,6 +256,12 @@ func Post(w http.ResponseWriter, r *http.Request, state *terraform.State, body [
 	}
 
 	state.Data = data
+	state.Metadata.LastWriter = lock.Who
+
+	// a forced write may not be a valid state file, then serial and lineage stay empty
+	if f, err := terraform.ParseStateFile(body); err == nil {
+		state.Metadata.Serial, state.Metadata.Lineage = f.Serial, f.Lineage
+	}
 
 	err = store.SaveState(state)
 	if err != nil {
@@ -210,6 +273,57 @@ func Post(w http.ResponseWriter, r *http.Request, state *terraform.State, body [
 	HTTPResponse(w, r, http.StatusOK, "")
 }
 
+// verifyStateUpdate checks the lineage and serial of the new state against the stored state.
+// If the update is rejected, the error is returned together with the HTTP response code.
+func verifyStateUpdate(state *terraform.State, body []byte, store storage.Storage, kms kms.KMS) (int, error) {
+	if _, err := terraform.ParseStateFile(body); err != nil {
+		return http.StatusBadRequest, err
+	}
+
+	current, err := getStoredStateData(state.ID, store, kms)
+	if err != nil {
+		return http.StatusInternalServerError, err
+	}
+
+	return checkStateUpdate(state.ID, current, body)
+}
+
+// getStoredStateData returns the decrypted data of the stored state, which is empty if the state doesn't exist.
+func getStoredStateData(id string, store storage.Storage, kms kms.KMS) ([]byte, error) {
+	current, err := store.GetState(id)
+	if errors.Is(err, storage.ErrStateNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get stored state: %w", err)
+	}
+
+	data := current.Data
+	if kms != nil && len(data) > 0 {
+		if data, err = kms.Decrypt(data, []byte(id)); err != nil {
+			return nil, fmt.Errorf("failed to decrypt stored state: %w", err)
+		}
+	}
+
+	return data, nil
+}
+
+// checkStateUpdate compares the new state with the decrypted data of the stored state.
+func checkStateUpdate(id string, current, next []byte) (int, error) {
+	if len(current) == 0 {
+		return http.StatusOK, nil
+	}
+
+	err := terraform.CheckStateUpdate(current, next)
+	if errors.Is(err, terraform.ErrLineageMismatch) || errors.Is(err, terraform.ErrSerialDecreased) || errors.Is(err, terraform.ErrSerialConflict) {
+		return http.StatusConflict, err
+	} else if err != nil {
+		// a stored state which can't be parsed shouldn't block overwriting it
+		log.Warnf("failed to compare state with id %s with the stored state: %v", id, err)
+	}
+
+	return http.StatusOK, nil
+}
+
 func Delete(w http.ResponseWriter, r *http.Request, state *terraform.State, store storage.Storage) {
 	log.Debugf("delete state with id %s", state.ID)
 
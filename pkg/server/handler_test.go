@@ -4,12 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"flag"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gruntwork-io/terratest/modules/terraform"
@@ -36,7 +38,7 @@ func NewStateHandler(t *testing.T, baseDir string, forceUnlockEnabled bool) http
 		t.Fatal(err)
 	}
 
-	var locker lock.Locker = locallock.NewLock()
+	var locker lock.Locker = locallock.NewLock(time.Hour)
 	if forceUnlockEnabled {
 		locker = lock.NewLockerWithForceUnlockEnabled(locker)
 	}
@@ -167,6 +169,57 @@ func TestServerHandler_ForceUnlock_Disabled(t *testing.T) {
 	simulateLock(t, address, false)
 }
 
+func TestServerHandler_RejectedCredentials(t *testing.T) {
+	s := newTestServer(t)
+
+	// the reason isn't returned, since it reveals the configured auth backends
+	for _, url := range []string{s.URL + "/state/project1/example", s.URL + "/states"} {
+		code, body := doRequestWithAuth(t, http.MethodGet, url, nil, "unknown", "secret")
+		require.Equal(t, http.StatusForbidden, code)
+		require.Equal(t, "Permission denied", string(body))
+	}
+}
+
+func TestServerHandler_StateConflict(t *testing.T) {
+	s := newTestServer(t)
+	address := s.URL + "/state/project1/example"
+	lockedAddress := address + "?ID=cf290ef3-6090-410e-9784-d017a4b1536a"
+
+	lockInfo, err := json.Marshal(&tf.LockInfo{ID: "cf290ef3-6090-410e-9784-d017a4b1536a"})
+	require.NoError(t, err)
+
+	code, _ := doRequest(t, "LOCK", address, lockInfo)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodPost, lockedAddress, []byte(`{"version": 4, "serial": 2, "lineage": "a1b2", "outputs": {}}`))
+	require.Equal(t, http.StatusOK, code)
+
+	// the cases depend on the stored state, so they have to run in order
+	for _, tc := range []struct {
+		name  string
+		state string
+		code  int
+	}{
+		{"invalid json", `not a state`, http.StatusBadRequest},
+		{"lower serial", `{"version": 4, "serial": 1, "lineage": "a1b2", "outputs": {}}`, http.StatusConflict},
+		{"other lineage", `{"version": 4, "serial": 3, "lineage": "c3d4", "outputs": {}}`, http.StatusConflict},
+		{"same serial diff", `{"version": 4, "serial": 2, "lineage": "a1b2", "outputs": {"a": {}}}`, http.StatusConflict},
+		{"same serial", `{"version": 4, "serial": 2, "lineage": "a1b2", "outputs": {}}`, http.StatusOK},
+		{"higher serial", `{"version": 4, "serial": 3, "lineage": "a1b2", "outputs": {}}`, http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code, _ := doRequest(t, http.MethodPost, lockedAddress, []byte(tc.state))
+			require.Equal(t, tc.code, code)
+		})
+	}
+
+	code, _ = doRequest(t, http.MethodPost, lockedAddress+"&force=true", []byte(`{"version": 4, "serial": 1, "lineage": "e5f6"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, "UNLOCK", address, lockInfo)
+	require.Equal(t, http.StatusOK, code)
+}
+
 func simulateLock(t *testing.T, address string, doLock bool) {
 	method := "LOCK"
 	if !doLock {
@@ -194,3 +247,58 @@ func simulateLock(t *testing.T, address string, doLock bool) {
 	require.NoError(t, err)
 	require.NoError(t, resp.Body.Close())
 }
+
+const testAdminToken = "admin-secret"
+
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	store, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	kms, err := localkms.NewKMS("x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY=")
+	require.NoError(t, err)
+
+	locker := locallock.NewLock(time.Hour)
+
+	r := mux.NewRouter().StrictSlash(true)
+	r.HandleFunc("/states", ListHandler(store, locker))
+	r.HandleFunc("/state/{project}", ListHandler(store, locker))
+	r.HandleFunc("/state/{project}/{name}", StateHandler(store, locker, kms))
+	r.HandleFunc("/state/{project}/{name}/versions", VersionHandler(store, kms))
+	r.HandleFunc("/state/{project}/{name}/versions/{version}", VersionHandler(store, kms))
+	r.HandleFunc("/state/{project}/{name}/versions/{version}/restore", RestoreHandler(store, locker, kms))
+	r.HandleFunc("/admin/locks", AdminLocksHandler(store, locker, testAdminToken))
+	r.HandleFunc("/admin/locks/{id}", AdminLocksHandler(store, locker, testAdminToken))
+	r.HandleFunc("/admin/kms/rotate", AdminRotateHandler(store, locker, kms, testAdminToken))
+
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func doRequest(t *testing.T, method, url string, body []byte) (int, []byte) {
+	t.Helper()
+
+	return doRequestWithAuth(t, method, url, body, "basic", "some-random-secret")
+}
+
+func doRequestWithAuth(t *testing.T, method, url string, body []byte, username, password string) (int, []byte) {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	require.NoError(t, err)
+
+	req.SetBasicAuth(username, password)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	return resp.StatusCode, respBody
+}
@@ -0,0 +1,114 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/audit"
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/lock"
+	"github.com/nimbolus/terraform-backend/pkg/policy"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// listOperation is the operation of the list endpoint in the audit log
+const listOperation = "list"
+
+// StateListEntry is returned by the list endpoint for every state the caller has access to.
+type StateListEntry struct {
+	storage.StateInfo
+	Lock *terraform.LockInfo `json:"lock,omitempty"`
+}
+
+// ListHandler lists all states (or all states of the project in the path), which can be accessed with the
+// credentials of the request. States stored without project and name can't be authenticated and are never listed.
+// Serial and lineage are taken from the metadata of the states, so the states aren't read and decrypted.
+func ListHandler(store storage.Storage, locker lock.Locker) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		w = rec
+
+		var identity *auth.Identity
+		defer func() {
+			auditRequest(r, rec.code, identity, identity != nil, audit.Event{Operation: listOperation})
+		}()
+
+		log.Infof("%s %s", r.Method, r.URL.Path)
+
+		if r.Method != http.MethodGet {
+			HTTPResponse(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		lister, ok := store.(storage.Lister)
+		if !ok {
+			HTTPResponse(w, r, http.StatusNotImplemented, "Storage backend does not support listing")
+			return
+		}
+
+		// the credentials are verified once, the identity authorizes every listed state
+		var err error
+		if identity, err = auth.Authenticate(r); err != nil {
+			log.Warnf("failed process authentication for state list: %v", err)
+			HTTPResponse(w, r, http.StatusForbidden, "Permission denied")
+			return
+		}
+
+		infos, err := lister.ListStates()
+		if errors.Is(err, storage.ErrUnsupported) {
+			HTTPResponse(w, r, http.StatusNotImplemented, "Storage backend does not support listing")
+			return
+		} else if err != nil {
+			log.Errorf("failed to list states: %v", err)
+			HTTPResponse(w, r, http.StatusInternalServerError, "")
+			return
+		}
+
+		project, filterProject := mux.Vars(r)["project"]
+		entries := []StateListEntry{}
+
+		for _, info := range infos {
+			if info.Project == "" || info.Name == "" || (filterProject && info.Project != project) {
+				continue
+			}
+
+			state := &terraform.State{
+				ID:      terraform.GetStateID(info.Project, info.Name),
+				Project: info.Project,
+				Name:    info.Name,
+			}
+
+			// the authenticator may derive the state id from the credentials (e.g. basic auth), so the
+			// credentials only grant access if they resolve to the id of the listed state
+			if ok, err := identity.Authorize(state, auth.Read); err != nil || !ok || state.ID != info.ID {
+				continue
+			}
+
+			if !policy.Authorize(identity, state, auth.Read).Allowed {
+				continue
+			}
+
+			entry := StateListEntry{StateInfo: info}
+			if lockInfo, err := locker.GetLock(state); err == nil {
+				entry.Lock = &lockInfo
+			}
+
+			entries = append(entries, entry)
+		}
+
+		body, err := json.Marshal(entries)
+		if err != nil {
+			log.Errorf("failed to marshal state list: %v", err)
+			HTTPResponse(w, r, http.StatusInternalServerError, "")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		HTTPResponse(w, r, http.StatusOK, string(body))
+	}
+}
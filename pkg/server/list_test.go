@@ -0,0 +1,55 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	tf "github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestListHandler(t *testing.T) {
+	s := newTestServer(t)
+
+	lockInfo, err := json.Marshal(&tf.LockInfo{ID: "cf290ef3-6090-410e-9784-d017a4b1536a", Who: "tester"})
+	require.NoError(t, err)
+
+	for _, path := range []string{"/state/project1/example", "/state/project2/example"} {
+		code, _ := doRequest(t, "LOCK", s.URL+path, lockInfo)
+		require.Equal(t, http.StatusOK, code)
+
+		code, _ = doRequest(t, http.MethodPost, s.URL+path+"?ID=cf290ef3-6090-410e-9784-d017a4b1536a", []byte(`{"version": 4, "serial": 3, "lineage": "a1b2"}`))
+		require.Equal(t, http.StatusOK, code)
+	}
+
+	code, _ := doRequest(t, "UNLOCK", s.URL+"/state/project2/example", lockInfo)
+	require.Equal(t, http.StatusOK, code)
+
+	var entries []StateListEntry
+
+	code, body := doRequest(t, http.MethodGet, s.URL+"/states", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal(body, &entries))
+	require.Len(t, entries, 2)
+
+	code, body = doRequest(t, http.MethodGet, s.URL+"/state/project1", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal(body, &entries))
+	require.Len(t, entries, 1)
+	require.Equal(t, "project1", entries[0].Project)
+	require.Equal(t, "example", entries[0].Name)
+	require.Equal(t, uint64(3), entries[0].Serial)
+	require.Equal(t, "a1b2", entries[0].Lineage)
+	require.Equal(t, "basic", entries[0].AuthMethod)
+	require.Equal(t, "tester", entries[0].LastWriter)
+	require.NotNil(t, entries[0].Lock)
+	require.Equal(t, "tester", entries[0].Lock.Who)
+
+	// states are only listed for matching credentials
+	code, body = doRequestWithAuth(t, http.MethodGet, s.URL+"/states", nil, "basic", "other-secret")
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal(body, &entries))
+	require.Empty(t, entries)
+}
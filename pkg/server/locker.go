@@ -1,51 +1,45 @@
 package server
 
 import (
-	"fmt"
+	"time"
 
-	"github.com/spf13/viper"
+	log "github.com/sirupsen/logrus"
 
-	pgclient "github.com/nimbolus/terraform-backend/pkg/client/postgres"
-	redisclient "github.com/nimbolus/terraform-backend/pkg/client/redis"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 	"github.com/nimbolus/terraform-backend/pkg/lock"
-	"github.com/nimbolus/terraform-backend/pkg/lock/local"
-	"github.com/nimbolus/terraform-backend/pkg/lock/postgres"
-	"github.com/nimbolus/terraform-backend/pkg/lock/redis"
 )
 
-func GetLocker() (lock.Locker, error) {
-	viper.SetDefault("lock_backend", local.Name)
-	backend := viper.GetString("lock_backend")
-
-	var locker lock.Locker
-
-	switch backend {
-	case local.Name:
-		locker = local.NewLock()
-	case redis.Name:
-		locker = redis.NewLock(redisclient.NewPool())
-	case postgres.Name:
-		db, err := pgclient.NewClient()
-		if err != nil {
-			return nil, fmt.Errorf("creating postgres client: %w", err)
-		}
-
-		viper.SetDefault("lock_postgres_table", "locks")
-		l, err := postgres.NewLock(db, viper.GetString("lock_postgres_table"))
-		if err != nil {
-			return nil, fmt.Errorf("failed to initialize lock backend %s: %v", backend, err)
-		}
-
-		locker = l
-	default:
-		return nil, fmt.Errorf("backend is not implemented")
+// GetLocker returns the configured lock backend.
+func GetLocker(cfg *config.Config) (lock.Locker, error) {
+	locker, err := lock.New(cfg.Lock, cfg.Clients())
+	if err != nil {
+		return nil, err
 	}
 
-	viper.SetDefault("force_unlock_enabled", true)
-
-	if viper.GetBool("force_unlock_enabled") {
+	if cfg.ForceUnlockEnabled {
 		locker = lock.NewLockerWithForceUnlockEnabled(locker)
 	}
 
 	return locker, nil
 }
+
+// ReapExpiredLocks periodically removes expired locks, if the lock backend doesn't expire them on its own.
+func ReapExpiredLocks(locker lock.Locker, interval time.Duration) {
+	reaper, ok := lock.Unwrap(locker).(lock.Reaper)
+	if !ok {
+		return
+	}
+
+	go func() {
+		for {
+			time.Sleep(interval)
+
+			count, err := reaper.ReapExpiredLocks()
+			if err != nil {
+				log.WithError(err).WithField("component", "reaper").Error("reaping expired locks")
+			} else if count > 0 {
+				log.WithField("component", "reaper").Infof("reaped %d expired locks", count)
+			}
+		}
+	}()
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/policy"
+)
+
+func TestPolicy(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "policy.yaml")
+	require.NoError(t, os.WriteFile(file, []byte(`
+rules:
+  - backends: [basic]
+    states: ["project1/*"]
+    operations: [read, lock, write]
+`), 0600))
+
+	p, err := policy.Load(file)
+	require.NoError(t, err)
+
+	policy.Configure(p)
+	t.Cleanup(func() { policy.Configure(nil) })
+
+	s := newTestServer(t)
+	address := s.URL + "/state/project1/example"
+
+	code, _ := doRequest(t, "LOCK", address, []byte(`{"ID": "cf290ef3-6090-410e-9784-d017a4b1536a"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"?ID=cf290ef3-6090-410e-9784-d017a4b1536a",
+		[]byte(`{"version": 4, "serial": 1, "lineage": "a1b2"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodDelete, address, nil)
+	require.Equal(t, http.StatusForbidden, code)
+
+	code, _ = doRequest(t, http.MethodGet, s.URL+"/state/project2/example", nil)
+	require.Equal(t, http.StatusForbidden, code)
+}
@@ -0,0 +1,207 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/audit"
+	"github.com/nimbolus/terraform-backend/pkg/kms"
+	"github.com/nimbolus/terraform-backend/pkg/lock"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+var errStateLocked = errors.New("state is locked")
+
+// RotateResult summarizes the re-encryption of all stored states.
+type RotateResult struct {
+	Rotated   int      `json:"rotated"`
+	Unchanged int      `json:"unchanged"`
+	Locked    []string `json:"locked"`
+	Failed    []string `json:"failed"`
+}
+
+// RotateStates re-encrypts all stored states (including their versions) with the active key of the KMS. Every state
+// is locked while it's re-encrypted, states which are locked by someone else are skipped and have to be rotated again
+// later. The states and versions are overwritten in place, so the rotation doesn't create new versions.
+func RotateStates(store storage.Storage, locker lock.Locker, k kms.KMS) (*RotateResult, error) {
+	lister, ok := store.(storage.Lister)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s does not support listing", store.GetName())
+	}
+
+	importer, ok := store.(storage.Importer)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s does not support importing states", store.GetName())
+	}
+
+	versioned, _ := store.(storage.Versioned)
+	writer, _ := store.(storage.VersionWriter)
+
+	if versioned != nil && writer == nil {
+		return nil, fmt.Errorf("storage backend %s does not support writing versions", store.GetName())
+	}
+
+	infos, err := lister.ListStates()
+	if err != nil {
+		return nil, fmt.Errorf("listing states: %w", err)
+	}
+
+	result := &RotateResult{
+		Locked: []string{},
+		Failed: []string{},
+	}
+
+	for _, info := range infos {
+		rotated, err := rotateState(info.ID, store, importer, versioned, writer, locker, k)
+		switch {
+		case errors.Is(err, errStateLocked):
+			log.Warnf("skipping rotation of locked state with id %s", info.ID)
+			result.Locked = append(result.Locked, info.ID)
+		case err != nil:
+			log.Errorf("failed to rotate state with id %s: %v", info.ID, err)
+			result.Failed = append(result.Failed, info.ID)
+		case rotated:
+			result.Rotated++
+		default:
+			result.Unchanged++
+		}
+	}
+
+	return result, nil
+}
+
+func rotateState(id string, store storage.Storage, importer storage.Importer, versioned storage.Versioned,
+	writer storage.VersionWriter, locker lock.Locker, k kms.KMS) (bool, error) {
+	rotateLock := terraform.LockInfo{
+		ID:        uuid.New().String(),
+		Operation: "Rotate",
+		Who:       "terraform-backend",
+		Created:   time.Now().UTC().Format(time.RFC3339),
+		Info:      "re-encrypt state with active key",
+	}
+
+	state := &terraform.State{ID: id, Lock: rotateLock}
+
+	if ok, err := locker.Lock(state); err != nil {
+		return false, fmt.Errorf("locking state: %w", err)
+	} else if !ok {
+		return false, errStateLocked
+	}
+
+	defer func() {
+		state.Lock = rotateLock
+		if _, err := locker.Unlock(state); err != nil {
+			log.Errorf("failed to unlock state with id %s after rotation: %v", id, err)
+		}
+	}()
+
+	stored, err := store.GetState(id)
+	if err != nil {
+		return false, fmt.Errorf("getting state: %w", err)
+	}
+
+	rotated := false
+
+	// the current state is written last, so a state is rotated again, if the rotation of its versions was interrupted
+	if versioned != nil {
+		// a wrapping backend (e.g. the mirror) may not support versioning, then only the current state is rotated
+		versions, err := versioned.ListStateVersions(id)
+		if err != nil && !errors.Is(err, storage.ErrUnsupported) {
+			return false, fmt.Errorf("listing versions: %w", err)
+		}
+
+		for _, v := range versions {
+			stateVersion, err := versioned.GetStateVersion(id, v.Version)
+			if err != nil {
+				return false, fmt.Errorf("getting version %d: %w", v.Version, err)
+			}
+
+			if len(stateVersion.Data) == 0 {
+				continue
+			}
+
+			data, ok, err := kms.Rewrap(k, stateVersion.Data, []byte(id))
+			if err != nil {
+				return false, fmt.Errorf("re-encrypting version %d: %w", v.Version, err)
+			} else if !ok {
+				continue
+			}
+
+			if err := writer.PutStateVersion(id, v, data); err != nil {
+				return false, fmt.Errorf("writing version %d: %w", v.Version, err)
+			}
+
+			rotated = true
+		}
+	}
+
+	if len(stored.Data) == 0 {
+		return rotated, nil
+	}
+
+	data, ok, err := kms.Rewrap(k, stored.Data, []byte(id))
+	if err != nil {
+		return false, fmt.Errorf("re-encrypting state: %w", err)
+	} else if !ok {
+		return rotated, nil
+	}
+
+	// the metadata is kept, since the content of the state doesn't change
+	stored.Data = data
+
+	if err := importer.ImportState(stored); err != nil {
+		return false, fmt.Errorf("writing state: %w", err)
+	}
+
+	return true, nil
+}
+
+// AdminRotateHandler re-encrypts all stored states with the active key of the KMS.
+func AdminRotateHandler(store storage.Storage, locker lock.Locker, k kms.KMS, token string) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Infof("%s %s", r.Method, r.URL.Path)
+
+		admin, ok := authenticateAdmin(w, r, token)
+		if !ok {
+			return
+		}
+
+		if r.Method != http.MethodPost {
+			HTTPResponse(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		w = rec
+		defer func() { auditAdmin(r, admin, rec.code, audit.Event{Operation: rotateOperation}) }()
+
+		log.Infof("state rotation started by admin %s", admin)
+
+		result, err := RotateStates(store, locker, k)
+		if errors.Is(err, storage.ErrUnsupported) {
+			HTTPResponse(w, r, http.StatusNotImplemented, err.Error())
+			return
+		} else if err != nil {
+			log.Errorf("failed to rotate states: %v", err)
+			HTTPResponse(w, r, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		body, err := json.Marshal(result)
+		if err != nil {
+			log.Errorf("failed to marshal rotation result: %v", err)
+			HTTPResponse(w, r, http.StatusInternalServerError, "")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		HTTPResponse(w, r, http.StatusOK, string(body))
+	}
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	localkms "github.com/nimbolus/terraform-backend/pkg/kms/local"
+	locallock "github.com/nimbolus/terraform-backend/pkg/lock/local"
+	"github.com/nimbolus/terraform-backend/pkg/storage/filesystem"
+	tf "github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestRotateStates(t *testing.T) {
+	oldKey := "x8DiIkAKRQT7cF55NQLkAZk637W3bGVOUjGeMX5ZGXY="
+	newKey := "jwS6UpASMOWpEmFn7C6I47BlmPt4cpdmYLKd2E7a4Zk="
+
+	store, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	locker := locallock.NewLock(time.Hour)
+
+	oldKMS, err := localkms.NewKMS(oldKey)
+	require.NoError(t, err)
+
+	plain := []byte(`{"version": 4, "serial": 1, "lineage": "a1b2"}`)
+
+	for _, name := range []string{"rotated", "locked"} {
+		data, err := oldKMS.Encrypt(plain, []byte(tf.GetStateID("project1", name)))
+		require.NoError(t, err)
+
+		require.NoError(t, store.SaveState(&tf.State{
+			ID:      tf.GetStateID("project1", name),
+			Project: "project1",
+			Name:    name,
+			Data:    data,
+			Metadata: tf.Metadata{
+				LastWriter: "user@host",
+			},
+		}))
+	}
+
+	locked := &tf.State{ID: tf.GetStateID("project1", "locked"), Lock: tf.LockInfo{ID: "cf290ef3-6090-410e-9784-d017a4b1536a"}}
+	ok, err := locker.Lock(locked)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	k, err := localkms.NewKMS(newKey, oldKey)
+	require.NoError(t, err)
+
+	result, err := RotateStates(store, locker, k)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Rotated)
+	require.Equal(t, []string{locked.ID}, result.Locked)
+	require.Empty(t, result.Failed)
+
+	newKMS, err := localkms.NewKMS(newKey)
+	require.NoError(t, err)
+
+	stored, err := store.GetState(tf.GetStateID("project1", "rotated"))
+	require.NoError(t, err)
+	require.Equal(t, "user@host", stored.Metadata.LastWriter)
+
+	decrypted, err := newKMS.Decrypt(stored.Data, []byte(stored.ID))
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
+
+	// the versions are re-encrypted in place
+	versions, err := store.ListStateVersions(stored.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+
+	version, err := store.GetStateVersion(stored.ID, versions[0].Version)
+	require.NoError(t, err)
+
+	decrypted, err = newKMS.Decrypt(version.Data, []byte(stored.ID))
+	require.NoError(t, err)
+	require.Equal(t, plain, decrypted)
+
+	// the rotation lock is released again
+	_, err = locker.GetLock(stored)
+	require.Error(t, err)
+
+	ok, err = locker.Unlock(locked)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	result, err = RotateStates(store, locker, k)
+	require.NoError(t, err)
+	require.Equal(t, 1, result.Rotated)
+	require.Equal(t, 1, result.Unchanged)
+}
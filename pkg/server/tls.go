@@ -0,0 +1,39 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// TLSConfig returns the TLS configuration of the server. If a client CA bundle is configured, client certificates are
+// verified with it and are either optional or required by the client auth mode. Otherwise it returns nil.
+func TLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.TLSClientCA == "" {
+		return nil, nil
+	}
+
+	bundle, err := os.ReadFile(cfg.TLSClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("reading client CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("client CA bundle %s contains no PEM encoded certificates", cfg.TLSClientCA)
+	}
+
+	clientAuth := tls.VerifyClientCertIfGiven
+	if cfg.TLSClientAuth == "required" {
+		clientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientCAs:  pool,
+		ClientAuth: clientAuth,
+	}, nil
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/auth/mtls/mtlstest"
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+func TestMTLS(t *testing.T) {
+	ca := mtlstest.NewCA(t)
+
+	cfg := config.Default()
+	cfg.TLSClientCA = ca.WriteCA(t)
+	cfg.Auth.MTLS = config.MTLSAuthConfig{
+		Enabled: true,
+		Match:   "glob",
+		Rules: []config.MTLSRuleConfig{{
+			URI:     "spiffe://cluster.local/ns/infra/sa/*",
+			Project: "infra",
+			State:   "*",
+		}},
+	}
+
+	require.NoError(t, auth.Configure(cfg.Auth, config.ClientsConfig{}))
+	t.Cleanup(func() {
+		require.NoError(t, auth.Configure(config.Default().Auth, config.ClientsConfig{}))
+	})
+
+	tlsConfig, err := TLSConfig(cfg)
+	require.NoError(t, err)
+	tlsConfig.Certificates = []tls.Certificate{ca.IssueServer(t)}
+
+	s := httptest.NewUnstartedServer(newTestServer(t).Config.Handler)
+	s.TLS = tlsConfig
+	s.StartTLS()
+	t.Cleanup(s.Close)
+
+	spiffeID, err := url.Parse("spiffe://cluster.local/ns/infra/sa/terraform")
+	require.NoError(t, err)
+
+	client := func(certs ...tls.Certificate) *http.Client {
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			RootCAs:      ca.Pool(),
+			Certificates: certs,
+		}}}
+	}
+
+	get := func(c *http.Client, path string, basicAuth bool) int {
+		req, err := http.NewRequest(http.MethodGet, s.URL+path, nil)
+		require.NoError(t, err)
+
+		if basicAuth {
+			req.SetBasicAuth("basic", "some-random-secret")
+		}
+
+		resp, err := c.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		return resp.StatusCode
+	}
+
+	workload := client(ca.Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "terraform"}, URIs: []*url.URL{spiffeID}}))
+
+	// the state doesn't exist, but access is granted
+	require.Equal(t, http.StatusNotFound, get(workload, "/state/infra/network", false))
+	require.Equal(t, http.StatusForbidden, get(workload, "/state/apps/network", false))
+
+	// certificates of other CAs aren't verified
+	untrusted := client(mtlstest.NewCA(t).Issue(t, &x509.Certificate{Subject: pkix.Name{CommonName: "terraform"}, URIs: []*url.URL{spiffeID}}))
+	_, err = untrusted.Get(s.URL + "/state/infra/network")
+	require.Error(t, err)
+
+	// client certificates are optional, other auth backends can still be used
+	require.Equal(t, http.StatusForbidden, get(client(), "/state/infra/network", false))
+	require.Equal(t, http.StatusNotFound, get(client(), "/state/infra/network", true))
+}
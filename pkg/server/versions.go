@@ -0,0 +1,307 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/audit"
+	"github.com/nimbolus/terraform-backend/pkg/auth"
+	"github.com/nimbolus/terraform-backend/pkg/kms"
+	"github.com/nimbolus/terraform-backend/pkg/lock"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+// operations of the version endpoints in the audit log
+const (
+	listVersionsOperation = "list-versions"
+	readVersionOperation  = "read-version"
+	restoreOperation      = "restore"
+)
+
+// VersionHandler serves the version history of a state. Without a version in the path all versions are listed,
+// otherwise the decrypted data of the requested version is returned.
+func VersionHandler(store storage.Storage, kms kms.KMS) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		w = rec
+
+		var identity *auth.Identity
+		var authenticated bool
+		operation := readVersionOperation
+		if _, ok := mux.Vars(r)["version"]; !ok {
+			operation = listVersionsOperation
+		}
+		defer func() {
+			auditRequest(r, rec.code, identity, authenticated, audit.Event{Operation: operation})
+		}()
+
+		log.Infof("%s %s", r.Method, r.URL.Path)
+
+		if r.Method != http.MethodGet {
+			HTTPResponse(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		versioned, ok := store.(storage.Versioned)
+		if !ok {
+			HTTPResponse(w, r, http.StatusNotImplemented, "Storage backend does not support versioning")
+			return
+		}
+
+		state, id, ok := authenticateState(w, r, auth.Read)
+		if identity, authenticated = id, ok; !ok {
+			return
+		}
+
+		if operation == listVersionsOperation {
+			ListVersions(w, r, state, versioned)
+			return
+		}
+
+		version, ok := parseVersion(w, r)
+		if !ok {
+			return
+		}
+
+		GetVersion(w, r, state, version, versioned, kms)
+	}
+}
+
+// RestoreHandler promotes an old version of a state back to the current state.
+func RestoreHandler(store storage.Storage, locker lock.Locker, kms kms.KMS) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+		w = rec
+
+		var identity *auth.Identity
+		var authenticated bool
+		var state *terraform.State
+		defer func() {
+			e := audit.Event{Operation: restoreOperation, LockID: r.URL.Query().Get("ID")}
+			if state != nil && rec.code == http.StatusOK {
+				// the serial of the restored state, which may have been increased past the current one
+				e.Serial = &state.Metadata.Serial
+			}
+
+			auditRequest(r, rec.code, identity, authenticated, e)
+		}()
+
+		log.Infof("%s %s", r.Method, r.URL.Path)
+
+		if r.Method != http.MethodPost {
+			HTTPResponse(w, r, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+
+		versioned, ok := store.(storage.Versioned)
+		if !ok {
+			HTTPResponse(w, r, http.StatusNotImplemented, "Storage backend does not support versioning")
+			return
+		}
+
+		state, identity, authenticated = authenticateState(w, r, auth.Write)
+		if !authenticated {
+			return
+		}
+
+		version, ok := parseVersion(w, r)
+		if !ok {
+			return
+		}
+
+		RestoreVersion(w, r, state, version, locker, store, versioned, kms)
+	}
+}
+
+func ListVersions(w http.ResponseWriter, r *http.Request, state *terraform.State, versioned storage.Versioned) {
+	log.Debugf("list versions of state with id %s", state.ID)
+
+	versions, err := versioned.ListStateVersions(state.ID)
+	if errors.Is(err, storage.ErrUnsupported) {
+		HTTPResponse(w, r, http.StatusNotImplemented, "Storage backend does not support versioning")
+		return
+	} else if err != nil {
+		log.Errorf("failed to list versions of state with id %s: %v", state.ID, err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	body, err := json.Marshal(versions)
+	if err != nil {
+		log.Errorf("failed to marshal versions: %v", err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	HTTPResponse(w, r, http.StatusOK, string(body))
+}
+
+func GetVersion(w http.ResponseWriter, r *http.Request, state *terraform.State, version int, versioned storage.Versioned, kms kms.KMS) {
+	log.Debugf("get version %d of state with id %s", version, state.ID)
+
+	stateVersion, err := versioned.GetStateVersion(state.ID, version)
+	if errors.Is(err, storage.ErrVersionNotFound) {
+		HTTPResponse(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if errors.Is(err, storage.ErrUnsupported) {
+		HTTPResponse(w, r, http.StatusNotImplemented, "Storage backend does not support versioning")
+		return
+	} else if err != nil {
+		log.Errorf("failed to get version %d of state with id %s: %v", version, state.ID, err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	data := stateVersion.Data
+	if kms != nil && len(data) > 0 {
+		data, err = kms.Decrypt(data, []byte(state.ID))
+		if err != nil {
+			log.Errorf("failed to decrypt version %d of state with id %s: %v", version, state.ID, err)
+			HTTPResponse(w, r, http.StatusInternalServerError, "")
+			return
+		}
+	}
+
+	HTTPResponse(w, r, http.StatusOK, string(data))
+}
+
+// RestoreVersion saves the given version as a new version of the state. If the request carries a lock ID,
+// it must match the current lock, otherwise the state is locked for the duration of the restore. The serial of the
+// restored state is increased past the serial of the current state, so that Terraform accepts it as the latest state.
+func RestoreVersion(w http.ResponseWriter, r *http.Request, state *terraform.State, version int, locker lock.Locker, store storage.Storage, versioned storage.Versioned, kms kms.KMS) {
+	log.Debugf("restore version %d of state with id %s", version, state.ID)
+
+	if reqLockID := r.URL.Query().Get("ID"); reqLockID != "" {
+		lock, err := locker.GetLock(state)
+		if err != nil || lock.ID != reqLockID {
+			log.Warnf("attempting to restore state with wrong lock %s", reqLockID)
+			HTTPResponse(w, r, http.StatusBadRequest, "")
+			return
+		}
+
+		state.Metadata.LastWriter = lock.Who
+	} else {
+		restoreLock := terraform.LockInfo{
+			ID:        uuid.New().String(),
+			Operation: "Restore",
+			Who:       "terraform-backend",
+			Created:   time.Now().UTC().Format(time.RFC3339),
+			Info:      "restore version " + strconv.Itoa(version),
+		}
+		state.Lock = restoreLock
+		state.Metadata.LastWriter = restoreLock.Who
+
+		if ok, err := locker.Lock(state); err != nil {
+			log.Errorf("failed to lock state with id %s: %v", state.ID, err)
+			HTTPResponse(w, r, http.StatusInternalServerError, "")
+			return
+		} else if !ok {
+			lockInfo, err := json.Marshal(state.Lock)
+			if err != nil {
+				log.Errorf("failed to marshal lock info: %v", err)
+				HTTPResponse(w, r, http.StatusInternalServerError, "")
+				return
+			}
+
+			HTTPResponse(w, r, http.StatusLocked, string(lockInfo))
+			return
+		}
+
+		defer func() {
+			state.Lock = restoreLock
+			if _, err := locker.Unlock(state); err != nil {
+				log.Errorf("failed to unlock state with id %s after restore: %v", state.ID, err)
+			}
+		}()
+	}
+
+	stateVersion, err := versioned.GetStateVersion(state.ID, version)
+	if errors.Is(err, storage.ErrVersionNotFound) {
+		HTTPResponse(w, r, http.StatusNotFound, err.Error())
+		return
+	} else if errors.Is(err, storage.ErrUnsupported) {
+		HTTPResponse(w, r, http.StatusNotImplemented, "Storage backend does not support versioning")
+		return
+	} else if err != nil {
+		log.Errorf("failed to get version %d of state with id %s: %v", version, state.ID, err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	data := stateVersion.Data
+	if kms != nil && len(data) > 0 {
+		if data, err = kms.Decrypt(data, []byte(state.ID)); err != nil {
+			log.Errorf("failed to decrypt version %d of state with id %s: %v", version, state.ID, err)
+			HTTPResponse(w, r, http.StatusInternalServerError, "")
+			return
+		}
+	}
+
+	restored, err := terraform.ParseStateFile(data)
+	if err != nil {
+		log.Warnf("failed to parse version %d of state with id %s: %v", version, state.ID, err)
+		HTTPResponse(w, r, http.StatusBadRequest, "Version is not a valid state")
+		return
+	}
+
+	current, err := getStoredStateData(state.ID, store, kms)
+	if err != nil {
+		log.Errorf("failed to restore version %d of state with id %s: %v", version, state.ID, err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	if currentFile, err := terraform.ParseStateFile(current); err == nil && currentFile.Serial >= restored.Serial {
+		restored.Serial = currentFile.Serial + 1
+
+		if data, err = terraform.SetSerial(data, restored.Serial); err != nil {
+			log.Errorf("failed to set serial of version %d of state with id %s: %v", version, state.ID, err)
+			HTTPResponse(w, r, http.StatusInternalServerError, "")
+			return
+		}
+	}
+
+	if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); force {
+		log.Warnf("skipping serial and lineage check for state with id %s", state.ID)
+	} else if code, err := checkStateUpdate(state.ID, current, data); err != nil {
+		log.Warnf("rejecting restore of version %d of state with id %s: %v", version, state.ID, err)
+		HTTPResponse(w, r, code, err.Error())
+		return
+	}
+
+	// the serial may have changed, so the data is encrypted again
+	if state.Data, err = kms.Encrypt(data, []byte(state.ID)); err != nil {
+		log.Errorf("failed to encrypt version %d of state with id %s: %v", version, state.ID, err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	state.Metadata.Serial, state.Metadata.Lineage = restored.Serial, restored.Lineage
+
+	if err := store.SaveState(state); err != nil {
+		log.Errorf("failed to restore version %d of state with id %s: %v", version, state.ID, err)
+		HTTPResponse(w, r, http.StatusInternalServerError, "")
+		return
+	}
+
+	HTTPResponse(w, r, http.StatusOK, "")
+}
+
+func parseVersion(w http.ResponseWriter, r *http.Request) (int, bool) {
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil || version < 1 {
+		HTTPResponse(w, r, http.StatusBadRequest, "Invalid version")
+		return 0, false
+	}
+
+	return version, true
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/require"
+
+	locallock "github.com/nimbolus/terraform-backend/pkg/lock/local"
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/storage/filesystem"
+	"github.com/nimbolus/terraform-backend/pkg/storage/mirror"
+	tf "github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func TestVersionHandler_Unsupported(t *testing.T) {
+	primary, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	secondary, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	// the mirror implements the optional interfaces, but the primary backend doesn't support them
+	store := mirror.NewMirrorStorage(struct{ storage.Storage }{primary}, secondary)
+	locker := locallock.NewLock(time.Hour)
+
+	r := mux.NewRouter()
+	r.HandleFunc("/states", ListHandler(store, locker))
+	r.HandleFunc("/state/{project}/{name}/versions", VersionHandler(store, nil))
+	r.HandleFunc("/state/{project}/{name}/versions/{version}", VersionHandler(store, nil))
+	r.HandleFunc("/state/{project}/{name}/versions/{version}/restore", RestoreHandler(store, locker, nil))
+
+	s := httptest.NewServer(r)
+	t.Cleanup(s.Close)
+
+	address := s.URL + "/state/project1/example"
+
+	for _, req := range []struct{ method, url string }{
+		{http.MethodGet, s.URL + "/states"},
+		{http.MethodGet, address + "/versions"},
+		{http.MethodGet, address + "/versions/1"},
+		{http.MethodPost, address + "/versions/1/restore"},
+	} {
+		code, _ := doRequest(t, req.method, req.url, nil)
+		require.Equal(t, http.StatusNotImplemented, code, "%s %s", req.method, req.url)
+	}
+}
+
+func TestVersionHandler(t *testing.T) {
+	s := newTestServer(t)
+	address := s.URL + "/state/project1/example"
+
+	lockInfo, err := json.Marshal(&tf.LockInfo{ID: "cf290ef3-6090-410e-9784-d017a4b1536a"})
+	require.NoError(t, err)
+
+	code, _ := doRequest(t, "LOCK", address, lockInfo)
+	require.Equal(t, http.StatusOK, code)
+
+	v1 := `{"version": 4, "serial": 1, "lineage": "a1b2"}`
+	v2 := `{"version": 4, "serial": 2, "lineage": "a1b2"}`
+
+	for _, data := range []string{v1, v2} {
+		code, _ = doRequest(t, http.MethodPost, address+"?ID=cf290ef3-6090-410e-9784-d017a4b1536a", []byte(data))
+		require.Equal(t, http.StatusOK, code)
+	}
+
+	code, body := doRequest(t, http.MethodGet, address+"/versions", nil)
+	require.Equal(t, http.StatusOK, code)
+
+	var versions []storage.StateVersion
+	require.NoError(t, json.Unmarshal(body, &versions))
+	require.Len(t, versions, 2)
+
+	code, body = doRequest(t, http.MethodGet, address+"/versions/1", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, v1, string(body))
+
+	code, _ = doRequest(t, http.MethodGet, address+"/versions/3", nil)
+	require.Equal(t, http.StatusNotFound, code)
+
+	// the state is locked by someone else
+	code, _ = doRequest(t, http.MethodPost, address+"/versions/1/restore", nil)
+	require.Equal(t, http.StatusLocked, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"/versions/1/restore?ID=cf290ef3-6090-410e-9784-d017a4b1536a", nil)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, "UNLOCK", address, lockInfo)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"/versions/2/restore", nil)
+	require.Equal(t, http.StatusOK, code)
+
+	// the restored versions get the next serial, so that Terraform accepts them as the latest state
+	code, body = doRequest(t, http.MethodGet, address, nil)
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, tf.CheckStateUpdate([]byte(`{"version": 4, "serial": 4, "lineage": "a1b2"}`), body))
+
+	f, err := tf.ParseStateFile(body)
+	require.NoError(t, err)
+	require.Equal(t, uint64(4), f.Serial)
+
+	code, body = doRequest(t, http.MethodGet, address+"/versions/3", nil)
+	require.Equal(t, http.StatusOK, code)
+
+	f, err = tf.ParseStateFile(body)
+	require.NoError(t, err)
+	require.Equal(t, uint64(3), f.Serial)
+
+	code, body = doRequest(t, http.MethodGet, address+"/versions", nil)
+	require.Equal(t, http.StatusOK, code)
+	require.NoError(t, json.Unmarshal(body, &versions))
+	require.Len(t, versions, 4)
+
+	// a version of another lineage is only restored with force
+	code, _ = doRequest(t, "LOCK", address, lockInfo)
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"?ID=cf290ef3-6090-410e-9784-d017a4b1536a&force=true", []byte(`{"version": 4, "serial": 1, "lineage": "c3d4"}`))
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"/versions/1/restore?ID=cf290ef3-6090-410e-9784-d017a4b1536a", nil)
+	require.Equal(t, http.StatusConflict, code)
+
+	code, _ = doRequest(t, http.MethodPost, address+"/versions/1/restore?ID=cf290ef3-6090-410e-9784-d017a4b1536a&force=true", nil)
+	require.Equal(t, http.StatusOK, code)
+}
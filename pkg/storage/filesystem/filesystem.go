@@ -1,15 +1,41 @@
 package filesystem
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/nimbolus/terraform-backend/pkg/config"
 	"github.com/nimbolus/terraform-backend/pkg/storage"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
-const Name = "fs"
+const (
+	Name = "fs"
+
+	stateFileSuffix    = ".tfstate"
+	metadataFileSuffix = ".meta.json"
+	versionsDir        = "versions"
+)
+
+func init() {
+	storage.Register(Name, func(cfg config.StorageConfig, _ config.ClientsConfig) (storage.Storage, error) {
+		return NewFileSystemStorage(cfg.FS.Dir)
+	})
+}
+
+// metadata is stored next to the state file, since the file name is only a hash of the state path.
+type metadata struct {
+	Project string `json:"project"`
+	Name    string `json:"name"`
+	terraform.Metadata
+}
 
 type FileSystemStorage struct {
 	directory string
@@ -31,7 +57,63 @@ func (f *FileSystemStorage) GetName() string {
 }
 
 func (f *FileSystemStorage) SaveState(s *terraform.State) error {
-	return os.WriteFile(f.getFileName(s.ID), s.Data, 0600)
+	versions, err := f.ListStateVersions(s.ID)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1].Version + 1
+	}
+
+	if err := os.MkdirAll(f.getVersionDir(s.ID), 0700); err != nil {
+		return fmt.Errorf("failed to create version directory for state %s: %v", s.ID, err)
+	}
+
+	// the version file is created exclusively, so a concurrent save takes the next version instead of overwriting it
+	for ; ; next++ {
+		err := f.createVersionFile(s.ID, next, s.Data)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to write version %d of state %s: %v", next, s.ID, err)
+		}
+
+		break
+	}
+
+	meta, err := f.readMetadata(s.ID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	if meta.Created.IsZero() {
+		s.Metadata.Created = now
+	} else {
+		s.Metadata.Created = meta.Created
+	}
+	s.Metadata.Updated = now
+
+	return f.ImportState(s)
+}
+
+func (f *FileSystemStorage) ImportState(s *terraform.State) error {
+	rawMeta, err := json.Marshal(metadata{
+		Project:  s.Project,
+		Name:     s.Name,
+		Metadata: s.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := f.replaceFile(f.getMetadataFileName(s.ID), rawMeta); err != nil {
+		return fmt.Errorf("failed to write metadata of state %s: %v", s.ID, err)
+	}
+
+	return f.replaceFile(f.getFileName(s.ID), s.Data)
 }
 
 func (f *FileSystemStorage) GetState(id string) (*terraform.State, error) {
@@ -44,17 +126,220 @@ func (f *FileSystemStorage) GetState(id string) (*terraform.State, error) {
 		return nil, err
 	}
 
+	meta, err := f.readMetadata(id)
+	if err != nil {
+		return nil, err
+	}
+
 	return &terraform.State{
-		Data: d,
+		ID:       id,
+		Data:     d,
+		Project:  meta.Project,
+		Name:     meta.Name,
+		Metadata: meta.Metadata,
 	}, nil
 }
 
 func (f *FileSystemStorage) DeleteState(id string) error {
+	if err := os.RemoveAll(f.getVersionDir(id)); err != nil {
+		return fmt.Errorf("failed to delete versions of state %s: %v", id, err)
+	}
+
+	if err := os.Remove(f.getMetadataFileName(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete metadata of state %s: %v", id, err)
+	}
+
 	return os.Remove(f.getFileName(id))
 }
 
+func (f *FileSystemStorage) ListStates() ([]storage.StateInfo, error) {
+	entries, err := os.ReadDir(f.directory)
+	if err != nil {
+		return nil, err
+	}
+
+	states := []storage.StateInfo{}
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), stateFileSuffix) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		id := strings.TrimSuffix(e.Name(), stateFileSuffix)
+
+		meta, err := f.readMetadata(id)
+		if err != nil {
+			return nil, err
+		}
+
+		states = append(states, storage.StateInfo{
+			ID:           id,
+			Project:      meta.Project,
+			Name:         meta.Name,
+			Size:         info.Size(),
+			LastModified: info.ModTime(),
+			Metadata:     meta.Metadata,
+		})
+	}
+
+	return states, nil
+}
+
+func (f *FileSystemStorage) ListStateVersions(id string) ([]storage.StateVersion, error) {
+	entries, err := os.ReadDir(f.getVersionDir(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return []storage.StateVersion{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	versions := make([]storage.StateVersion, 0, len(entries))
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), stateFileSuffix) {
+			continue
+		}
+
+		version, err := strconv.Atoi(strings.TrimSuffix(e.Name(), stateFileSuffix))
+		if err != nil {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, storage.StateVersion{
+			Version: version,
+			Size:    info.Size(),
+			Created: info.ModTime(),
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions, nil
+}
+
+func (f *FileSystemStorage) GetStateVersion(id string, version int) (*terraform.State, error) {
+	d, err := os.ReadFile(f.getVersionFileName(id, version))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, storage.ErrVersionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return &terraform.State{
+		ID:   id,
+		Data: d,
+	}, nil
+}
+
+func (f *FileSystemStorage) PutStateVersion(id string, version storage.StateVersion, data []byte) error {
+	if err := os.MkdirAll(f.getVersionDir(id), 0700); err != nil {
+		return fmt.Errorf("failed to create version directory for state %s: %v", id, err)
+	}
+
+	name := f.getVersionFileName(id, version.Version)
+
+	if err := os.WriteFile(name, data, 0600); err != nil {
+		return fmt.Errorf("failed to write version %d of state %s: %v", version.Version, id, err)
+	}
+
+	if version.Created.IsZero() {
+		return nil
+	}
+
+	// the creation time of a version is the modification time of its file
+	return os.Chtimes(name, version.Created, version.Created)
+}
+
+// replaceFile writes the data to a temporary file, which replaces the file, so that concurrent reads never see a
+// partially written file.
+func (f *FileSystemStorage) replaceFile(name string, data []byte) error {
+	tmp, err := os.CreateTemp(f.directory, ".tmp-*")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(tmp.Name(), name)
+	}
+
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+
+	return err
+}
+
+// createVersionFile writes a new version, it fails with os.ErrExist if the version exists already.
+func (f *FileSystemStorage) createVersionFile(id string, version int, data []byte) error {
+	name := f.getVersionFileName(id, version)
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		// an incomplete version must not be kept
+		_ = os.Remove(name)
+	}
+
+	return err
+}
+
 func (f *FileSystemStorage) getFileName(id string) string {
-	return fmt.Sprintf("%s/%s.tfstate", f.directory, id)
+	return fmt.Sprintf("%s/%s%s", f.directory, id, stateFileSuffix)
+}
+
+func (f *FileSystemStorage) getMetadataFileName(id string) string {
+	return fmt.Sprintf("%s/%s%s", f.directory, id, metadataFileSuffix)
+}
+
+// readMetadata returns the metadata of a state, which is empty for states saved before metadata was introduced.
+func (f *FileSystemStorage) readMetadata(id string) (metadata, error) {
+	var meta metadata
+
+	d, err := os.ReadFile(f.getMetadataFileName(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return meta, nil
+	} else if err != nil {
+		return meta, err
+	}
+
+	if err := json.Unmarshal(d, &meta); err != nil {
+		return meta, fmt.Errorf("failed to parse metadata of state %s: %v", id, err)
+	}
+
+	return meta, nil
+}
+
+func (f *FileSystemStorage) getVersionDir(id string) string {
+	return filepath.Join(f.directory, versionsDir, id)
+}
+
+func (f *FileSystemStorage) getVersionFileName(id string, version int) string {
+	return filepath.Join(f.getVersionDir(id), fmt.Sprintf("%d%s", version, stateFileSuffix))
 }
 
 func (f *FileSystemStorage) CountStoredObjects() (int, error) {
@@ -69,5 +354,13 @@ func (f *FileSystemStorage) CountStoredObjects() (int, error) {
 		return 0, err
 	}
 
-	return len(list), nil
+	count := 0
+
+	for _, name := range list {
+		if strings.HasSuffix(name, stateFileSuffix) {
+			count++
+		}
+	}
+
+	return count, nil
 }
@@ -0,0 +1,149 @@
+package mirror
+
+import (
+	"errors"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+const Name = "mirror"
+
+// MirrorStorage reads from the primary storage backend and writes to both the primary and the secondary backend,
+// so that the secondary backend stays in sync while states are migrated to it. Failed writes to the secondary backend
+// are only logged, since the primary backend stays the source of truth until the migration is finished. The optional
+// operations return storage.ErrUnsupported, if the primary backend doesn't support them.
+type MirrorStorage struct {
+	primary   storage.Storage
+	secondary storage.Storage
+}
+
+func NewMirrorStorage(primary, secondary storage.Storage) *MirrorStorage {
+	return &MirrorStorage{
+		primary:   primary,
+		secondary: secondary,
+	}
+}
+
+func (m *MirrorStorage) GetName() string {
+	return fmt.Sprintf("%s(%s,%s)", Name, m.primary.GetName(), m.secondary.GetName())
+}
+
+// Primary returns the storage backend states are read from.
+func (m *MirrorStorage) Primary() storage.Storage {
+	return m.primary
+}
+
+// Secondary returns the storage backend states are mirrored to.
+func (m *MirrorStorage) Secondary() storage.Storage {
+	return m.secondary
+}
+
+func (m *MirrorStorage) SaveState(s *terraform.State) error {
+	if err := m.primary.SaveState(s); err != nil {
+		return err
+	}
+
+	// the secondary backend sets its own timestamps, which must not be returned to the caller
+	mirrored := *s
+
+	if err := m.secondary.SaveState(&mirrored); err != nil {
+		m.logger(s.ID).WithError(err).Error("failed to mirror state")
+	}
+
+	return nil
+}
+
+// ImportState writes the state to both backends, the primary backend has to be an importer.
+func (m *MirrorStorage) ImportState(s *terraform.State) error {
+	importer, ok := m.primary.(storage.Importer)
+	if !ok {
+		return fmt.Errorf("storage backend %s does not support importing states: %w", m.primary.GetName(), storage.ErrUnsupported)
+	}
+
+	if err := importer.ImportState(s); err != nil {
+		return err
+	}
+
+	if importer, ok := m.secondary.(storage.Importer); !ok {
+		m.logger(s.ID).Error("failed to mirror imported state, storage backend does not support importing states")
+	} else if err := importer.ImportState(s); err != nil {
+		m.logger(s.ID).WithError(err).Error("failed to mirror imported state")
+	}
+
+	return nil
+}
+
+func (m *MirrorStorage) GetState(id string) (*terraform.State, error) {
+	return m.primary.GetState(id)
+}
+
+func (m *MirrorStorage) DeleteState(id string) error {
+	if err := m.primary.DeleteState(id); err != nil {
+		return err
+	}
+
+	if err := m.secondary.DeleteState(id); err != nil && !errors.Is(err, storage.ErrStateNotFound) {
+		m.logger(id).WithError(err).Error("failed to delete mirrored state")
+	}
+
+	return nil
+}
+
+func (m *MirrorStorage) ListStates() ([]storage.StateInfo, error) {
+	lister, ok := m.primary.(storage.Lister)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s does not support listing: %w", m.primary.GetName(), storage.ErrUnsupported)
+	}
+
+	return lister.ListStates()
+}
+
+func (m *MirrorStorage) ListStateVersions(id string) ([]storage.StateVersion, error) {
+	versioned, ok := m.primary.(storage.Versioned)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s does not support versioning: %w", m.primary.GetName(), storage.ErrUnsupported)
+	}
+
+	return versioned.ListStateVersions(id)
+}
+
+func (m *MirrorStorage) GetStateVersion(id string, version int) (*terraform.State, error) {
+	versioned, ok := m.primary.(storage.Versioned)
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s does not support versioning: %w", m.primary.GetName(), storage.ErrUnsupported)
+	}
+
+	return versioned.GetStateVersion(id, version)
+}
+
+// PutStateVersion writes the version to both backends, the primary backend has to be a version writer.
+func (m *MirrorStorage) PutStateVersion(id string, version storage.StateVersion, data []byte) error {
+	writer, ok := m.primary.(storage.VersionWriter)
+	if !ok {
+		return fmt.Errorf("storage backend %s does not support writing versions: %w", m.primary.GetName(), storage.ErrUnsupported)
+	}
+
+	if err := writer.PutStateVersion(id, version, data); err != nil {
+		return err
+	}
+
+	if writer, ok := m.secondary.(storage.VersionWriter); !ok {
+		m.logger(id).Errorf("failed to mirror version %d, storage backend does not support writing versions", version.Version)
+	} else if err := writer.PutStateVersion(id, version, data); err != nil {
+		m.logger(id).WithError(err).Errorf("failed to mirror version %d", version.Version)
+	}
+
+	return nil
+}
+
+func (m *MirrorStorage) logger(id string) *log.Entry {
+	return log.WithFields(log.Fields{
+		"component": "mirror",
+		"state_id":  id,
+		"storage":   m.secondary.GetName(),
+	})
+}
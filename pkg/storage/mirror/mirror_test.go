@@ -0,0 +1,104 @@
+package mirror
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/nimbolus/terraform-backend/pkg/storage"
+	"github.com/nimbolus/terraform-backend/pkg/storage/filesystem"
+	"github.com/nimbolus/terraform-backend/pkg/storage/util"
+	"github.com/nimbolus/terraform-backend/pkg/terraform"
+)
+
+func newMirrorStorage(t *testing.T) (*MirrorStorage, storage.Storage) {
+	primary, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	secondary, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	return NewMirrorStorage(primary, secondary), secondary
+}
+
+func TestStorage(t *testing.T) {
+	s, _ := newMirrorStorage(t)
+
+	util.StorageTest(t, s)
+}
+
+func TestVersionedStorage(t *testing.T) {
+	s, _ := newMirrorStorage(t)
+
+	util.VersionedStorageTest(t, s)
+}
+
+func TestListerStorage(t *testing.T) {
+	s, _ := newMirrorStorage(t)
+
+	util.ListerStorageTest(t, s)
+}
+
+func TestVersionWriterStorage(t *testing.T) {
+	s, _ := newMirrorStorage(t)
+
+	util.VersionWriterStorageTest(t, s)
+}
+
+func TestImporterStorage(t *testing.T) {
+	s, _ := newMirrorStorage(t)
+
+	util.ImporterStorageTest(t, s)
+}
+
+// basicStorage only implements the required methods of the wrapped backend.
+type basicStorage struct {
+	storage.Storage
+}
+
+func TestUnsupported(t *testing.T) {
+	primary, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	secondary, err := filesystem.NewFileSystemStorage(t.TempDir())
+	require.NoError(t, err)
+
+	s := NewMirrorStorage(basicStorage{primary}, secondary)
+	id := terraform.GetStateID("test", "mirror")
+
+	_, err = s.ListStates()
+	require.ErrorIs(t, err, storage.ErrUnsupported)
+
+	_, err = s.ListStateVersions(id)
+	require.ErrorIs(t, err, storage.ErrUnsupported)
+
+	_, err = s.GetStateVersion(id, 1)
+	require.ErrorIs(t, err, storage.ErrUnsupported)
+
+	require.ErrorIs(t, s.PutStateVersion(id, storage.StateVersion{Version: 1}, nil), storage.ErrUnsupported)
+	require.ErrorIs(t, s.ImportState(&terraform.State{ID: id}), storage.ErrUnsupported)
+}
+
+func TestMirror(t *testing.T) {
+	s, secondary := newMirrorStorage(t)
+
+	state := &terraform.State{
+		ID:      terraform.GetStateID("test", "mirror"),
+		Project: "test",
+		Name:    "mirror",
+		Data:    []byte("test"),
+	}
+
+	require.NoError(t, s.SaveState(state))
+
+	mirrored, err := secondary.GetState(state.ID)
+	require.NoError(t, err)
+	require.Equal(t, state.Data, mirrored.Data)
+	require.Equal(t, state.Project, mirrored.Project)
+	require.Equal(t, state.Name, mirrored.Name)
+
+	require.NoError(t, s.DeleteState(state.ID))
+
+	_, err = secondary.GetState(state.ID)
+	require.ErrorIs(t, err, storage.ErrStateNotFound)
+}
@@ -7,21 +7,36 @@ import (
 	"fmt"
 	"time"
 
+	pgclient "github.com/nimbolus/terraform-backend/pkg/client/postgres"
+	"github.com/nimbolus/terraform-backend/pkg/config"
 	"github.com/nimbolus/terraform-backend/pkg/storage"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
 const Name = "postgres"
 
+func init() {
+	storage.Register(Name, func(cfg config.StorageConfig, clients config.ClientsConfig) (storage.Storage, error) {
+		db, err := pgclient.NewClient(clients.Postgres)
+		if err != nil {
+			return nil, fmt.Errorf("creating postgres client: %w", err)
+		}
+
+		return NewPostgresStorage(db, cfg.Postgres.Table)
+	})
+}
+
 type PostgresStorage struct {
-	db    *sql.DB
-	table string
+	db            *sql.DB
+	table         string
+	versionsTable string
 }
 
 func NewPostgresStorage(db *sql.DB, table string) (*PostgresStorage, error) {
 	p := &PostgresStorage{
-		db:    db,
-		table: table,
+		db:            db,
+		table:         table,
+		versionsTable: table + "_versions",
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
@@ -41,6 +56,28 @@ func NewPostgresStorage(db *sql.DB, table string) (*PostgresStorage, error) {
 		return nil, fmt.Errorf("creating states table: %w", err)
 	}
 
+	if _, err := tx.Exec(`ALTER TABLE ` + p.table + `
+			ADD COLUMN IF NOT EXISTS project TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS name TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			ADD COLUMN IF NOT EXISTS auth_method TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS last_writer TEXT NOT NULL DEFAULT '',
+			ADD COLUMN IF NOT EXISTS serial BIGINT NOT NULL DEFAULT 0,
+			ADD COLUMN IF NOT EXISTS lineage TEXT NOT NULL DEFAULT '';`); err != nil {
+		return nil, fmt.Errorf("migrating states table: %w", err)
+	}
+
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS ` + p.versionsTable + ` (
+			state_id CHARACTER VARYING(255) NOT NULL,
+			version INTEGER NOT NULL,
+			state_data BYTEA,
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+			PRIMARY KEY (state_id, version)
+		);`); err != nil {
+		return nil, fmt.Errorf("creating state versions table: %w", err)
+	}
+
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("committing states table: %w", err)
 	}
@@ -53,27 +90,166 @@ func (p *PostgresStorage) GetName() string {
 }
 
 func (p *PostgresStorage) SaveState(s *terraform.State) error {
-	if _, err := p.db.Exec(`INSERT INTO `+p.table+` (state_id, state_data) VALUES ($1, $2)
-		ON CONFLICT (state_id) DO UPDATE SET state_data = EXCLUDED.state_data`, s.ID, s.Data); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback() // nolint: errcheck
+
+	// concurrent saves of a state are serialized until the commit, so that they don't compute the same version
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, s.ID); err != nil {
+		return fmt.Errorf("locking state %s: %w", s.ID, err)
+	}
+
+	// created_at is only set by the initial insert
+	if err := tx.QueryRow(`INSERT INTO `+p.table+` (state_id, state_data, project, name, auth_method, last_writer, serial, lineage,
+		created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, now(), now())
+		ON CONFLICT (state_id) DO UPDATE SET state_data = EXCLUDED.state_data, project = EXCLUDED.project, name = EXCLUDED.name,
+		auth_method = EXCLUDED.auth_method, last_writer = EXCLUDED.last_writer, serial = EXCLUDED.serial,
+		lineage = EXCLUDED.lineage, updated_at = EXCLUDED.updated_at
+		RETURNING created_at, updated_at`, s.ID, s.Data, s.Project, s.Name, s.Metadata.AuthMethod, s.Metadata.LastWriter,
+		int64(s.Metadata.Serial), s.Metadata.Lineage,
+	).Scan(&s.Metadata.Created, &s.Metadata.Updated); err != nil {
 		return err
 	}
 
-	return nil
+	if _, err := tx.Exec(`INSERT INTO `+p.versionsTable+` (state_id, version, state_data)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2 FROM `+p.versionsTable+` WHERE state_id = $1`, s.ID, s.Data); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (p *PostgresStorage) ImportState(s *terraform.State) error {
+	created, updated := s.Metadata.Created, s.Metadata.Updated
+	if created.IsZero() {
+		created = time.Now()
+	}
+	if updated.IsZero() {
+		updated = created
+	}
+
+	_, err := p.db.Exec(`INSERT INTO `+p.table+` (state_id, state_data, project, name, auth_method, last_writer, serial, lineage,
+		created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		ON CONFLICT (state_id) DO UPDATE SET state_data = EXCLUDED.state_data, project = EXCLUDED.project, name = EXCLUDED.name,
+		auth_method = EXCLUDED.auth_method, last_writer = EXCLUDED.last_writer, serial = EXCLUDED.serial,
+		lineage = EXCLUDED.lineage, created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at`,
+		s.ID, s.Data, s.Project, s.Name, s.Metadata.AuthMethod, s.Metadata.LastWriter, int64(s.Metadata.Serial), s.Metadata.Lineage,
+		created, updated)
+
+	return err
 }
 
 func (p *PostgresStorage) GetState(id string) (*terraform.State, error) {
-	s := &terraform.State{}
+	s := &terraform.State{
+		ID: id,
+	}
+
+	var serial int64
 
-	err := p.db.QueryRow(`SELECT state_data FROM `+p.table+` WHERE state_id = $1`, id).Scan(&s.Data)
+	err := p.db.QueryRow(`SELECT state_data, project, name, auth_method, created_at, updated_at, last_writer, serial, lineage
+		FROM `+p.table+` WHERE state_id = $1`, id).Scan(&s.Data, &s.Project, &s.Name, &s.Metadata.AuthMethod,
+		&s.Metadata.Created, &s.Metadata.Updated, &s.Metadata.LastWriter, &serial, &s.Metadata.Lineage)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, storage.ErrStateNotFound
 	} else if err != nil {
 		return nil, err
 	}
 
+	s.Metadata.Serial = uint64(serial)
+
 	return s, nil
 }
 
 func (p *PostgresStorage) DeleteState(id string) error {
+	if err := p.db.QueryRow(`DELETE FROM `+p.versionsTable+` WHERE state_id = $1`, id).Err(); err != nil {
+		return err
+	}
+
 	return p.db.QueryRow(`DELETE FROM `+p.table+` WHERE state_id = $1`, id).Err()
 }
+
+func (p *PostgresStorage) ListStates() ([]storage.StateInfo, error) {
+	rows, err := p.db.Query(`SELECT state_id, project, name, COALESCE(octet_length(state_data), 0), updated_at,
+		auth_method, created_at, updated_at, last_writer, serial, lineage FROM ` + p.table + ` ORDER BY project, name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	states := []storage.StateInfo{}
+
+	for rows.Next() {
+		var s storage.StateInfo
+		var serial int64
+
+		if err := rows.Scan(&s.ID, &s.Project, &s.Name, &s.Size, &s.LastModified,
+			&s.AuthMethod, &s.Created, &s.Updated, &s.LastWriter, &serial, &s.Lineage); err != nil {
+			return nil, err
+		}
+
+		s.Serial = uint64(serial)
+
+		states = append(states, s)
+	}
+
+	return states, rows.Err()
+}
+
+func (p *PostgresStorage) ListStateVersions(id string) ([]storage.StateVersion, error) {
+	rows, err := p.db.Query(`SELECT version, COALESCE(octet_length(state_data), 0), created_at FROM `+p.versionsTable+`
+		WHERE state_id = $1 ORDER BY version`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []storage.StateVersion{}
+
+	for rows.Next() {
+		var v storage.StateVersion
+
+		if err := rows.Scan(&v.Version, &v.Size, &v.Created); err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, v)
+	}
+
+	return versions, rows.Err()
+}
+
+func (p *PostgresStorage) PutStateVersion(id string, version storage.StateVersion, data []byte) error {
+	created := version.Created
+	if created.IsZero() {
+		created = time.Now()
+	}
+
+	_, err := p.db.Exec(`INSERT INTO `+p.versionsTable+` (state_id, version, state_data, created_at) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (state_id, version) DO UPDATE SET state_data = EXCLUDED.state_data, created_at = EXCLUDED.created_at`,
+		id, version.Version, data, created)
+
+	return err
+}
+
+func (p *PostgresStorage) GetStateVersion(id string, version int) (*terraform.State, error) {
+	s := &terraform.State{
+		ID: id,
+	}
+
+	err := p.db.QueryRow(`SELECT state_data FROM `+p.versionsTable+` WHERE state_id = $1 AND version = $2`, id, version).Scan(&s.Data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, storage.ErrVersionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -15,3 +15,45 @@ func TestStorage(t *testing.T) {
 
 	util.StorageTest(t, s)
 }
+
+func TestVersionedStorage(t *testing.T) {
+	s, err := NewPostgresStorage(postgrestest.NewIfIntegrationTest(t), "states")
+	require.NoError(t, err)
+
+	util.VersionedStorageTest(t, s)
+}
+
+func TestConcurrentSaveStorage(t *testing.T) {
+	s, err := NewPostgresStorage(postgrestest.NewIfIntegrationTest(t), "states")
+	require.NoError(t, err)
+
+	util.ConcurrentSaveStorageTest(t, s)
+}
+
+func TestListerStorage(t *testing.T) {
+	s, err := NewPostgresStorage(postgrestest.NewIfIntegrationTest(t), "states")
+	require.NoError(t, err)
+
+	util.ListerStorageTest(t, s)
+}
+
+func TestMetadataStorage(t *testing.T) {
+	s, err := NewPostgresStorage(postgrestest.NewIfIntegrationTest(t), "states")
+	require.NoError(t, err)
+
+	util.MetadataStorageTest(t, s)
+}
+
+func TestVersionWriterStorage(t *testing.T) {
+	s, err := NewPostgresStorage(postgrestest.NewIfIntegrationTest(t), "states")
+	require.NoError(t, err)
+
+	util.VersionWriterStorageTest(t, s)
+}
+
+func TestImporterStorage(t *testing.T) {
+	s, err := NewPostgresStorage(postgrestest.NewIfIntegrationTest(t), "states")
+	require.NoError(t, err)
+
+	util.ImporterStorageTest(t, s)
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/nimbolus/terraform-backend/pkg/config"
+)
+
+// Factory creates a storage backend from its configuration.
+type Factory func(cfg config.StorageConfig, clients config.ClientsConfig) (Storage, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a storage backend available by name, it's meant to be called in the init function of the package
+// implementing the backend. Register panics if it's called twice with the same name.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if _, ok := factories[name]; ok {
+		panic("storage: Register called twice for backend " + name)
+	}
+
+	factories[name] = factory
+}
+
+// Backends returns the sorted names of the registered storage backends.
+func Backends() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// New creates the storage backend configured by cfg.Backend.
+func New(cfg config.StorageConfig, clients config.ClientsConfig) (Storage, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[cfg.Backend]
+	factoriesMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("storage backend %s is not implemented (registered: %s)", cfg.Backend, strings.Join(Backends(), ", "))
+	}
+
+	s, err := factory(cfg, clients)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize storage backend %s: %v", cfg.Backend, err)
+	}
+
+	return s, nil
+}
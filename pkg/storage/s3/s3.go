@@ -4,15 +4,43 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 
+	"github.com/nimbolus/terraform-backend/pkg/config"
 	"github.com/nimbolus/terraform-backend/pkg/storage"
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
-const Name = "s3"
+const (
+	Name = "s3"
+
+	stateObjectSuffix = ".tfstate"
+	versionsPrefix    = "versions"
+
+	// user metadata keys of the state object, the values are query escaped to stay within the allowed characters
+	projectMetadataKey    = "Project"
+	nameMetadataKey       = "Name"
+	authMethodMetadataKey = "Auth-Method"
+	createdMetadataKey    = "Created"
+	updatedMetadataKey    = "Updated"
+	lastWriterMetadataKey = "Last-Writer"
+	serialMetadataKey     = "Serial"
+	lineageMetadataKey    = "Lineage"
+)
+
+func init() {
+	storage.Register(Name, func(cfg config.StorageConfig, _ config.ClientsConfig) (storage.Storage, error) {
+		return NewS3Storage(cfg.S3.Endpoint, cfg.S3.Bucket, cfg.S3.AccessKey, cfg.S3.SecretKey, cfg.S3.UseSSL)
+	})
+}
 
 type S3Storage struct {
 	client *minio.Client
@@ -47,11 +75,47 @@ func (s *S3Storage) GetName() string {
 }
 
 func (s *S3Storage) SaveState(state *terraform.State) error {
-	r := bytes.NewReader(state.Data)
-	_, err := s.client.PutObject(context.Background(), s.bucket, getObjectName(state.ID), r, r.Size(), minio.PutObjectOptions{
-		ContentType: "application/octet-stream",
-	})
-	return err
+	versions, err := s.ListStateVersions(state.ID)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1].Version + 1
+	}
+
+	// the version object is only created if it doesn't exist, so a concurrent save takes the next version instead of
+	// overwriting it
+	for ; ; next++ {
+		err := s.createObject(getVersionObjectName(state.ID, next), state.Data)
+		if minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("failed to put version %d of state %s: %w", next, state.ID, err)
+		}
+
+		break
+	}
+
+	now := time.Now().UTC()
+	state.Metadata.Created = now
+	state.Metadata.Updated = now
+
+	info, err := s.client.StatObject(context.Background(), s.bucket, getObjectName(state.ID), minio.StatObjectOptions{})
+	if err == nil {
+		if _, _, existing := decodeMetadata(info.UserMetadata); !existing.Created.IsZero() {
+			state.Metadata.Created = existing.Created
+		}
+	} else if minio.ToErrorResponse(err).Code != "NoSuchKey" {
+		return fmt.Errorf("failed to get metadata of state %s: %w", state.ID, err)
+	}
+
+	return s.ImportState(state)
+}
+
+func (s *S3Storage) ImportState(state *terraform.State) error {
+	return s.putObject(getObjectName(state.ID), state.Data, encodeMetadata(state))
 }
 
 func (s *S3Storage) GetState(id string) (*terraform.State, error) {
@@ -59,28 +123,196 @@ func (s *S3Storage) GetState(id string) (*terraform.State, error) {
 		ID: id,
 	}
 
-	obj, err := s.client.GetObject(context.Background(), s.bucket, getObjectName(id), minio.GetObjectOptions{})
+	data, info, err := s.getObject(getObjectName(id))
 	if err != nil {
-		return state, err
-	}
-	defer obj.Close()
-
-	buf := new(bytes.Buffer)
-	if _, err := buf.ReadFrom(obj); err != nil {
 		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
 			return nil, storage.ErrStateNotFound
 		}
 		return state, err
 	}
 
-	state.Data = buf.Bytes()
+	state.Data = data
+	state.Project, state.Name, state.Metadata = decodeMetadata(info.UserMetadata)
 	return state, nil
 }
 
 func (s *S3Storage) DeleteState(id string) error {
+	versions, err := s.ListStateVersions(id)
+	if err != nil {
+		return err
+	}
+
+	for _, v := range versions {
+		if err := s.client.RemoveObject(context.Background(), s.bucket, getVersionObjectName(id, v.Version), minio.RemoveObjectOptions{}); err != nil {
+			return fmt.Errorf("failed to remove version %d of state %s: %w", v.Version, id, err)
+		}
+	}
+
 	return s.client.RemoveObject(context.Background(), s.bucket, getObjectName(id), minio.RemoveObjectOptions{})
 }
 
+func (s *S3Storage) ListStates() ([]storage.StateInfo, error) {
+	states := []storage.StateInfo{}
+
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+
+		if !strings.HasSuffix(obj.Key, stateObjectSuffix) {
+			continue
+		}
+
+		// the user metadata is not part of the object listing
+		info, err := s.client.StatObject(context.Background(), s.bucket, obj.Key, minio.StatObjectOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get metadata of %s: %w", obj.Key, err)
+		}
+
+		project, name, meta := decodeMetadata(info.UserMetadata)
+
+		states = append(states, storage.StateInfo{
+			ID:           strings.TrimSuffix(obj.Key, stateObjectSuffix),
+			Project:      project,
+			Name:         name,
+			Size:         info.Size,
+			LastModified: info.LastModified,
+			Metadata:     meta,
+		})
+	}
+
+	return states, nil
+}
+
+func (s *S3Storage) ListStateVersions(id string) ([]storage.StateVersion, error) {
+	versions := []storage.StateVersion{}
+
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{
+		Prefix: getVersionPrefix(id),
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+
+		version, err := strconv.Atoi(strings.TrimSuffix(path.Base(obj.Key), stateObjectSuffix))
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, storage.StateVersion{
+			Version: version,
+			Size:    obj.Size,
+			Created: obj.LastModified,
+		})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].Version < versions[j].Version
+	})
+
+	return versions, nil
+}
+
+func (s *S3Storage) GetStateVersion(id string, version int) (*terraform.State, error) {
+	data, _, err := s.getObject(getVersionObjectName(id, version))
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, storage.ErrVersionNotFound
+		}
+		return nil, err
+	}
+
+	return &terraform.State{
+		ID:   id,
+		Data: data,
+	}, nil
+}
+
+// PutStateVersion writes a version of a state. The creation time can't be preserved, since it's the modification time
+// of the version object.
+func (s *S3Storage) PutStateVersion(id string, version storage.StateVersion, data []byte) error {
+	return s.putObject(getVersionObjectName(id, version.Version), data, nil)
+}
+
+func (s *S3Storage) putObject(name string, data []byte, userMetadata map[string]string) error {
+	r := bytes.NewReader(data)
+	_, err := s.client.PutObject(context.Background(), s.bucket, name, r, r.Size(), minio.PutObjectOptions{
+		ContentType:  "application/octet-stream",
+		UserMetadata: userMetadata,
+	})
+	return err
+}
+
+// createObject writes the object with the condition "If-None-Match: *", it fails with the error code
+// PreconditionFailed if the object exists already.
+func (s *S3Storage) createObject(name string, data []byte) error {
+	opts := minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+	}
+	opts.SetMatchETagExcept("*")
+
+	r := bytes.NewReader(data)
+	_, err := s.client.PutObject(context.Background(), s.bucket, name, r, r.Size(), opts)
+	return err
+}
+
+func (s *S3Storage) getObject(name string) ([]byte, minio.ObjectInfo, error) {
+	obj, err := s.client.GetObject(context.Background(), s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+	defer obj.Close()
+
+	buf := new(bytes.Buffer)
+	if _, err := buf.ReadFrom(obj); err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	info, err := obj.Stat()
+	if err != nil {
+		return nil, minio.ObjectInfo{}, err
+	}
+
+	return buf.Bytes(), info, nil
+}
+
+func encodeMetadata(state *terraform.State) map[string]string {
+	return map[string]string{
+		projectMetadataKey:    url.QueryEscape(state.Project),
+		nameMetadataKey:       url.QueryEscape(state.Name),
+		authMethodMetadataKey: url.QueryEscape(state.Metadata.AuthMethod),
+		createdMetadataKey:    state.Metadata.Created.Format(time.RFC3339Nano),
+		updatedMetadataKey:    state.Metadata.Updated.Format(time.RFC3339Nano),
+		lastWriterMetadataKey: url.QueryEscape(state.Metadata.LastWriter),
+		serialMetadataKey:     strconv.FormatUint(state.Metadata.Serial, 10),
+		lineageMetadataKey:    url.QueryEscape(state.Metadata.Lineage),
+	}
+}
+
+// decodeMetadata returns project, name and metadata of a state object, missing values are left empty.
+func decodeMetadata(userMetadata map[string]string) (string, string, terraform.Metadata) {
+	project, _ := url.QueryUnescape(userMetadata[projectMetadataKey])
+	name, _ := url.QueryUnescape(userMetadata[nameMetadataKey])
+
+	var meta terraform.Metadata
+	meta.AuthMethod, _ = url.QueryUnescape(userMetadata[authMethodMetadataKey])
+	meta.Created, _ = time.Parse(time.RFC3339Nano, userMetadata[createdMetadataKey])
+	meta.Updated, _ = time.Parse(time.RFC3339Nano, userMetadata[updatedMetadataKey])
+	meta.LastWriter, _ = url.QueryUnescape(userMetadata[lastWriterMetadataKey])
+	meta.Serial, _ = strconv.ParseUint(userMetadata[serialMetadataKey], 10, 64)
+	meta.Lineage, _ = url.QueryUnescape(userMetadata[lineageMetadataKey])
+
+	return project, name, meta
+}
+
 func getObjectName(id string) string {
-	return fmt.Sprintf("%s.tfstate", id)
+	return fmt.Sprintf("%s%s", id, stateObjectSuffix)
+}
+
+func getVersionPrefix(id string) string {
+	return fmt.Sprintf("%s/%s/", versionsPrefix, id)
+}
+
+func getVersionObjectName(id string, version int) string {
+	return fmt.Sprintf("%s%d%s", getVersionPrefix(id), version, stateObjectSuffix)
 }
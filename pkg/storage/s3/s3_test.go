@@ -19,3 +19,69 @@ func TestStorage(t *testing.T) {
 
 	util.StorageTest(t, s)
 }
+
+func TestVersionedStorage(t *testing.T) {
+	if v := os.Getenv("INTEGRATION_TEST"); v == "" {
+		t.Skip("env var INTEGRATION_TEST not set")
+	}
+
+	s, err := NewS3Storage("localhost:9000", "tf-backend-integration-test", "root", "password", false)
+	require.NoError(t, err)
+
+	util.VersionedStorageTest(t, s)
+}
+
+func TestConcurrentSaveStorage(t *testing.T) {
+	if v := os.Getenv("INTEGRATION_TEST"); v == "" {
+		t.Skip("env var INTEGRATION_TEST not set")
+	}
+
+	s, err := NewS3Storage("localhost:9000", "tf-backend-integration-test", "root", "password", false)
+	require.NoError(t, err)
+
+	util.ConcurrentSaveStorageTest(t, s)
+}
+
+func TestListerStorage(t *testing.T) {
+	if v := os.Getenv("INTEGRATION_TEST"); v == "" {
+		t.Skip("env var INTEGRATION_TEST not set")
+	}
+
+	s, err := NewS3Storage("localhost:9000", "tf-backend-integration-test", "root", "password", false)
+	require.NoError(t, err)
+
+	util.ListerStorageTest(t, s)
+}
+
+func TestMetadataStorage(t *testing.T) {
+	if v := os.Getenv("INTEGRATION_TEST"); v == "" {
+		t.Skip("env var INTEGRATION_TEST not set")
+	}
+
+	s, err := NewS3Storage("localhost:9000", "tf-backend-integration-test", "root", "password", false)
+	require.NoError(t, err)
+
+	util.MetadataStorageTest(t, s)
+}
+
+func TestVersionWriterStorage(t *testing.T) {
+	if v := os.Getenv("INTEGRATION_TEST"); v == "" {
+		t.Skip("env var INTEGRATION_TEST not set")
+	}
+
+	s, err := NewS3Storage("localhost:9000", "tf-backend-integration-test", "root", "password", false)
+	require.NoError(t, err)
+
+	util.VersionWriterStorageTest(t, s)
+}
+
+func TestImporterStorage(t *testing.T) {
+	if v := os.Getenv("INTEGRATION_TEST"); v == "" {
+		t.Skip("env var INTEGRATION_TEST not set")
+	}
+
+	s, err := NewS3Storage("localhost:9000", "tf-backend-integration-test", "root", "password", false)
+	require.NoError(t, err)
+
+	util.ImporterStorageTest(t, s)
+}
@@ -2,12 +2,17 @@ package storage
 
 import (
 	"errors"
+	"time"
 
 	"github.com/nimbolus/terraform-backend/pkg/terraform"
 )
 
 var (
-	ErrStateNotFound = errors.New("state does not exist")
+	ErrStateNotFound   = errors.New("state does not exist")
+	ErrVersionNotFound = errors.New("state version does not exist")
+	// ErrUnsupported is returned by wrapping backends (e.g. the mirror), if the wrapped backend doesn't support an
+	// optional operation, which they offer (e.g. listing)
+	ErrUnsupported = errors.New("operation is not supported by the storage backend")
 )
 
 type Storage interface {
@@ -20,3 +25,43 @@ type Storage interface {
 type Countable interface {
 	CountStoredObjects() (int, error)
 }
+
+// StateInfo describes a stored state without its data.
+type StateInfo struct {
+	ID           string    `json:"id"`
+	Project      string    `json:"project"`
+	Name         string    `json:"name"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+	terraform.Metadata
+}
+
+// Lister is implemented by storage backends which are able to enumerate the stored states.
+type Lister interface {
+	ListStates() ([]StateInfo, error)
+}
+
+// StateVersion describes an immutable version of a state, which is created on every save.
+type StateVersion struct {
+	Version int       `json:"version"`
+	Size    int64     `json:"size"`
+	Created time.Time `json:"created"`
+}
+
+// Versioned is implemented by storage backends which keep the history of a state.
+type Versioned interface {
+	ListStateVersions(id string) ([]StateVersion, error)
+	GetStateVersion(id string, version int) (*terraform.State, error)
+}
+
+// VersionWriter is implemented by storage backends which can overwrite or import a single version of a state
+// (e.g. for re-encryption or migration) without changing the current state.
+type VersionWriter interface {
+	PutStateVersion(id string, version StateVersion, data []byte) error
+}
+
+// Importer is implemented by storage backends which can write the current state with its metadata as is
+// (e.g. for migration between storage backends), without creating a new version.
+type Importer interface {
+	ImportState(s *terraform.State) error
+}
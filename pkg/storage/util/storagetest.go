@@ -1,7 +1,10 @@
 package util
 
 import (
+	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -38,3 +41,290 @@ func StorageTest(t *testing.T, s storage.Storage) {
 	err = s.DeleteState(state.ID)
 	require.NoError(t, err)
 }
+
+func VersionedStorageTest(t *testing.T, s storage.Storage) {
+	v, ok := s.(storage.Versioned)
+	require.True(t, ok, "storage backend %s does not implement versioning", s.GetName())
+
+	state := &terraform.State{
+		ID:      terraform.GetStateID("test", "versioned"),
+		Project: "test",
+		Name:    "versioned",
+	}
+
+	versions, err := v.ListStateVersions(state.ID)
+	require.NoError(t, err)
+	require.Empty(t, versions)
+
+	data := [][]byte{[]byte("v1"), []byte("v2"), []byte("v3")}
+
+	for _, d := range data {
+		state.Data = d
+		require.NoError(t, s.SaveState(state))
+	}
+
+	versions, err = v.ListStateVersions(state.ID)
+	require.NoError(t, err)
+	require.Len(t, versions, len(data))
+
+	for i, version := range versions {
+		require.Equal(t, i+1, version.Version)
+		require.Equal(t, int64(len(data[i])), version.Size)
+		require.False(t, version.Created.IsZero())
+
+		savedVersion, err := v.GetStateVersion(state.ID, version.Version)
+		require.NoError(t, err)
+		require.Equal(t, data[i], savedVersion.Data)
+	}
+
+	current, err := s.GetState(state.ID)
+	require.NoError(t, err)
+	require.Equal(t, data[len(data)-1], current.Data)
+
+	_, err = v.GetStateVersion(state.ID, len(data)+1)
+	require.ErrorIs(t, err, storage.ErrVersionNotFound)
+
+	require.NoError(t, s.DeleteState(state.ID))
+
+	versions, err = v.ListStateVersions(state.ID)
+	require.NoError(t, err)
+	require.Empty(t, versions)
+}
+
+// ConcurrentSaveStorageTest verifies that concurrent saves of a state create distinct versions.
+func ConcurrentSaveStorageTest(t *testing.T, s storage.Storage) {
+	v, ok := s.(storage.Versioned)
+	require.True(t, ok, "storage backend %s does not implement versioning", s.GetName())
+
+	id := terraform.GetStateID("test", "concurrent")
+	t.Cleanup(func() {
+		_ = s.DeleteState(id)
+	})
+
+	const saves = 10
+
+	var wg sync.WaitGroup
+	errs := make(chan error, saves)
+
+	for i := 0; i < saves; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			errs <- s.SaveState(&terraform.State{
+				ID:      id,
+				Project: "test",
+				Name:    "concurrent",
+				Data:    []byte(fmt.Sprintf("v%d", i)),
+			})
+		}(i)
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	versions, err := v.ListStateVersions(id)
+	require.NoError(t, err)
+	require.Len(t, versions, saves)
+
+	data := make(map[string]bool)
+
+	for i, version := range versions {
+		require.Equal(t, i+1, version.Version)
+
+		savedVersion, err := v.GetStateVersion(id, version.Version)
+		require.NoError(t, err)
+
+		data[string(savedVersion.Data)] = true
+	}
+
+	require.Len(t, data, saves, "no version must be overwritten")
+}
+
+func ListerStorageTest(t *testing.T, s storage.Storage) {
+	l, ok := s.(storage.Lister)
+	require.True(t, ok, "storage backend %s does not implement listing", s.GetName())
+
+	states := []*terraform.State{
+		{
+			ID:      terraform.GetStateID("test", "listed1"),
+			Project: "test",
+			Name:    "listed1",
+			Data:    []byte("test"),
+		},
+		{
+			ID:      terraform.GetStateID("test", "listed2"),
+			Project: "test",
+			Name:    "listed2",
+			Data:    []byte("test2"),
+		},
+	}
+
+	for _, state := range states {
+		require.NoError(t, s.SaveState(state))
+	}
+
+	infos, err := l.ListStates()
+	require.NoError(t, err)
+
+	for _, state := range states {
+		var found *storage.StateInfo
+
+		for i := range infos {
+			if infos[i].ID == state.ID {
+				found = &infos[i]
+			}
+		}
+
+		require.NotNil(t, found, "state %s not listed", state.ID)
+		require.Equal(t, state.Project, found.Project)
+		require.Equal(t, state.Name, found.Name)
+		require.Equal(t, int64(len(state.Data)), found.Size)
+		require.False(t, found.LastModified.IsZero())
+
+		require.NoError(t, s.DeleteState(state.ID))
+	}
+}
+
+func MetadataStorageTest(t *testing.T, s storage.Storage) {
+	state := &terraform.State{
+		ID:      terraform.GetStateID("test", "metadata"),
+		Project: "test",
+		Name:    "metadata",
+		Data:    []byte("test"),
+		Metadata: terraform.Metadata{
+			AuthMethod: "basic",
+			LastWriter: "first@example",
+			Serial:     1,
+			Lineage:    "a1b2",
+		},
+	}
+
+	require.NoError(t, s.SaveState(state))
+
+	saved, err := s.GetState(state.ID)
+	require.NoError(t, err)
+	require.Equal(t, state.Project, saved.Project)
+	require.Equal(t, state.Name, saved.Name)
+	require.Equal(t, "basic", saved.Metadata.AuthMethod)
+	require.Equal(t, "first@example", saved.Metadata.LastWriter)
+	require.Equal(t, uint64(1), saved.Metadata.Serial)
+	require.Equal(t, "a1b2", saved.Metadata.Lineage)
+	require.False(t, saved.Metadata.Created.IsZero())
+	require.False(t, saved.Metadata.Updated.IsZero())
+
+	created := saved.Metadata.Created
+
+	state.Metadata = terraform.Metadata{
+		AuthMethod: "jwt",
+		LastWriter: "second@example",
+		Serial:     2,
+		Lineage:    "a1b2",
+	}
+
+	require.NoError(t, s.SaveState(state))
+
+	saved, err = s.GetState(state.ID)
+	require.NoError(t, err)
+	require.Equal(t, "jwt", saved.Metadata.AuthMethod)
+	require.Equal(t, "second@example", saved.Metadata.LastWriter)
+	require.Equal(t, uint64(2), saved.Metadata.Serial)
+	require.True(t, created.Equal(saved.Metadata.Created), "created timestamp must not change on update")
+	require.False(t, saved.Metadata.Updated.Before(created))
+
+	require.NoError(t, s.DeleteState(state.ID))
+}
+
+// VersionWriterStorageTest verifies that single versions of a state can be overwritten and imported.
+func VersionWriterStorageTest(t *testing.T, s storage.Storage) {
+	t.Log(s.GetName())
+
+	versioned, ok := s.(storage.Versioned)
+	require.True(t, ok, "storage backend %s should support versioning", s.GetName())
+
+	writer, ok := s.(storage.VersionWriter)
+	require.True(t, ok, "storage backend %s should support writing versions", s.GetName())
+
+	id := terraform.GetStateID("test", "versionwriter")
+	t.Cleanup(func() {
+		_ = s.DeleteState(id)
+	})
+
+	require.NoError(t, s.SaveState(&terraform.State{ID: id, Project: "test", Name: "versionwriter", Data: []byte("v1")}))
+
+	created := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	require.NoError(t, writer.PutStateVersion(id, storage.StateVersion{Version: 1, Created: created}, []byte("v1-rewritten")))
+	require.NoError(t, writer.PutStateVersion(id, storage.StateVersion{Version: 2, Created: created}, []byte("v2-imported")))
+
+	v1, err := versioned.GetStateVersion(id, 1)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1-rewritten"), v1.Data)
+
+	v2, err := versioned.GetStateVersion(id, 2)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v2-imported"), v2.Data)
+
+	// the current state isn't changed
+	current, err := s.GetState(id)
+	require.NoError(t, err)
+	require.Equal(t, []byte("v1"), current.Data)
+
+	versions, err := versioned.ListStateVersions(id)
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+}
+
+// ImporterStorageTest verifies that a state is imported with its metadata and without creating a version.
+func ImporterStorageTest(t *testing.T, s storage.Storage) {
+	importer, ok := s.(storage.Importer)
+	require.True(t, ok, "storage backend %s should support importing states", s.GetName())
+
+	id := terraform.GetStateID("test", "importer")
+	t.Cleanup(func() {
+		_ = s.DeleteState(id)
+	})
+
+	created := time.Now().Add(-24 * time.Hour).Truncate(time.Second).UTC()
+	updated := created.Add(time.Hour)
+
+	state := &terraform.State{
+		ID:      id,
+		Project: "test",
+		Name:    "importer",
+		Data:    []byte("imported"),
+		Metadata: terraform.Metadata{
+			AuthMethod: "basic",
+			LastWriter: "importer@example",
+			Serial:     7,
+			Lineage:    "c3d4",
+			Created:    created,
+			Updated:    updated,
+		},
+	}
+
+	require.NoError(t, importer.ImportState(state))
+
+	saved, err := s.GetState(id)
+	require.NoError(t, err)
+	require.Equal(t, state.Data, saved.Data)
+	require.Equal(t, state.Project, saved.Project)
+	require.Equal(t, state.Name, saved.Name)
+	require.Equal(t, "basic", saved.Metadata.AuthMethod)
+	require.Equal(t, "importer@example", saved.Metadata.LastWriter)
+	require.Equal(t, uint64(7), saved.Metadata.Serial)
+	require.Equal(t, "c3d4", saved.Metadata.Lineage)
+	require.True(t, created.Equal(saved.Metadata.Created), "created timestamp must be imported")
+	require.True(t, updated.Equal(saved.Metadata.Updated), "updated timestamp must be imported")
+
+	if versioned, ok := s.(storage.Versioned); ok {
+		versions, err := versioned.ListStateVersions(id)
+		require.NoError(t, err)
+		require.Empty(t, versions)
+	}
+}
@@ -2,15 +2,32 @@ package terraform
 
 import (
 	"crypto/sha256"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"reflect"
+	"strconv"
+	"time"
 )
 
 type State struct {
-	ID      string
-	Data    []byte
-	Lock    LockInfo
-	Project string
-	Name    string
+	ID       string
+	Data     []byte
+	Lock     LockInfo
+	Project  string
+	Name     string
+	Metadata Metadata
+}
+
+// Metadata is stored together with project and name next to the state data, since the state ID is only a hash.
+type Metadata struct {
+	AuthMethod string    `json:"auth_method"`
+	Created    time.Time `json:"created"`
+	Updated    time.Time `json:"updated"`
+	LastWriter string    `json:"last_writer"`
+	// Serial and Lineage are copied from the state file on write, so that states can be listed without decrypting them
+	Serial  uint64 `json:"serial"`
+	Lineage string `json:"lineage"`
 }
 
 func GetStateID(project, id string) string {
@@ -19,6 +36,100 @@ func GetStateID(project, id string) string {
 	return fmt.Sprintf("%x", hash[:])
 }
 
+// StateFile contains the header fields of a Terraform state file.
+type StateFile struct {
+	Version          int    `json:"version"`
+	TerraformVersion string `json:"terraform_version"`
+	Serial           uint64 `json:"serial"`
+	Lineage          string `json:"lineage"`
+}
+
+func ParseStateFile(d []byte) (*StateFile, error) {
+	var f StateFile
+
+	if err := json.Unmarshal(d, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	return &f, nil
+}
+
+// SetSerial returns the state file with the given serial, all other fields are kept.
+func SetSerial(d []byte, serial uint64) ([]byte, error) {
+	var f map[string]json.RawMessage
+
+	if err := json.Unmarshal(d, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	f["serial"] = json.RawMessage(strconv.FormatUint(serial, 10))
+
+	// Terraform writes state files indented by two spaces
+	return json.MarshalIndent(f, "", "  ")
+}
+
+var (
+	ErrLineageMismatch = errors.New("state lineage differs from the stored state")
+	ErrSerialDecreased = errors.New("state serial is lower than the serial of the stored state")
+	ErrSerialConflict  = errors.New("state differs from the stored state with the same serial")
+)
+
+// CheckStateUpdate verifies that next is a valid successor of the current state file. Like the checks of
+// `terraform state push`, the lineage must not change, the serial must not decrease and a state with the same
+// serial must not differ in content.
+func CheckStateUpdate(current, next []byte) error {
+	currentFile, err := ParseStateFile(current)
+	if err != nil {
+		return fmt.Errorf("current state: %w", err)
+	}
+
+	nextFile, err := ParseStateFile(next)
+	if err != nil {
+		return fmt.Errorf("new state: %w", err)
+	}
+
+	if currentFile.Lineage != "" && currentFile.Lineage != nextFile.Lineage {
+		return fmt.Errorf("%w: %s != %s", ErrLineageMismatch, nextFile.Lineage, currentFile.Lineage)
+	}
+
+	if nextFile.Serial < currentFile.Serial {
+		return fmt.Errorf("%w: %d < %d", ErrSerialDecreased, nextFile.Serial, currentFile.Serial)
+	}
+
+	if nextFile.Serial == currentFile.Serial {
+		equal, err := stateContentEqual(current, next)
+		if err != nil {
+			return err
+		}
+
+		if !equal {
+			return fmt.Errorf("%w %d", ErrSerialConflict, nextFile.Serial)
+		}
+	}
+
+	return nil
+}
+
+// stateContentEqual compares two state files without their header fields.
+func stateContentEqual(a, b []byte) (bool, error) {
+	var contentA, contentB map[string]any
+
+	if err := json.Unmarshal(a, &contentA); err != nil {
+		return false, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &contentB); err != nil {
+		return false, fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	for _, header := range []string{"version", "terraform_version", "serial", "lineage"} {
+		delete(contentA, header)
+		delete(contentB, header)
+	}
+
+	return reflect.DeepEqual(contentA, contentB), nil
+}
+
 type LockInfo struct {
 	ID        string `json:"ID"`
 	Path      string `json:"Path"`
@@ -27,8 +138,16 @@ type LockInfo struct {
 	Version   string `json:"Version"`
 	Created   string `json:"Created"`
 	Info      string `json:"Info"`
+	// Expires is set by the lock backend, it isn't part of the lock information sent by Terraform.
+	Expires time.Time `json:"Expires,omitzero"`
+}
+
+// Expired returns true if the lock has an expiry, which has passed.
+func (l LockInfo) Expired() bool {
+	return !l.Expires.IsZero() && time.Now().After(l.Expires)
 }
 
+// Equal compares the lock information sent by Terraform, therefore the expiry is ignored.
 func (l LockInfo) Equal(r LockInfo) bool {
 	return l.ID == r.ID &&
 		l.Path == r.Path &&
@@ -0,0 +1,36 @@
+package terraform
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckStateUpdate(t *testing.T) {
+	current := []byte(`{"version": 4, "terraform_version": "1.5.0", "serial": 2, "lineage": "a1b2", "outputs": {}}`)
+
+	require.NoError(t, CheckStateUpdate(current, []byte(`{"version": 4, "terraform_version": "1.6.0", "serial": 2, "lineage": "a1b2", "outputs": {}}`)))
+	require.NoError(t, CheckStateUpdate(current, []byte(`{"version": 4, "serial": 3, "lineage": "a1b2", "outputs": {"a": {}}}`)))
+
+	require.ErrorIs(t, CheckStateUpdate(current, []byte(`{"version": 4, "serial": 3, "lineage": "c3d4"}`)), ErrLineageMismatch)
+	require.ErrorIs(t, CheckStateUpdate(current, []byte(`{"version": 4, "serial": 1, "lineage": "a1b2"}`)), ErrSerialDecreased)
+	require.ErrorIs(t, CheckStateUpdate(current, []byte(`{"version": 4, "serial": 2, "lineage": "a1b2", "outputs": {"a": {}}}`)), ErrSerialConflict)
+
+	require.Error(t, CheckStateUpdate(current, []byte(`not a state`)))
+}
+
+func TestSetSerial(t *testing.T) {
+	d, err := SetSerial([]byte(`{"version": 4, "serial": 2, "lineage": "a1b2", "outputs": {"a": {"value": 1}}}`), 5)
+	require.NoError(t, err)
+
+	f, err := ParseStateFile(d)
+	require.NoError(t, err)
+	require.Equal(t, uint64(5), f.Serial)
+	require.Equal(t, "a1b2", f.Lineage)
+
+	// only the serial differs from the original state
+	require.NoError(t, CheckStateUpdate([]byte(`{"version": 4, "serial": 5, "lineage": "a1b2", "outputs": {"a": {"value": 1}}}`), d))
+
+	_, err = SetSerial([]byte(`not a state`), 5)
+	require.Error(t, err)
+}